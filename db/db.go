@@ -7,12 +7,16 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type DB struct {
-	db     *sqlx.DB
-	logger *zap.Logger
+	db             *sqlx.DB
+	dbType         string
+	logger         *zap.Logger
+	tracerProvider trace.TracerProvider
 }
 
 func NewDb(ctx context.Context, cfg DatabaseConfig, logger *zap.Logger) (*DB, func(), error) {
@@ -49,18 +53,23 @@ func NewDb(ctx context.Context, cfg DatabaseConfig, logger *zap.Logger) (*DB, fu
 		}
 	}
 
-	return &DB{db: db, logger: logger}, closeFunc, nil
+	return &DB{db: db, dbType: cfg.DBType, logger: logger}, closeFunc, nil
 }
 
 func (db *DB) Get(ctx context.Context, name string, query string, dest interface{}, args ...interface{}) error {
 	fields := []zap.Field{zap.String("command", name), zap.String("query", query), zap.Any("args", args)}
 	db.logger.Info("db: execute sql:", fields...)
 
+	ctx, span := db.startSpan(ctx, name, attribute.String("db.query.text", query))
+	defer span.End()
+
 	err := db.db.GetContext(ctx, dest, query, args...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			fields = append(fields, zap.Error(err))
 			db.logger.Debug("db: empty response", fields...)
+		} else {
+			recordSpanError(span, err)
 		}
 
 		return err
@@ -73,10 +82,14 @@ func (db *DB) FetchAll(ctx context.Context, name string, query string, dest inte
 	fields := []zap.Field{zap.String("command", name), zap.String("query", query), zap.Any("args", args)}
 	db.logger.Info("db: execute sql:", fields...)
 
+	ctx, span := db.startSpan(ctx, name, attribute.String("db.query.text", query))
+	defer span.End()
+
 	err := db.db.SelectContext(ctx, dest, query, args...)
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: failed sql", fields...)
+		recordSpanError(span, err)
 		return err
 	}
 
@@ -87,10 +100,14 @@ func (db *DB) Create(ctx context.Context, name string, query string, args ...int
 	fields := []zap.Field{zap.String("command", name), zap.String("query", query), zap.Any("args", args)}
 	db.logger.Info("db: execute sql:", fields...)
 
+	ctx, span := db.startSpan(ctx, name, attribute.String("db.query.text", query))
+	defer span.End()
+
 	result, err := db.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: failed sql", fields...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -98,6 +115,7 @@ func (db *DB) Create(ctx context.Context, name string, query string, args ...int
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: Failed to get last insert newID", fields...)
+		recordSpanError(span, err)
 		return 0, err
 
 	}
@@ -109,10 +127,14 @@ func (db *DB) Update(ctx context.Context, name string, query string, args ...int
 	fields := []zap.Field{zap.String("command", name), zap.String("query", query), zap.Any("args", args)}
 	db.logger.Info("db: execute sql:", fields...)
 
+	ctx, span := db.startSpan(ctx, name, attribute.String("db.query.text", query))
+	defer span.End()
+
 	result, err := db.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: failed sql", fields...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -120,6 +142,7 @@ func (db *DB) Update(ctx context.Context, name string, query string, args ...int
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: Failed to get rows affected", fields...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -130,10 +153,14 @@ func (db *DB) Delete(ctx context.Context, name string, query string, args ...int
 	fields := []zap.Field{zap.String("command", name), zap.String("query", query), zap.Any("args", args)}
 	db.logger.Info("db: execute sql:", fields...)
 
+	ctx, span := db.startSpan(ctx, name, attribute.String("db.query.text", query))
+	defer span.End()
+
 	result, err := db.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: failed sql", fields...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -141,6 +168,7 @@ func (db *DB) Delete(ctx context.Context, name string, query string, args ...int
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: Failed to get rows affected", fields...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -153,16 +181,21 @@ func (db *DB) ExecuteTx(ctx context.Context, name string, txFunc TxFunc) error {
 	fields := []zap.Field{zap.String("command", name)}
 	db.logger.Info("db: Execute sql in transaction:", fields...)
 
+	ctx, span := db.startSpan(ctx, name)
+	defer span.End()
+
 	tx, err := db.db.BeginTx(ctx, nil)
 	if err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: Failed to begin transaction", fields...)
+		recordSpanError(span, err)
 		return err
 	}
 
 	if err := txFunc(tx); err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: Failed to execute transaction function", fields...)
+		recordSpanError(span, err)
 
 		if errRollback := tx.Rollback(); errRollback != nil {
 			fields = append(fields, zap.Error(errRollback))
@@ -175,9 +208,14 @@ func (db *DB) ExecuteTx(ctx context.Context, name string, txFunc TxFunc) error {
 	if err := tx.Commit(); err != nil {
 		fields = append(fields, zap.Error(err))
 		db.logger.Error("db: Failed to commit transaction function", fields...)
+		recordSpanError(span, err)
 		return err
 	}
 
 	db.logger.Info("db: Transaction executed successfully", fields...)
 	return nil
 }
+
+func (db *DB) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return startSpan(ctx, db.tracerProvider, name, append(attrs, attribute.String("db.system", db.dbType))...)
+}
@@ -7,15 +7,18 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"net/url"
 	"strings"
 )
 
 type MongoDB struct {
-	Client *mongo.Client
-	dbName string
-	logger *zap.Logger
+	Client         *mongo.Client
+	dbName         string
+	logger         *zap.Logger
+	tracerProvider trace.TracerProvider
 }
 
 func NewMongoDb(ctx context.Context, cfg DatabaseConfig, logger *zap.Logger) (*MongoDB, func(), error) {
@@ -64,11 +67,15 @@ func (db *MongoDB) Get(ctx context.Context, name string, collection string, dest
 	fields := []zap.Field{zap.String("command", name), zap.String("collection", collection), zap.Any("args", bsonFilter)}
 	db.logger.Info("mongo: Executing Get operation", fields...)
 
+	ctx, span := db.startSpan(ctx, name, "findOne", collection)
+	defer span.End()
+
 	coll := db.Client.Database(db.dbName).Collection(collection)
 	err := coll.FindOne(ctx, bsonFilter).Decode(dest)
 	if err != nil {
 		if !errors.Is(err, mongo.ErrNoDocuments) {
 			db.logger.Error("mongo: Failed to execute Get operation", append(fields, zap.Error(err))...)
+			recordSpanError(span, err)
 		}
 
 		return err
@@ -82,10 +89,14 @@ func (db *MongoDB) FetchAll(ctx context.Context, name string, collection string,
 	fields := []zap.Field{zap.String("command", name), zap.String("collection", collection), zap.Any("args", bsonFilter)}
 	db.logger.Info("mongo: Executing FetchAll operation", fields...)
 
+	ctx, span := db.startSpan(ctx, name, "find", collection)
+	defer span.End()
+
 	coll := db.Client.Database(db.dbName).Collection(collection)
 	cursor, err := coll.Find(ctx, bsonFilter)
 	if err != nil {
 		db.logger.Error("mongo: Failed to execute FetchAll operation", append(fields, zap.Error(err))...)
+		recordSpanError(span, err)
 		return err
 	}
 	defer func() {
@@ -96,6 +107,7 @@ func (db *MongoDB) FetchAll(ctx context.Context, name string, collection string,
 
 	if err := cursor.All(ctx, dest); err != nil {
 		db.logger.Error("mongo: Failed to decode FetchAll results", append(fields, zap.Error(err))...)
+		recordSpanError(span, err)
 		return err
 	}
 
@@ -107,10 +119,14 @@ func (db *MongoDB) Create(ctx context.Context, name string, collection string, d
 	fields := []zap.Field{zap.String("command", name), zap.String("database", db.dbName), zap.String("collection", collection), zap.Any("document", document)}
 	db.logger.Info("mongo: Executing Create operation", fields...)
 
+	ctx, span := db.startSpan(ctx, name, "insertOne", collection)
+	defer span.End()
+
 	coll := db.Client.Database(db.dbName).Collection(collection)
 	result, err := coll.InsertOne(ctx, document)
 	if err != nil {
 		db.logger.Error("mongo: Failed to execute Create operation", append(fields, zap.Error(err))...)
+		recordSpanError(span, err)
 		return "", err
 	}
 
@@ -124,10 +140,14 @@ func (db *MongoDB) Update(ctx context.Context, name string, collection string, f
 	fields := []zap.Field{zap.String("command", name), zap.String("database", db.dbName), zap.String("collection", collection), zap.Any("filter", filter), zap.Any("update", update)}
 	db.logger.Info("mongo: Executing Update operation", fields...)
 
+	ctx, span := db.startSpan(ctx, name, "updateMany", collection)
+	defer span.End()
+
 	coll := db.Client.Database(db.dbName).Collection(collection)
 	result, err := coll.UpdateMany(ctx, filter, update)
 	if err != nil {
 		db.logger.Error("mongo: Failed to execute Update operation", append(fields, zap.Error(err))...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -139,10 +159,14 @@ func (db *MongoDB) Delete(ctx context.Context, name string, collection string, f
 	fields := []zap.Field{zap.String("command", name), zap.String("database", db.dbName), zap.String("collection", collection), zap.Any("filter", filter)}
 	db.logger.Info("mongo: Executing Delete operation", fields...)
 
+	ctx, span := db.startSpan(ctx, name, "deleteMany", collection)
+	defer span.End()
+
 	coll := db.Client.Database(db.dbName).Collection(collection)
 	result, err := coll.DeleteMany(ctx, filter)
 	if err != nil {
 		db.logger.Error("mongo: Failed to execute Delete operation", append(fields, zap.Error(err))...)
+		recordSpanError(span, err)
 		return 0, err
 	}
 
@@ -155,9 +179,13 @@ type TxMongoFunc func(sessCtx mongo.SessionContext) error
 func (db *MongoDB) ExecuteTx(ctx context.Context, name string, txFunc TxMongoFunc) error {
 	db.logger.Info("mongo: Executing operation in transaction", zap.String("command", name))
 
+	ctx, span := db.startSpan(ctx, name, "transaction", "")
+	defer span.End()
+
 	session, err := db.Client.StartSession()
 	if err != nil {
 		db.logger.Error("mongo: Failed to start session", zap.Error(err))
+		recordSpanError(span, err)
 		return err
 	}
 	defer session.EndSession(ctx)
@@ -182,9 +210,26 @@ func (db *MongoDB) ExecuteTx(ctx context.Context, name string, txFunc TxMongoFun
 		return nil
 	})
 
+	if err != nil {
+		recordSpanError(span, err)
+	}
+
 	return err
 }
 
+func (db *MongoDB) startSpan(ctx context.Context, name, operation, collection string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.namespace", db.dbName),
+		attribute.String("db.operation.name", operation),
+	}
+	if collection != "" {
+		attrs = append(attrs, attribute.String("db.collection.name", collection))
+	}
+
+	return startSpan(ctx, db.tracerProvider, name, attrs...)
+}
+
 func extractDatabaseName(dsn string) (string, error) {
 	uri, err := url.Parse(dsn)
 	if err != nil {
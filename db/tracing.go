@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/viktor8881/service-utilities/db"
+
+// SetTracerProvider sets the provider of the spans started for every query, the otel global one by default.
+func (db *DB) SetTracerProvider(tracerProvider trace.TracerProvider) {
+	db.tracerProvider = tracerProvider
+}
+
+// SetTracerProvider sets the provider of the spans started for every operation, the otel global one by default.
+func (db *MongoDB) SetTracerProvider(tracerProvider trace.TracerProvider) {
+	db.tracerProvider = tracerProvider
+}
+
+// startSpan starts a client span named by the command name passed to DB and MongoDB methods.
+func startSpan(ctx context.Context, tracerProvider trace.TracerProvider, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	return tracerProvider.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
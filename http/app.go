@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"go.uber.org/zap"
 	"net/http"
@@ -14,6 +15,8 @@ type App struct {
 	Addr   string
 	Mux    *http.ServeMux
 	Logger *zap.Logger
+	// TLSConfig makes Run serve HTTPS, e.g. tlsconfig.Reloader.ServerConfig for rotated certificates.
+	TLSConfig *tls.Config
 }
 
 func NewApp(addr string, logger *zap.Logger) *App {
@@ -26,17 +29,24 @@ func NewApp(addr string, logger *zap.Logger) *App {
 
 func (a *App) Run() {
 	server := &http.Server{
-		Addr:    a.Addr,
-		Handler: a.Mux,
+		Addr:      a.Addr,
+		Handler:   a.Mux,
+		TLSConfig: a.TLSConfig,
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if a.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			a.Logger.Fatal("error when running server:", zap.Error(err))
 		}
 	}()
 
-	a.Logger.Info("server is run.", zap.String("addr", a.Addr))
+	a.Logger.Info("server is run.", zap.String("addr", a.Addr), zap.Bool("tls", a.TLSConfig != nil))
 
 	waitForShutdown(server, a.Logger)
 }
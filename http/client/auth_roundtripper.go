@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultTokenExpiryDelta = 30 * time.Second
+
+// AuthRoundTripper is a http.RoundTripper that sets the Authorization header with a token from Source.
+// The token is cached until ExpiryDelta, at most half of its lifetime, before it expires and is fetched once
+// for all concurrent requests, each of them waits for the fetch only as long as its context allows.
+// When the upstream responds with 401 the token is fetched again and the request is retried once,
+// if its body can be rewound.
+type AuthRoundTripper struct {
+	Proxied     http.RoundTripper
+	Source      TokenSource
+	ExpiryDelta time.Duration
+
+	mu        sync.RWMutex
+	token     *Token
+	fetchedAt time.Time
+	group     singleflight.Group
+}
+
+func NewAuthRoundTripper(proxied http.RoundTripper, source TokenSource) *AuthRoundTripper {
+	return &AuthRoundTripper{
+		Proxied:     proxied,
+		Source:      source,
+		ExpiryDelta: defaultTokenExpiryDelta,
+	}
+}
+
+func (art *AuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	token, err := art.getToken(ctx, nil)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	authReq := req.Clone(ctx)
+	authReq.Header.Set("Authorization", authorizationValue(token))
+
+	resp, err := art.Proxied.RoundTrip(authReq)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	newToken, err := art.getToken(ctx, token)
+	if err != nil {
+		// the 401 response is more useful to the caller than the token error
+		return resp, nil
+	}
+
+	retryReq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retryReq.Body = body
+	}
+	retryReq.Header.Set("Authorization", authorizationValue(newToken))
+
+	drainBody(resp.Body)
+
+	return art.Proxied.RoundTrip(retryReq)
+}
+
+// getToken returns the cached token unless it is expired or is the rejected one.
+func (art *AuthRoundTripper) getToken(ctx context.Context, rejected *Token) (*Token, error) {
+	if token := art.cachedToken(rejected); token != nil {
+		return token, nil
+	}
+
+	fetch := func() (interface{}, error) {
+		if token := art.cachedToken(rejected); token != nil {
+			return token, nil
+		}
+
+		fetchedAt := time.Now()
+		// the fetch is shared between requests, so it must not be canceled by the first one
+		token, err := art.Source.Token(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		art.mu.Lock()
+		art.token = token
+		art.fetchedAt = fetchedAt
+		art.mu.Unlock()
+
+		return token, nil
+	}
+
+	// the shared fetch goes on without a caller that gives up, it may be needed by the others
+	do := func() (interface{}, error) {
+		select {
+		case result := <-art.group.DoChan("token", fetch):
+			return result.Val, result.Err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	value, err := do()
+	if err == nil && rejected != nil && value.(*Token) == rejected {
+		// the joined fetch was started before the token got rejected, so it may return that token
+		value, err = do()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*Token), nil
+}
+
+func (art *AuthRoundTripper) cachedToken(rejected *Token) *Token {
+	art.mu.RLock()
+	defer art.mu.RUnlock()
+
+	if art.token == rejected || art.token == nil {
+		return nil
+	}
+
+	delta := art.ExpiryDelta
+	// a short-lived token would never be valid for the whole delta
+	if lifetime := art.token.Expiry.Sub(art.fetchedAt); lifetime > 0 && delta > lifetime/2 {
+		delta = lifetime / 2
+	}
+	if !art.token.validFor(delta) {
+		return nil
+	}
+
+	return art.token
+}
+
+func authorizationValue(token *Token) string {
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	return tokenType + " " + token.AccessToken
+}
+
+// StaticAuthRoundTripper is a http.RoundTripper that sets a fixed Authorization header.
+type StaticAuthRoundTripper struct {
+	Proxied       http.RoundTripper
+	Authorization string
+}
+
+func NewBearerRoundTripper(proxied http.RoundTripper, token string) *StaticAuthRoundTripper {
+	return &StaticAuthRoundTripper{
+		Proxied:       proxied,
+		Authorization: "Bearer " + token,
+	}
+}
+
+func NewBasicAuthRoundTripper(proxied http.RoundTripper, username, password string) *StaticAuthRoundTripper {
+	return &StaticAuthRoundTripper{
+		Proxied:       proxied,
+		Authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+	}
+}
+
+func (sart *StaticAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	authReq := req.Clone(req.Context())
+	authReq.Header.Set("Authorization", sart.Authorization)
+
+	return sart.Proxied.RoundTrip(authReq)
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTokenServer issues tokens "token-1", "token-2", ... that expire after expiresIn seconds.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := calls.Add(1)
+		// concurrent requests must be able to pile up behind one fetch
+		time.Sleep(20 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+// newAuthorizedServer responds with 401 to the tokens in rejected and with 200 to the others.
+func newAuthorizedServer(t *testing.T, rejected ...string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, token := range rejected {
+			if r.Header.Get("Authorization") == "Bearer "+token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func sendAuthRequest(t *testing.T, art *AuthRoundTripper, url string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := art.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	return resp
+}
+
+func TestAuthRoundTripperTokenCache(t *testing.T) {
+	tests := []struct {
+		name           string
+		expiresIn      int
+		wantTokenCalls int32
+	}{
+		{name: "long-lived token", expiresIn: 3600, wantTokenCalls: 1},
+		// with the default 30s delta the token would be fetched for every request
+		{name: "token shorter than the expiry delta", expiresIn: 10, wantTokenCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenServer, tokenCalls := newTokenServer(t, tt.expiresIn)
+			server := newAuthorizedServer(t)
+
+			art := NewAuthRoundTripper(http.DefaultTransport, NewClientCredentialsSource(tokenServer.URL, "id", "secret"))
+			for range 3 {
+				sendAuthRequest(t, art, server.URL)
+			}
+
+			if got := tokenCalls.Load(); got != tt.wantTokenCalls {
+				t.Fatalf("token endpoint got %d requests, want %d", got, tt.wantTokenCalls)
+			}
+		})
+	}
+}
+
+func TestAuthRoundTripperConcurrentFetch(t *testing.T) {
+	tokenServer, tokenCalls := newTokenServer(t, 3600)
+	server := newAuthorizedServer(t)
+
+	art := NewAuthRoundTripper(http.DefaultTransport, NewClientCredentialsSource(tokenServer.URL, "id", "secret"))
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sendAuthRequest(t, art, server.URL)
+		}()
+	}
+	wg.Wait()
+
+	if got := tokenCalls.Load(); got != 1 {
+		t.Fatalf("token endpoint got %d requests, want 1", got)
+	}
+}
+
+func TestAuthRoundTripperUnauthorized(t *testing.T) {
+	tests := []struct {
+		name           string
+		rejected       []string
+		body           string
+		wantStatus     int
+		wantTokenCalls int32
+	}{
+		{name: "retried with a new token", rejected: []string{"token-1"}, wantStatus: http.StatusOK, wantTokenCalls: 2},
+		{name: "retried with a body", rejected: []string{"token-1"}, body: "payload", wantStatus: http.StatusOK, wantTokenCalls: 2},
+		{name: "retried once", rejected: []string{"token-1", "token-2"}, wantStatus: http.StatusUnauthorized, wantTokenCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenServer, tokenCalls := newTokenServer(t, 3600)
+			server := newAuthorizedServer(t, tt.rejected...)
+
+			art := NewAuthRoundTripper(http.DefaultTransport, NewClientCredentialsSource(tokenServer.URL, "id", "secret"))
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := art.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := tokenCalls.Load(); got != tt.wantTokenCalls {
+				t.Fatalf("token endpoint got %d requests, want %d", got, tt.wantTokenCalls)
+			}
+		})
+	}
+}
+
+// blockingTokenSource returns its token once release is closed.
+type blockingTokenSource struct {
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (s *blockingTokenSource) Token(context.Context) (*Token, error) {
+	if s.calls.Add(1) == 1 {
+		close(s.started)
+	}
+	<-s.release
+	return &Token{AccessToken: "token-1", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestAuthRoundTripperWaiterDeadline(t *testing.T) {
+	source := &blockingTokenSource{started: make(chan struct{}), release: make(chan struct{})}
+	art := NewAuthRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}), source)
+
+	leader := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://users.local/users", nil)
+		_, err := art.RoundTrip(req)
+		leader <- err
+	}()
+	<-source.started
+
+	// a caller joining the slow fetch gives up at its own deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://users.local/users", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := art.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RoundTrip() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("RoundTrip() returned after %s, want at the caller's deadline", elapsed)
+	}
+	if !body.closed {
+		t.Fatal("request body not closed")
+	}
+
+	// the fetch goes on for the caller without a deadline
+	close(source.release)
+	if err := <-leader; err != nil {
+		t.Fatal(err)
+	}
+	if got := source.calls.Load(); got != 1 {
+		t.Fatalf("token fetches = %d, want 1", got)
+	}
+}
@@ -0,0 +1,456 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBalancerFailureThreshold = 5
+	defaultBalancerEjectionCoolDown = 30 * time.Second
+	defaultResolveInterval          = 30 * time.Second
+	defaultHealthCheckInterval      = 10 * time.Second
+)
+
+var ErrNoEndpoints = errors.New("balancer has no endpoints")
+
+type BalanceStrategy int
+
+const (
+	RoundRobin BalanceStrategy = iota
+	// LeastInFlight picks the endpoint with the fewest requests whose response body is not closed yet.
+	LeastInFlight
+	// ConsistentHash sends requests with the same key (see ContextWithBalanceKey) to the same endpoint,
+	// requests without a key are balanced round-robin.
+	ConsistentHash
+)
+
+func (s BalanceStrategy) String() string {
+	switch s {
+	case RoundRobin:
+		return "round-robin"
+	case LeastInFlight:
+		return "least-in-flight"
+	case ConsistentHash:
+		return "consistent-hash"
+	default:
+		return "unknown"
+	}
+}
+
+type balanceKeyContextKey struct{}
+
+// ContextWithBalanceKey sets the key used by the ConsistentHash strategy, e.g. a user or tenant id.
+func ContextWithBalanceKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, balanceKeyContextKey{}, key)
+}
+
+func BalanceKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(balanceKeyContextKey{}).(string)
+	return key
+}
+
+// ResolverFunc returns the current list of endpoint base URLs, see Balancer.StartResolver.
+type ResolverFunc func(ctx context.Context) ([]string, error)
+
+// Balancer is a http.RoundTripper that spreads requests over several instances of a service.
+// The scheme and host of the request URL are replaced with the ones of the chosen endpoint
+// and the endpoint path is prepended to the request path, so a Client in front of it is
+// created with an empty base URL (see NewBalancedClient) and a path prefix shared by all
+// instances, e.g. "/api/v1", belongs to the endpoint URLs.
+//
+// An endpoint is ejected for EjectionCoolDown after FailureThreshold consecutive failures
+// (transport errors or responses with a status class listed in FailureStatusClasses),
+// and while it fails the active health check. If every endpoint is ejected, requests are
+// spread over all of them.
+//
+// Round trippers that should retry on another endpoint (e.g. RetryRoundTripper) wrap the Balancer,
+// the ones that need the real host (e.g. MetricRoundTripper) are put into Proxied.
+type Balancer struct {
+	Proxied              http.RoundTripper
+	Strategy             BalanceStrategy
+	FailureThreshold     int
+	EjectionCoolDown     time.Duration
+	FailureStatusClasses []int
+	// OnResolveError is called when the resolver fails, the previous endpoints are kept.
+	OnResolveError func(err error)
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      atomic.Uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type endpoint struct {
+	raw      string
+	url      *url.URL
+	inFlight atomic.Int64
+
+	// guarded by Balancer.mu
+	failures     int
+	ejectedUntil time.Time
+	unhealthy    bool
+}
+
+func NewBalancer(proxied http.RoundTripper, strategy BalanceStrategy, endpoints ...string) (*Balancer, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &Balancer{
+		Proxied:              proxied,
+		Strategy:             strategy,
+		FailureThreshold:     defaultBalancerFailureThreshold,
+		EjectionCoolDown:     defaultBalancerEjectionCoolDown,
+		FailureStatusClasses: []int{5},
+		ctx:                  ctx,
+		cancel:               cancel,
+	}
+
+	if err := b.SetEndpoints(endpoints...); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// SetEndpoints replaces the endpoint list. Endpoints that stay in the list keep their state.
+func (b *Balancer) SetEndpoints(endpoints ...string) error {
+	parsed := make([]*endpoint, 0, len(endpoints))
+	for _, raw := range endpoints {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("endpoint %q must be an absolute URL", raw)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+
+		parsed = append(parsed, &endpoint{raw: raw, url: u})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, ep := range parsed {
+		for _, old := range b.endpoints {
+			if old.raw == ep.raw {
+				parsed[i] = old
+				break
+			}
+		}
+	}
+	b.endpoints = parsed
+
+	return nil
+}
+
+// Endpoints returns the current endpoint list.
+func (b *Balancer) Endpoints() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	endpoints := make([]string, 0, len(b.endpoints))
+	for _, ep := range b.endpoints {
+		endpoints = append(endpoints, ep.raw)
+	}
+
+	return endpoints
+}
+
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	ep, err := b.pick(req)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	outReq := req.Clone(req.Context())
+	outReq.URL.Scheme = ep.url.Scheme
+	outReq.URL.Host = ep.url.Host
+	outReq.URL.Path = joinEndpointPath(ep.url.Path, req.URL.Path)
+	outReq.URL.RawPath = ""
+	if req.URL.RawPath != "" {
+		outReq.URL.RawPath = joinEndpointPath(ep.url.EscapedPath(), req.URL.RawPath)
+	}
+	outReq.Host = ""
+
+	ep.inFlight.Add(1)
+	resp, err := b.Proxied.RoundTrip(outReq)
+
+	if err != nil {
+		ep.inFlight.Add(-1)
+		// the endpoint is not to blame if the caller gave up
+		if req.Context().Err() == nil {
+			b.onResult(ep, false)
+		}
+		return nil, err
+	}
+
+	b.onResult(ep, !slices.Contains(b.FailureStatusClasses, resp.StatusCode/100))
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		ep.inFlight.Add(-1)
+	} else {
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { ep.inFlight.Add(-1) }}
+	}
+
+	return resp, nil
+}
+
+// StartResolver calls resolve now and then every interval (30 seconds if not positive) and replaces
+// the endpoints with the result until Close is called. An empty result is ignored.
+func (b *Balancer) StartResolver(resolve ResolverFunc, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+
+	b.loop(interval, func(ctx context.Context) {
+		endpoints, err := resolve(ctx)
+		if err == nil && len(endpoints) > 0 {
+			err = b.SetEndpoints(endpoints...)
+		}
+		if err != nil && b.OnResolveError != nil {
+			b.OnResolveError(err)
+		}
+	})
+}
+
+// StartHealthCheck sends GET path (relative to the endpoint URL) to every endpoint now and then
+// every interval (10 seconds if not positive) until Close is called. Endpoints that do not answer
+// with 2xx within the interval are not used until they recover.
+func (b *Balancer) StartHealthCheck(path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	b.loop(interval, func(ctx context.Context) {
+		b.mu.Lock()
+		endpoints := slices.Clone(b.endpoints)
+		b.mu.Unlock()
+
+		var wg sync.WaitGroup
+		for _, ep := range endpoints {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				healthy := b.probe(ctx, ep, path, interval)
+
+				b.mu.Lock()
+				ep.unhealthy = !healthy
+				b.mu.Unlock()
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// Close stops the resolver and the health check.
+func (b *Balancer) Close() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+func (b *Balancer) loop(interval time.Duration, run func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			run(b.ctx)
+
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// joinEndpointPath prepends the endpoint path, the client endpoint may be given without the leading slash.
+func joinEndpointPath(endpointPath, path string) string {
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return endpointPath + path
+}
+
+func (b *Balancer) probe(ctx context.Context, ep *endpoint, path string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.url.String()+path, nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := b.Proxied.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	drainBody(resp.Body)
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+func (b *Balancer) pick(req *http.Request) (*endpoint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	now := time.Now()
+	candidates := make([]*endpoint, 0, len(b.endpoints))
+	for _, ep := range b.endpoints {
+		if !ep.unhealthy && now.After(ep.ejectedUntil) {
+			candidates = append(candidates, ep)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	start := int(b.next.Add(1) % uint64(len(candidates)))
+
+	switch b.Strategy {
+	case LeastInFlight:
+		best := candidates[start]
+		for i := 1; i < len(candidates); i++ {
+			ep := candidates[(start+i)%len(candidates)]
+			if ep.inFlight.Load() < best.inFlight.Load() {
+				best = ep
+			}
+		}
+		return best, nil
+	case ConsistentHash:
+		if key := BalanceKeyFromContext(req.Context()); key != "" {
+			return rendezvous(candidates, key), nil
+		}
+	}
+
+	return candidates[start], nil
+}
+
+func (b *Balancer) onResult(ep *endpoint, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		ep.failures = 0
+		return
+	}
+
+	ep.failures++
+	if b.FailureThreshold > 0 && ep.failures >= b.FailureThreshold {
+		ep.failures = 0
+		ep.ejectedUntil = time.Now().Add(b.EjectionCoolDown)
+	}
+}
+
+// rendezvous picks the endpoint with the highest hash of key and endpoint, so that removing
+// an endpoint moves only the keys that were sent to it.
+func rendezvous(endpoints []*endpoint, key string) *endpoint {
+	var best *endpoint
+	var bestScore uint64
+	for _, ep := range endpoints {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(key))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(ep.raw))
+
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = ep, score
+		}
+	}
+
+	return best
+}
+
+// SRVResolver resolves endpoints from a DNS SRV record, e.g. SRVResolver("http", "tcp", "users.service.consul", "http").
+func SRVResolver(service, proto, name, scheme string) ResolverFunc {
+	return func(ctx context.Context) ([]string, error) {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints := make([]string, 0, len(records))
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			endpoints = append(endpoints, scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+		}
+
+		return endpoints, nil
+	}
+}
+
+// FileResolver reads endpoints from a file with one URL per line, empty lines and lines starting with # are skipped.
+func FileResolver(path string) ResolverFunc {
+	return func(_ context.Context) ([]string, error) {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		var endpoints []string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			endpoints = append(endpoints, line)
+		}
+
+		return endpoints, scanner.Err()
+	}
+}
+
+// releasingBody calls release once the body is read to the end or closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (rb *releasingBody) Read(p []byte) (int, error) {
+	n, err := rb.ReadCloser.Read(p)
+	if err == io.EOF {
+		rb.once.Do(rb.release)
+	}
+
+	return n, err
+}
+
+func (rb *releasingBody) Close() error {
+	rb.once.Do(rb.release)
+	return rb.ReadCloser.Close()
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// balancerHosts is the Proxied of a Balancer that answers with the status set for the host, 200 by default.
+// The response body is kept open until the test closes it.
+type balancerHosts struct {
+	mu       sync.Mutex
+	status   map[string]int
+	requests []string
+}
+
+func (bh *balancerHosts) RoundTrip(req *http.Request) (*http.Response, error) {
+	bh.mu.Lock()
+	defer bh.mu.Unlock()
+
+	bh.requests = append(bh.requests, req.URL.Host)
+	status := http.StatusOK
+	if code, ok := bh.status[req.URL.Host]; ok {
+		status = code
+	}
+
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("ok")), Request: req}, nil
+}
+
+// sendBalanced sends a request through balancer and returns the host it was sent to and the open response body.
+func sendBalanced(t *testing.T, balancer *Balancer, ctx context.Context) (string, io.Closer) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := balancer.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Request.URL.Host, resp.Body
+}
+
+func countHosts(t *testing.T, balancer *Balancer, requests int) map[string]int {
+	t.Helper()
+
+	counts := make(map[string]int)
+	for range requests {
+		host, body := sendBalanced(t, balancer, context.Background())
+		_ = body.Close()
+		counts[host]++
+	}
+
+	return counts
+}
+
+func TestBalancedClientPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.EscapedPath()))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		spec     RequestSpec
+		want     string
+	}{
+		{name: "absolute path", endpoint: server.URL, spec: RequestSpec{Endpoint: "/users"}, want: "/users"},
+		{name: "endpoint prefix", endpoint: server.URL + "/api/", spec: RequestSpec{Endpoint: "/users"}, want: "/api/users"},
+		{name: "path without leading slash", endpoint: server.URL + "/api", spec: RequestSpec{Endpoint: "users"}, want: "/api/users"},
+		{name: "escaped path", endpoint: server.URL + "/api", spec: RequestSpec{Endpoint: "/files/{name}", Query: struct {
+			Name string `path:"name"`
+		}{Name: "a/b"}}, want: "/api/files/a%2Fb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balancer, err := NewBalancer(nil, RoundRobin, tt.endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := NewBalancedClient(balancer, time.Second)
+			defer c.Close()
+
+			tt.spec.Method = http.MethodGet
+			resp, err := c.Do(context.Background(), tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(body); got != tt.want {
+				t.Fatalf("path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBalancerLoopDefaultInterval(t *testing.T) {
+	balancer, err := NewBalancer(http.DefaultTransport, RoundRobin, "http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := make(chan struct{}, 1)
+	balancer.StartResolver(func(context.Context) ([]string, error) {
+		resolved <- struct{}{}
+		return nil, nil
+	}, 0)
+	balancer.StartHealthCheck("/health", -time.Second)
+
+	<-resolved
+	balancer.Close()
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	balancer, err := NewBalancer(&balancerHosts{}, RoundRobin, "http://a.local", "http://b.local", "http://c.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var previous string
+	counts := make(map[string]int)
+	for range 6 {
+		host, body := sendBalanced(t, balancer, context.Background())
+		_ = body.Close()
+		if host == previous {
+			t.Fatalf("two requests in a row sent to %s", host)
+		}
+		previous = host
+		counts[host]++
+	}
+
+	if want := map[string]int{"a.local": 2, "b.local": 2, "c.local": 2}; !reflect.DeepEqual(counts, want) {
+		t.Fatalf("requests per endpoint = %v, want %v", counts, want)
+	}
+}
+
+func TestBalancerLeastInFlight(t *testing.T) {
+	balancer, err := NewBalancer(&balancerHosts{}, LeastInFlight, "http://a.local", "http://b.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, firstBody := sendBalanced(t, balancer, context.Background())
+	second, secondBody := sendBalanced(t, balancer, context.Background())
+	if first == second {
+		t.Fatalf("both requests sent to %s while the first one is in flight", first)
+	}
+
+	// the endpoint whose response body is closed is the least loaded one
+	_ = firstBody.Close()
+	for range 3 {
+		host, body := sendBalanced(t, balancer, context.Background())
+		_ = body.Close()
+		if host != first {
+			t.Fatalf("request sent to %s, want the idle %s", host, first)
+		}
+	}
+	_ = secondBody.Close()
+}
+
+func TestBalancerConsistentHash(t *testing.T) {
+	balancer, err := NewBalancer(&balancerHosts{}, ConsistentHash, "http://a.local", "http://b.local", "http://c.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ContextWithBalanceKey(context.Background(), "tenant-42")
+	sticky, body := sendBalanced(t, balancer, ctx)
+	_ = body.Close()
+	for range 10 {
+		host, body := sendBalanced(t, balancer, ctx)
+		_ = body.Close()
+		if host != sticky {
+			t.Fatalf("request with the same key sent to %s, want %s", host, sticky)
+		}
+	}
+
+	// removing another endpoint does not move the key
+	var endpoints []string
+	for _, endpoint := range balancer.Endpoints() {
+		if endpoint == "http://"+sticky || len(endpoints) == 0 {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if err := balancer.SetEndpoints(endpoints...); err != nil {
+		t.Fatal(err)
+	}
+	if host, body := sendBalanced(t, balancer, ctx); host != sticky {
+		t.Fatalf("request sent to %s after removing another endpoint, want %s", host, sticky)
+	} else {
+		_ = body.Close()
+	}
+
+	// requests without a key are balanced round-robin
+	if counts := countHosts(t, balancer, 4); len(counts) != len(endpoints) {
+		t.Fatalf("requests without a key per endpoint = %v, want all of %v", counts, endpoints)
+	}
+}
+
+func TestBalancerEjection(t *testing.T) {
+	hosts := &balancerHosts{status: map[string]int{"a.local": http.StatusBadGateway}}
+	balancer, err := NewBalancer(hosts, RoundRobin, "http://a.local", "http://b.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	balancer.FailureThreshold = 2
+	balancer.EjectionCoolDown = 50 * time.Millisecond
+
+	// two failures of a.local eject it
+	counts := countHosts(t, balancer, 4)
+	if counts["a.local"] != 2 {
+		t.Fatalf("requests per endpoint = %v, want 2 to a.local before it is ejected", counts)
+	}
+	if counts := countHosts(t, balancer, 4); counts["a.local"] != 0 {
+		t.Fatalf("requests per endpoint = %v, want none to the ejected a.local", counts)
+	}
+
+	// re-admitted after the cool down
+	time.Sleep(60 * time.Millisecond)
+	hosts.mu.Lock()
+	delete(hosts.status, "a.local")
+	hosts.mu.Unlock()
+	if counts := countHosts(t, balancer, 4); counts["a.local"] != 2 {
+		t.Fatalf("requests per endpoint = %v, want a.local back after the cool down", counts)
+	}
+
+	// with every endpoint ejected requests are spread over all of them
+	hosts.mu.Lock()
+	hosts.status = map[string]int{"a.local": http.StatusBadGateway, "b.local": http.StatusServiceUnavailable}
+	hosts.mu.Unlock()
+	countHosts(t, balancer, 4)
+	if counts := countHosts(t, balancer, 4); counts["a.local"] != 2 || counts["b.local"] != 2 {
+		t.Fatalf("requests per endpoint = %v, want both with every endpoint ejected", counts)
+	}
+}
+
+func TestBalancerResolver(t *testing.T) {
+	balancer, err := NewBalancer(&balancerHosts{}, RoundRobin, "http://a.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer balancer.Close()
+
+	results := make(chan func() ([]string, error))
+	resolveErrors := make(chan error, 1)
+	balancer.OnResolveError = func(err error) { resolveErrors <- err }
+	balancer.StartResolver(func(ctx context.Context) ([]string, error) {
+		select {
+		case result := <-results:
+			return result()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}, time.Millisecond)
+
+	resolve := func(endpoints []string, err error) {
+		results <- func() ([]string, error) { return endpoints, err }
+		// the next call starts after the result is applied
+		results <- func() ([]string, error) { return nil, nil }
+	}
+
+	resolve([]string{"http://b.local", "http://c.local"}, nil)
+	if got, want := balancer.Endpoints(), []string{"http://b.local", "http://c.local"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Endpoints() = %v, want %v", got, want)
+	}
+	if counts := countHosts(t, balancer, 2); counts["b.local"] != 1 || counts["c.local"] != 1 {
+		t.Fatalf("requests per endpoint = %v, want the resolved endpoints", counts)
+	}
+
+	resolveErr := errors.New("lookup failed")
+	resolve(nil, resolveErr)
+	if err := <-resolveErrors; !errors.Is(err, resolveErr) {
+		t.Fatalf("OnResolveError() error = %v, want %v", err, resolveErr)
+	}
+	if got := balancer.Endpoints(); len(got) != 2 {
+		t.Fatalf("Endpoints() after a failed resolve = %v, want the previous endpoints", got)
+	}
+
+	resolve([]string{"users.local"}, nil)
+	if err := <-resolveErrors; err == nil {
+		t.Fatal("OnResolveError() error = nil, want an error for a relative endpoint")
+	}
+	if got := balancer.Endpoints(); len(got) != 2 {
+		t.Fatalf("Endpoints() after an invalid resolve = %v, want the previous endpoints", got)
+	}
+}
+
+func TestBalancerNoEndpoints(t *testing.T) {
+	balancer, err := NewBalancer(&balancerHosts{}, RoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+	req, err := http.NewRequest(http.MethodPost, "/users", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := balancer.RoundTrip(req); !errors.Is(err, ErrNoEndpoints) {
+		t.Fatalf("RoundTrip() error = %v, want ErrNoEndpoints", err)
+	}
+	if !body.closed {
+		t.Fatal("body of the rejected request was not closed")
+	}
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// RequestBody encodes a request body and reports its content type.
+type RequestBody interface {
+	Encode() (body io.Reader, contentType string, err error)
+}
+
+type jsonBody struct {
+	value       any
+	contentType string
+}
+
+// JSONBody encodes value as application/json.
+func JSONBody(value any) RequestBody {
+	return &jsonBody{value: value, contentType: "application/json"}
+}
+
+// MergePatchBody encodes value as a JSON Merge Patch document (RFC 7396).
+func MergePatchBody(value any) RequestBody {
+	return &jsonBody{value: value, contentType: "application/merge-patch+json"}
+}
+
+func (b *jsonBody) Encode() (io.Reader, string, error) {
+	jsonData, err := json.Marshal(b.value)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return bytes.NewBuffer(jsonData), b.contentType, nil
+}
+
+type formBody struct {
+	values url.Values
+}
+
+// FormBody encodes values as application/x-www-form-urlencoded.
+func FormBody(values url.Values) RequestBody {
+	return &formBody{values: values}
+}
+
+func (b *formBody) Encode() (io.Reader, string, error) {
+	return strings.NewReader(b.values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+type rawBody struct {
+	reader      io.Reader
+	contentType string
+}
+
+// RawBody sends reader as is. The request is retryable only when reader is
+// a *bytes.Buffer, *bytes.Reader or *strings.Reader.
+func RawBody(reader io.Reader, contentType string) RequestBody {
+	return &rawBody{reader: reader, contentType: contentType}
+}
+
+func (b *rawBody) Encode() (io.Reader, string, error) {
+	return b.reader, b.contentType, nil
+}
+
+// MultipartFile is a file part of a multipart/form-data body.
+type MultipartFile struct {
+	FieldName   string
+	FileName    string
+	ContentType string
+	Reader      io.Reader
+}
+
+type multipartBody struct {
+	fields map[string]string
+	files  []MultipartFile
+}
+
+// MultipartBody encodes fields and files as multipart/form-data, the fields sorted by name
+// and then the files. The body is streamed from the file readers while the request is sent,
+// so it is never buffered in memory and the request can not be retried.
+func MultipartBody(fields map[string]string, files ...MultipartFile) RequestBody {
+	return &multipartBody{fields: fields, files: files}
+}
+
+func (b *multipartBody) Encode() (io.Reader, string, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(b.write(writer))
+	}()
+
+	return pr, writer.FormDataContentType(), nil
+}
+
+func (b *multipartBody) write(writer *multipart.Writer) error {
+	// sorted so that the same request is encoded the same way, e.g. to match a recorded one
+	for _, name := range slices.Sorted(maps.Keys(b.fields)) {
+		if err := writer.WriteField(name, b.fields[name]); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range b.files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(file.FieldName), escapeQuotes(file.FileName)))
+
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(part, file.Reader); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// closeRequestBody closes the body of a request that is rejected without being sent.
+// A round tripper must close it even on error: the writer of a MultipartBody blocks until
+// the body is read or closed.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+const (
+	defaultBulkheadBackoffRatio     = 0.9
+	defaultBulkheadLatencyThreshold = time.Second
+)
+
+// BulkheadRoundTripper is a http.RoundTripper that limits concurrent requests per key to MaxConcurrent,
+// so that a slow upstream can not take every goroutine of the service. The key is the request host unless
+// KeyFunc is set. A request holds its slot until the response body is read to the end or closed.
+//
+// Requests over the limit wait in a FIFO queue of up to MaxQueue requests for at most QueueTimeout
+// (0 means as long as the request context allows). When the queue is full or the wait times out
+// the request fails with BulkheadFullError.
+//
+// With Adaptive the limit moves between MinConcurrent and MaxConcurrent (starting at MaxConcurrent) by AIMD:
+// it grows by one per limit of requests answered faster than LatencyThreshold and is multiplied by BackoffRatio
+// when a request is slower, fails or is answered with 429 or 503.
+type BulkheadRoundTripper struct {
+	Proxied       http.RoundTripper
+	MaxConcurrent int
+	MaxQueue      int
+	QueueTimeout  time.Duration
+	KeyFunc       func(req *http.Request) string
+
+	Adaptive         bool
+	MinConcurrent    int
+	LatencyThreshold time.Duration
+	BackoffRatio     float64
+
+	mu           sync.Mutex
+	compartments map[string]*compartment
+
+	inFlightGauge   *prometheus.GaugeVec
+	queuedGauge     *prometheus.GaugeVec
+	limitGauge      *prometheus.GaugeVec
+	rejectedCounter *prometheus.CounterVec
+}
+
+type compartment struct {
+	limit    float64
+	inFlight int
+	// waiters holds chan struct{} that receive a slot
+	waiters *list.List
+}
+
+func NewBulkheadRoundTripper(proxied http.RoundTripper, maxConcurrent, maxQueue int) *BulkheadRoundTripper {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+
+	brt := &BulkheadRoundTripper{
+		Proxied:          proxied,
+		MaxConcurrent:    maxConcurrent,
+		MaxQueue:         maxQueue,
+		MinConcurrent:    1,
+		LatencyThreshold: defaultBulkheadLatencyThreshold,
+		BackoffRatio:     defaultBulkheadBackoffRatio,
+		compartments:     make(map[string]*compartment),
+	}
+	brt.initMetrics(nil)
+
+	return brt
+}
+
+func (brt *BulkheadRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := brt.key(req)
+
+	if err := brt.acquire(req.Context(), key); err != nil {
+		var fullErr *BulkheadFullError
+		if errors.As(err, &fullErr) {
+			brt.rejectedCounter.WithLabelValues(key).Inc()
+		}
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := brt.Proxied.RoundTrip(req)
+	latency := time.Since(start)
+
+	if err != nil {
+		// the upstream is not to blame if the caller gave up
+		overloaded := req.Context().Err() == nil
+		brt.release(key, latency, overloaded)
+		return nil, err
+	}
+
+	overloaded := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+	release := func() { brt.release(key, latency, overloaded) }
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		release()
+	} else {
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	}
+
+	return resp, nil
+}
+
+// RegisterMetrics registers the metrics in registerer with the client label set to name, before the first request.
+func (brt *BulkheadRoundTripper) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	brt.initMetrics(prometheus.Labels{"client": name})
+	brt.inFlightGauge = metrics.MustRegisterOrExisting(registerer, brt.inFlightGauge)
+	brt.queuedGauge = metrics.MustRegisterOrExisting(registerer, brt.queuedGauge)
+	brt.limitGauge = metrics.MustRegisterOrExisting(registerer, brt.limitGauge)
+	brt.rejectedCounter = metrics.MustRegisterOrExisting(registerer, brt.rejectedCounter)
+}
+
+func (brt *BulkheadRoundTripper) initMetrics(constLabels prometheus.Labels) {
+	brt.inFlightGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "http_client_bulkhead_in_flight",
+			Help:        "Number of requests holding a bulkhead slot.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+	brt.queuedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "http_client_bulkhead_queued",
+			Help:        "Number of requests waiting for a bulkhead slot.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+	brt.limitGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "http_client_bulkhead_limit",
+			Help:        "Current concurrency limit of the bulkhead.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+	brt.rejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "http_client_bulkhead_rejected_total",
+			Help:        "Total number of requests rejected by the bulkhead.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+}
+
+// Limit returns the current concurrency limit for the key.
+func (brt *BulkheadRoundTripper) Limit(key string) int {
+	brt.mu.Lock()
+	defer brt.mu.Unlock()
+
+	return brt.compartment(key).currentLimit()
+}
+
+func (brt *BulkheadRoundTripper) key(req *http.Request) string {
+	if brt.KeyFunc != nil {
+		return brt.KeyFunc(req)
+	}
+
+	return req.URL.Host
+}
+
+func (brt *BulkheadRoundTripper) acquire(ctx context.Context, key string) error {
+	brt.mu.Lock()
+	c := brt.compartment(key)
+
+	if c.inFlight < c.currentLimit() && c.waiters.Len() == 0 {
+		c.inFlight++
+		brt.inFlightGauge.WithLabelValues(key).Set(float64(c.inFlight))
+		brt.mu.Unlock()
+		return nil
+	}
+
+	if c.waiters.Len() >= brt.MaxQueue {
+		limit := c.currentLimit()
+		brt.mu.Unlock()
+		return &BulkheadFullError{Key: key, Limit: limit}
+	}
+
+	ready := make(chan struct{}, 1)
+	element := c.waiters.PushBack(ready)
+	brt.queuedGauge.WithLabelValues(key).Set(float64(c.waiters.Len()))
+	brt.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if brt.QueueTimeout > 0 {
+		timer := time.NewTimer(brt.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timeout:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	brt.mu.Lock()
+	if err == nil {
+		err = &BulkheadFullError{Key: key, Limit: c.currentLimit(), QueueTimeout: true}
+	}
+	select {
+	case <-ready:
+		// the slot was handed over while giving up, pass it on
+		brt.mu.Unlock()
+		brt.release(key, 0, false)
+		return err
+	default:
+	}
+	c.waiters.Remove(element)
+	brt.queuedGauge.WithLabelValues(key).Set(float64(c.waiters.Len()))
+	brt.mu.Unlock()
+
+	return err
+}
+
+// release frees the slot, adapts the limit and hands free slots to the queue.
+func (brt *BulkheadRoundTripper) release(key string, latency time.Duration, overloaded bool) {
+	brt.mu.Lock()
+	defer brt.mu.Unlock()
+
+	c := brt.compartment(key)
+	c.inFlight--
+
+	if brt.Adaptive && latency > 0 {
+		minLimit := float64(max(brt.MinConcurrent, 1))
+		if overloaded || (brt.LatencyThreshold > 0 && latency > brt.LatencyThreshold) {
+			c.limit = max(minLimit, c.limit*brt.BackoffRatio)
+		} else {
+			c.limit = min(float64(brt.MaxConcurrent), c.limit+1/c.limit)
+		}
+		brt.limitGauge.WithLabelValues(key).Set(float64(c.currentLimit()))
+	}
+
+	for c.inFlight < c.currentLimit() && c.waiters.Len() > 0 {
+		ready := c.waiters.Remove(c.waiters.Front()).(chan struct{})
+		c.inFlight++
+		ready <- struct{}{}
+	}
+
+	brt.inFlightGauge.WithLabelValues(key).Set(float64(c.inFlight))
+	brt.queuedGauge.WithLabelValues(key).Set(float64(c.waiters.Len()))
+}
+
+// compartment must be called with brt.mu held.
+func (brt *BulkheadRoundTripper) compartment(key string) *compartment {
+	if brt.compartments == nil {
+		brt.compartments = make(map[string]*compartment)
+	}
+
+	c, ok := brt.compartments[key]
+	if !ok {
+		c = &compartment{limit: float64(max(brt.MaxConcurrent, 1)), waiters: list.New()}
+		brt.compartments[key] = c
+		brt.limitGauge.WithLabelValues(key).Set(c.limit)
+	}
+
+	return c
+}
+
+func (c *compartment) currentLimit() int {
+	return max(int(c.limit), 1)
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const bulkheadKey = "users.local"
+
+// acquireAsync queues a request for a slot and returns the channel that gets the result of acquire.
+func acquireAsync(t *testing.T, brt *BulkheadRoundTripper, ctx context.Context, queued int) <-chan error {
+	t.Helper()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- brt.acquire(ctx, bulkheadKey)
+	}()
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		brt.mu.Lock()
+		length := brt.compartment(bulkheadKey).waiters.Len()
+		brt.mu.Unlock()
+
+		if length == queued {
+			return result
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued, want %d", length, queued)
+		}
+	}
+}
+
+func bulkheadState(brt *BulkheadRoundTripper) (inFlight, queued int) {
+	brt.mu.Lock()
+	defer brt.mu.Unlock()
+
+	c := brt.compartment(bulkheadKey)
+	return c.inFlight, c.waiters.Len()
+}
+
+func TestBulkheadQueueFull(t *testing.T) {
+	brt := NewBulkheadRoundTripper(http.DefaultTransport, 1, 2)
+
+	if err := brt.acquire(context.Background(), bulkheadKey); err != nil {
+		t.Fatal(err)
+	}
+	first := acquireAsync(t, brt, context.Background(), 1)
+	second := acquireAsync(t, brt, context.Background(), 2)
+
+	var fullErr *BulkheadFullError
+	err := brt.acquire(context.Background(), bulkheadKey)
+	if !errors.As(err, &fullErr) || fullErr.QueueTimeout || fullErr.Limit != 1 {
+		t.Fatalf("error = %v, want BulkheadFullError for the full queue", err)
+	}
+
+	// slots are handed over in the order the requests were queued
+	brt.release(bulkheadKey, 0, false)
+	select {
+	case err := <-first:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the first queued request did not get the slot")
+	}
+	select {
+	case <-second:
+		t.Fatal("the second queued request got a slot before it was free")
+	default:
+	}
+
+	brt.release(bulkheadKey, 0, false)
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+
+	if inFlight, queued := bulkheadState(brt); inFlight != 1 || queued != 0 {
+		t.Fatalf("in flight %d, queued %d, want 1 and 0", inFlight, queued)
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	brt := NewBulkheadRoundTripper(http.DefaultTransport, 1, 1)
+	brt.QueueTimeout = 20 * time.Millisecond
+
+	if err := brt.acquire(context.Background(), bulkheadKey); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err := brt.acquire(context.Background(), bulkheadKey)
+
+	var fullErr *BulkheadFullError
+	if !errors.As(err, &fullErr) || !fullErr.QueueTimeout {
+		t.Fatalf("error = %v, want BulkheadFullError for the queue timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < brt.QueueTimeout {
+		t.Fatalf("gave up after %s, want after the queue timeout %s", elapsed, brt.QueueTimeout)
+	}
+	if inFlight, queued := bulkheadState(brt); inFlight != 1 || queued != 0 {
+		t.Fatalf("in flight %d, queued %d, want 1 and 0", inFlight, queued)
+	}
+}
+
+func TestBulkheadCanceledAfterHandoff(t *testing.T) {
+	brt := NewBulkheadRoundTripper(http.DefaultTransport, 1, 2)
+
+	if err := brt.acquire(context.Background(), bulkheadKey); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	canceled := acquireAsync(t, brt, ctx, 1)
+	next := acquireAsync(t, brt, context.Background(), 2)
+
+	// the request gives up and waits for the lock while the slot is handed to it
+	brt.mu.Lock()
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	c := brt.compartment(bulkheadKey)
+	ready := c.waiters.Remove(c.waiters.Front()).(chan struct{})
+	ready <- struct{}{}
+	brt.mu.Unlock()
+
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want the context error", err)
+	}
+
+	// the slot is passed on instead of being lost
+	select {
+	case err := <-next:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the slot of the canceled request was not passed on")
+	}
+
+	if inFlight, queued := bulkheadState(brt); inFlight != 1 || queued != 0 {
+		t.Fatalf("in flight %d, queued %d, want 1 and 0", inFlight, queued)
+	}
+}
+
+func TestBulkheadAdaptiveLimit(t *testing.T) {
+	brt := NewBulkheadRoundTripper(http.DefaultTransport, 4, 0)
+	brt.Adaptive = true
+	brt.BackoffRatio = 0.5
+	brt.LatencyThreshold = 100 * time.Millisecond
+
+	steps := []struct {
+		name       string
+		latency    time.Duration
+		overloaded bool
+		wantLimit  int
+	}{
+		{name: "slow", latency: 200 * time.Millisecond, wantLimit: 2},
+		{name: "overloaded", latency: time.Millisecond, overloaded: true, wantLimit: 1},
+		{name: "slow at the minimum", latency: 200 * time.Millisecond, wantLimit: 1},
+		// the limit grows by 1/limit per fast request, about one per limit of them
+		{name: "fast", latency: time.Millisecond, wantLimit: 2},
+		{name: "fast", latency: time.Millisecond, wantLimit: 2},
+		{name: "fast", latency: time.Millisecond, wantLimit: 2},
+		{name: "fast", latency: time.Millisecond, wantLimit: 3},
+		{name: "fast", latency: time.Millisecond, wantLimit: 3},
+		{name: "fast", latency: time.Millisecond, wantLimit: 3},
+		{name: "fast", latency: time.Millisecond, wantLimit: 4},
+		{name: "fast at the maximum", latency: time.Millisecond, wantLimit: 4},
+	}
+
+	for i, step := range steps {
+		if err := brt.acquire(context.Background(), bulkheadKey); err != nil {
+			t.Fatal(err)
+		}
+		brt.release(bulkheadKey, step.latency, step.overloaded)
+
+		if limit := brt.Limit(bulkheadKey); limit != step.wantLimit {
+			t.Fatalf("step %d (%s): limit = %d, want %d", i, step.name, limit, step.wantLimit)
+		}
+	}
+}
+
+// multipartWriters counts the goroutines that write a MultipartBody.
+func multipartWriters() int {
+	stacks := make([]byte, 1<<20)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	return strings.Count(string(stacks), "(*multipartBody).Encode.func")
+}
+
+func TestBulkheadRejectedMultipartBody(t *testing.T) {
+	brt := NewBulkheadRoundTripper(http.DefaultTransport, 1, 0)
+	if err := brt.acquire(context.Background(), bulkheadKey); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New("http://"+bulkheadKey, WithTransport(brt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := multipartWriters()
+	body := MultipartBody(map[string]string{"title": "report"}, MultipartFile{FieldName: "file", FileName: "report.csv", Reader: strings.NewReader("a,b")})
+	_, err = c.Do(context.Background(), RequestSpec{Method: http.MethodPost, Endpoint: "/reports", Body: body})
+
+	var fullErr *BulkheadFullError
+	if !errors.As(err, &fullErr) {
+		t.Fatalf("Do() error = %v, want BulkheadFullError", err)
+	}
+
+	for deadline := time.Now().Add(time.Second); multipartWriters() > before; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the writer of the rejected multipart body is still blocked")
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CacheStatusHeader is set by CachingRoundTripper on every response of a cacheable request,
+	// so that the logging and metrics round trippers can see whether it came from the cache.
+	CacheStatusHeader = "X-Cache-Status"
+
+	CacheHit         = "HIT"
+	CacheMiss        = "MISS"
+	CacheStale       = "STALE"
+	CacheRevalidated = "REVALIDATED"
+
+	defaultCacheMaxEntrySize      = 1 << 20
+	defaultCacheRevalidateTimeout = 30 * time.Second
+	maxHeuristicFreshness         = 24 * time.Hour
+)
+
+// cacheableStatusCodes are heuristically cacheable by RFC 9110, section 15.1.
+var cacheableStatusCodes = []int{200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501}
+
+// CachingRoundTripper is a http.RoundTripper that implements a private HTTP cache (RFC 9111) for GET requests.
+// Fresh responses (max-age, Expires or a heuristic based on Last-Modified) are served from Storage,
+// stale ones are revalidated with If-None-Match/If-Modified-Since and a 304 response refreshes the stored one.
+// Within stale-while-revalidate the stale response is served while it is revalidated in the background.
+// Responses larger than MaxEntrySize are not stored. Successful unsafe requests invalidate the stored responses of the URL, every variant included.
+//
+// A client is often shared by the requests of many users, so the cache behaves as a shared one (RFC 9111,
+// section 3.5): responses to requests with Authorization or Cookie are stored only when the response allows
+// it with public, s-maxage or must-revalidate, private responses are not stored and s-maxage takes precedence
+// over max-age. Responses with Vary are stored per variant of the listed headers.
+//
+// Every response of a cacheable request gets the CacheStatusHeader header.
+type CachingRoundTripper struct {
+	Proxied           http.RoundTripper
+	Storage           CacheStorage
+	MaxEntrySize      int64
+	RevalidateTimeout time.Duration
+
+	// mu guards revalidating and the updates of Vary indexes
+	mu           sync.Mutex
+	revalidating map[string]bool
+}
+
+func NewCachingRoundTripper(proxied http.RoundTripper, storage CacheStorage) *CachingRoundTripper {
+	return &CachingRoundTripper{
+		Proxied:           proxied,
+		Storage:           storage,
+		MaxEntrySize:      defaultCacheMaxEntrySize,
+		RevalidateTimeout: defaultCacheRevalidateTimeout,
+		revalidating:      make(map[string]bool),
+	}
+}
+
+func (crt *CachingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != "" {
+		resp, err := crt.Proxied.RoundTrip(req)
+		if err == nil && req.Method != http.MethodHead && resp.StatusCode < 400 {
+			crt.invalidate(req.URL.String())
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok || req.Header.Get("Range") != "" {
+		return crt.Proxied.RoundTrip(req)
+	}
+
+	key, entry, ok := crt.lookup(req)
+	if !ok || !varyMatches(entry, req) {
+		return crt.fetch(req)
+	}
+
+	now := time.Now()
+	age := entry.age(now)
+	lifetime := entry.freshnessLifetime()
+	respCC := parseCacheControl(entry.Header)
+
+	_, reqNoCache := reqCC["no-cache"]
+	_, respNoCache := respCC["no-cache"]
+	_, mustRevalidate := respCC["must-revalidate"]
+	mustCheck := reqNoCache || respNoCache || req.Header.Get("Pragma") == "no-cache"
+	if maxAge, ok := cacheControlSeconds(reqCC, "max-age"); ok && age > maxAge {
+		mustCheck = true
+	}
+
+	if !mustCheck && age < lifetime {
+		return entry.response(req, age, CacheHit), nil
+	}
+
+	if swr, ok := cacheControlSeconds(respCC, "stale-while-revalidate"); ok && !mustCheck && !mustRevalidate && age < lifetime+swr {
+		crt.revalidateInBackground(req, key, entry)
+		return entry.response(req, age, CacheStale), nil
+	}
+
+	return crt.revalidate(req, key, entry)
+}
+
+// lookup returns the stored response for the request and its storage key. The key of a URL whose responses
+// vary holds the Vary index, the responses are stored under variantKey.
+func (crt *CachingRoundTripper) lookup(req *http.Request) (string, *CacheEntry, bool) {
+	key := req.URL.String()
+
+	entry, ok := crt.Storage.Get(key)
+	if ok && entry.isVaryIndex() {
+		key = variantKey(key, entry, req)
+		entry, ok = crt.Storage.Get(key)
+	}
+
+	return key, entry, ok
+}
+
+// fetch sends the request and stores the response once its body is read to the end.
+func (crt *CachingRoundTripper) fetch(req *http.Request) (*http.Response, error) {
+	requestTime := time.Now()
+	resp, err := crt.Proxied.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	crt.storeOnRead(req, resp, requestTime)
+	resp.Header.Set(CacheStatusHeader, CacheMiss)
+
+	return resp, nil
+}
+
+func (crt *CachingRoundTripper) revalidate(req *http.Request, key string, entry *CacheEntry) (*http.Response, error) {
+	condReq := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		condReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		condReq.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := time.Now()
+	resp, err := crt.Proxied.RoundTrip(condReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusNotModified {
+		crt.storeOnRead(req, resp, requestTime)
+		resp.Header.Set(CacheStatusHeader, CacheMiss)
+		return resp, nil
+	}
+
+	drainBody(resp.Body)
+
+	updated := entry.refresh(resp.Header, requestTime, time.Now())
+	crt.Storage.Set(key, updated)
+
+	return updated.response(req, updated.age(time.Now()), CacheRevalidated), nil
+}
+
+func (crt *CachingRoundTripper) revalidateInBackground(req *http.Request, key string, entry *CacheEntry) {
+	crt.mu.Lock()
+	if crt.revalidating == nil {
+		crt.revalidating = make(map[string]bool)
+	}
+	if crt.revalidating[key] {
+		crt.mu.Unlock()
+		return
+	}
+	crt.revalidating[key] = true
+	crt.mu.Unlock()
+
+	// the caller gets the stale response right away, so its context must not cancel the revalidation
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), crt.RevalidateTimeout)
+	bgReq := req.Clone(ctx)
+
+	go func() {
+		defer func() {
+			cancel()
+
+			crt.mu.Lock()
+			delete(crt.revalidating, key)
+			crt.mu.Unlock()
+		}()
+
+		resp, err := crt.revalidate(bgReq, key, entry)
+		if err != nil {
+			return
+		}
+
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+}
+
+func (crt *CachingRoundTripper) storeOnRead(req *http.Request, resp *http.Response, requestTime time.Time) {
+	if !isStorable(req, resp) {
+		return
+	}
+
+	responseTime := time.Now()
+	header := resp.Header.Clone()
+
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		limit:      crt.MaxEntrySize,
+		onComplete: func(body []byte) {
+			crt.store(req, &CacheEntry{
+				StatusCode:    resp.StatusCode,
+				Header:        header,
+				Body:          body,
+				RequestHeader: varyRequestHeader(header, req),
+				RequestTime:   requestTime,
+				ResponseTime:  responseTime,
+			})
+		},
+	}
+}
+
+// store saves the entry under the URL, or under its variant key listed in the Vary index of the URL.
+func (crt *CachingRoundTripper) store(req *http.Request, entry *CacheEntry) {
+	key := req.URL.String()
+
+	fields := varyFields(entry.Header)
+	if len(fields) == 0 {
+		crt.Storage.Set(key, entry)
+		return
+	}
+
+	// concurrent responses of other variants must not lose each other's key in the index
+	crt.mu.Lock()
+	defer crt.mu.Unlock()
+
+	index, ok := crt.Storage.Get(key)
+	if !ok || !index.isVaryIndex() || !slices.Equal(varyFields(index.Header), fields) {
+		crt.deleteVariants(index)
+		index = &CacheEntry{
+			Header:       http.Header{"Vary": {strings.Join(fields, ", ")}},
+			ResponseTime: time.Now(),
+		}
+	}
+
+	variant := variantKey(key, index, req)
+	if !slices.Contains(index.Variants, variant) {
+		updated := *index
+		updated.Variants = append(slices.Clone(index.Variants), variant)
+		crt.Storage.Set(key, &updated)
+	}
+	crt.Storage.Set(variant, entry)
+}
+
+// invalidate deletes the stored response of the URL, or its Vary index and every variant listed in it.
+func (crt *CachingRoundTripper) invalidate(key string) {
+	crt.mu.Lock()
+	defer crt.mu.Unlock()
+
+	if index, ok := crt.Storage.Get(key); ok {
+		crt.deleteVariants(index)
+	}
+	crt.Storage.Delete(key)
+}
+
+// deleteVariants must be called with crt.mu held, index may be nil or a stored response.
+func (crt *CachingRoundTripper) deleteVariants(index *CacheEntry) {
+	if index == nil || !index.isVaryIndex() {
+		return
+	}
+
+	for _, variant := range index.Variants {
+		crt.Storage.Delete(variant)
+	}
+}
+
+func isStorable(req *http.Request, resp *http.Response) bool {
+	if !slices.Contains(cacheableStatusCodes, resp.StatusCode) {
+		return false
+	}
+
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok {
+		return false
+	}
+	if resp.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	// a response to one user must not be served to another (RFC 9111, section 3.5)
+	if req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != "" {
+		_, public := cc["public"]
+		_, sMaxAge := cc["s-maxage"]
+		_, mustRevalidate := cc["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return false
+		}
+	}
+
+	_, hasMaxAge := cc["max-age"]
+	_, hasSMaxAge := cc["s-maxage"]
+	_, hasNoCache := cc["no-cache"]
+	return hasMaxAge || hasSMaxAge || hasNoCache ||
+		resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// age is the current age of the stored response (RFC 9111, section 4.2.3).
+func (e *CacheEntry) age(now time.Time) time.Duration {
+	apparentAge := time.Duration(0)
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		apparentAge = max(e.ResponseTime.Sub(date), 0)
+	}
+
+	ageValue := time.Duration(0)
+	if seconds, err := strconv.Atoi(e.Header.Get("Age")); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+	return max(apparentAge, correctedAge) + now.Sub(e.ResponseTime)
+}
+
+// freshnessLifetime is described in RFC 9111, section 4.2.1.
+func (e *CacheEntry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if sMaxAge, ok := cacheControlSeconds(cc, "s-maxage"); ok {
+		return sMaxAge
+	}
+	if maxAge, ok := cacheControlSeconds(cc, "max-age"); ok {
+		return maxAge
+	}
+
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.ResponseTime
+	}
+
+	if expiresValue := e.Header.Get("Expires"); expiresValue != "" {
+		expires, err := http.ParseTime(expiresValue)
+		if err != nil {
+			return 0
+		}
+		return max(expires.Sub(date), 0)
+	}
+
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil {
+		return min(max(date.Sub(lastModified)/10, 0), maxHeuristicFreshness)
+	}
+
+	return 0
+}
+
+// refresh returns a copy of the entry with the headers of a 304 response (RFC 9111, section 3.2).
+func (e *CacheEntry) refresh(header http.Header, requestTime, responseTime time.Time) *CacheEntry {
+	updated := *e
+	updated.Header = e.Header.Clone()
+	for key, values := range header {
+		if key == "Content-Length" {
+			continue
+		}
+		updated.Header[key] = values
+	}
+	updated.RequestTime = requestTime
+	updated.ResponseTime = responseTime
+
+	return &updated
+}
+
+func (e *CacheEntry) response(req *http.Request, age time.Duration, cacheStatus string) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	header.Set(CacheStatusHeader, cacheStatus)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// isVaryIndex reports whether the entry is the list of Vary fields stored under the URL of varying responses.
+func (e *CacheEntry) isVaryIndex() bool {
+	return e.StatusCode == 0
+}
+
+// variantKey is the storage key of the response for the request's values of the Vary fields. The time
+// the index was created is part of the key, so variants of an invalidated index are never found again.
+func variantKey(key string, index *CacheEntry, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	b.WriteString("\x00")
+	b.WriteString(strconv.FormatInt(index.ResponseTime.UnixNano(), 10))
+	for _, field := range varyFields(index.Header) {
+		b.WriteString("\x00")
+		b.WriteString(field)
+		b.WriteString(":")
+		b.WriteString(strings.Join(req.Header.Values(field), ","))
+	}
+
+	return b.String()
+}
+
+func varyRequestHeader(header http.Header, req *http.Request) http.Header {
+	fields := varyFields(header)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	reqHeader := make(http.Header, len(fields))
+	for _, field := range fields {
+		reqHeader[field] = req.Header.Values(field)
+	}
+
+	return reqHeader
+}
+
+func varyMatches(entry *CacheEntry, req *http.Request) bool {
+	for _, field := range varyFields(entry.Header) {
+		if !slices.Equal(entry.RequestHeader.Values(field), req.Header.Values(field)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func varyFields(header http.Header) []string {
+	var fields []string
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+
+	return fields
+}
+
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+
+	return directives
+}
+
+func cacheControlSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// recordingBody keeps a copy of the body while it is read and calls onComplete with it on EOF.
+// Bodies larger than limit are not kept.
+type recordingBody struct {
+	io.ReadCloser
+	buf        bytes.Buffer
+	limit      int64
+	overflow   bool
+	done       bool
+	onComplete func(body []byte)
+}
+
+func (rb *recordingBody) Read(p []byte) (int, error) {
+	n, err := rb.ReadCloser.Read(p)
+
+	if !rb.overflow && n > 0 {
+		if int64(rb.buf.Len()+n) > rb.limit {
+			rb.overflow = true
+			rb.buf = bytes.Buffer{}
+		} else {
+			rb.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF && !rb.overflow && !rb.done {
+		rb.done = true
+		rb.onComplete(bytes.Clone(rb.buf.Bytes()))
+	}
+
+	return n, err
+}
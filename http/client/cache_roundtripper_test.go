@@ -0,0 +1,273 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachingRoundTripperCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		header       string
+		value        string
+		wantUpstream int32
+	}{
+		{name: "anonymous", cacheControl: "max-age=60", wantUpstream: 1},
+		{name: "authorization", cacheControl: "max-age=60", header: "Authorization", value: "Bearer a", wantUpstream: 2},
+		{name: "cookie", cacheControl: "max-age=60", header: "Cookie", value: "session=a", wantUpstream: 2},
+		{name: "authorization with public", cacheControl: "public, max-age=60", header: "Authorization", value: "Bearer a", wantUpstream: 1},
+		{name: "authorization with s-maxage", cacheControl: "s-maxage=60", header: "Authorization", value: "Bearer a", wantUpstream: 1},
+		{name: "private", cacheControl: "private, max-age=60", wantUpstream: 2},
+		{name: "authorization with must-revalidate", cacheControl: "max-age=60, must-revalidate", header: "Authorization", value: "Bearer a", wantUpstream: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstream atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream.Add(1)
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				_, _ = io.WriteString(w, "data of "+r.Header.Get(tt.header))
+			}))
+			defer server.Close()
+
+			httpClient := &http.Client{Transport: NewCachingRoundTripper(http.DefaultTransport, NewLRUCache(1<<20))}
+
+			// the second request comes from another user
+			for _, value := range []string{tt.value, tt.value + "-other"} {
+				req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+				if tt.header != "" {
+					req.Header.Set(tt.header, value)
+				}
+				readResponse(t, httpClient, req)
+			}
+
+			if got := upstream.Load(); got != tt.wantUpstream {
+				t.Fatalf("upstream requests = %d, want %d", got, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestCachingRoundTripperVary(t *testing.T) {
+	var upstream atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			upstream.Add(1)
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = io.WriteString(w, "text in "+r.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: NewCachingRoundTripper(http.DefaultTransport, NewLRUCache(1<<20))}
+
+	get := func(language string) string {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Accept-Language", language)
+		return readResponse(t, httpClient, req)
+	}
+
+	for _, language := range []string{"en", "de", "en", "de", "en"} {
+		if got, want := get(language), "text in "+language; got != want {
+			t.Fatalf("body = %q, want %q", got, want)
+		}
+	}
+	if got := upstream.Load(); got != 2 {
+		t.Fatalf("upstream requests = %d, want 2 (one per variant)", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	readResponse(t, httpClient, req)
+
+	get("en")
+	get("de")
+	if got := upstream.Load(); got != 4 {
+		t.Fatalf("upstream requests after invalidation = %d, want 4", got)
+	}
+}
+
+func TestCachingRoundTripperInvalidateVariants(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = io.WriteString(w, "text in "+r.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+
+	storage := NewLRUCache(1 << 20)
+	httpClient := &http.Client{Transport: NewCachingRoundTripper(http.DefaultTransport, storage)}
+
+	for _, language := range []string{"en", "de", "fr"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Accept-Language", language)
+		readResponse(t, httpClient, req)
+	}
+	if got := len(storage.items); got != 4 {
+		t.Fatalf("stored entries = %d, want the index and 3 variants", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL, nil)
+	readResponse(t, httpClient, req)
+	if got := len(storage.items); got != 0 || storage.size != 0 {
+		t.Fatalf("stored entries after invalidation = %d of %d bytes, want none", got, storage.size)
+	}
+}
+
+// cacheGet sends a GET request and returns the body and the cache status of the response.
+func cacheGet(t *testing.T, httpClient *http.Client, url string) (body, cacheStatus string) {
+	t.Helper()
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data), resp.Header.Get(CacheStatusHeader)
+}
+
+func TestCachingRoundTripperFresh(t *testing.T) {
+	var upstream atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		upstream.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "users")
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: NewCachingRoundTripper(http.DefaultTransport, NewLRUCache(1<<20))}
+
+	for i, want := range []string{CacheMiss, CacheHit, CacheHit} {
+		if body, status := cacheGet(t, httpClient, server.URL); body != "users" || status != want {
+			t.Fatalf("request %d: body %q with cache status %q, want %q", i, body, status, want)
+		}
+	}
+	if got := upstream.Load(); got != 1 {
+		t.Fatalf("upstream requests = %d, want 1", got)
+	}
+}
+
+func TestCachingRoundTripperRevalidate(t *testing.T) {
+	var upstream atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if upstream.Add(1) == 1 {
+			w.Header().Set("Cache-Control", "max-age=0")
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("X-Version", "1")
+			_, _ = io.WriteString(w, "users")
+			return
+		}
+
+		if r.Header.Get("If-None-Match") != `"v1"` {
+			t.Errorf("If-None-Match = %q, want the stored ETag", r.Header.Get("If-None-Match"))
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Version", "2")
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: NewCachingRoundTripper(http.DefaultTransport, NewLRUCache(1<<20))}
+
+	cacheGet(t, httpClient, server.URL)
+
+	resp, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "users" || resp.Header.Get(CacheStatusHeader) != CacheRevalidated {
+		t.Fatalf("response %d %q with cache status %q, want the stored one revalidated", resp.StatusCode, body, resp.Header.Get(CacheStatusHeader))
+	}
+	// the headers of the 304 response replace the stored ones, the others are kept
+	if resp.Header.Get("X-Version") != "2" || resp.Header.Get("ETag") != `"v1"` {
+		t.Fatalf("headers = %v, want X-Version from the 304 response and the stored ETag", resp.Header)
+	}
+
+	// the new max-age makes the stored response fresh
+	if body, status := cacheGet(t, httpClient, server.URL); body != "users" || status != CacheHit {
+		t.Fatalf("body %q with cache status %q, want a hit", body, status)
+	}
+	if got := upstream.Load(); got != 2 {
+		t.Fatalf("upstream requests = %d, want 2", got)
+	}
+}
+
+func TestCachingRoundTripperStaleWhileRevalidate(t *testing.T) {
+	var upstream atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if upstream.Add(1) == 1 {
+			w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+			_, _ = io.WriteString(w, "v1")
+			return
+		}
+
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "v2")
+	}))
+	defer server.Close()
+
+	httpClient := &http.Client{Transport: NewCachingRoundTripper(http.DefaultTransport, NewLRUCache(1<<20))}
+
+	cacheGet(t, httpClient, server.URL)
+
+	// served stale right away, one background revalidation at a time
+	for range 2 {
+		if body, status := cacheGet(t, httpClient, server.URL); body != "v1" || status != CacheStale {
+			t.Fatalf("body %q with cache status %q, want the stale v1", body, status)
+		}
+	}
+	close(release)
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		body, status := cacheGet(t, httpClient, server.URL)
+		if body == "v2" && status == CacheHit {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("body %q with cache status %q, want v2 stored by the background revalidation", body, status)
+		}
+	}
+	if got := upstream.Load(); got != 2 {
+		t.Fatalf("upstream requests = %d, want 2", got)
+	}
+}
+
+func readResponse(t *testing.T, httpClient *http.Client, req *http.Request) string {
+	t.Helper()
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheEntry is a response stored by CachingRoundTripper. An entry with StatusCode 0 is not a response
+// but the list of Vary fields of a URL whose responses are stored per variant.
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// RequestHeader keeps the request headers listed in the Vary response header.
+	RequestHeader http.Header
+	RequestTime   time.Time
+	ResponseTime  time.Time
+	// Variants lists the storage keys of the responses of a Vary index, so that they are deleted with it.
+	Variants []string
+}
+
+// Size is the approximate number of bytes the entry takes.
+func (e *CacheEntry) Size() int64 {
+	size := int64(len(e.Body))
+	for _, h := range []http.Header{e.Header, e.RequestHeader} {
+		for key, values := range h {
+			size += int64(len(key))
+			for _, value := range values {
+				size += int64(len(value))
+			}
+		}
+	}
+	for _, variant := range e.Variants {
+		size += int64(len(variant))
+	}
+
+	return size
+}
+
+// CacheStorage stores responses for CachingRoundTripper, it must be safe for concurrent use.
+type CacheStorage interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// LRUCache is an in-memory CacheStorage that evicts the least recently used entries
+// when the total size exceeds maxBytes.
+type LRUCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+func NewLRUCache(maxBytes int64) *LRUCache {
+	return &LRUCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*lruItem).entry, true
+}
+
+func (c *LRUCache) Set(key string, entry *CacheEntry) {
+	size := entry.Size()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+
+	if size > c.maxBytes {
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&lruItem{key: key, entry: entry, size: size})
+	c.size += size
+
+	for c.size > c.maxBytes {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// removeElement must be called with c.mu held.
+func (c *LRUCache) removeElement(elem *list.Element) {
+	item := c.ll.Remove(elem).(*lruItem)
+	delete(c.items, item.key)
+	c.size -= item.size
+}
@@ -0,0 +1,48 @@
+package client
+
+import "testing"
+
+func TestLRUCacheEviction(t *testing.T) {
+	entry := func(body string) *CacheEntry {
+		return &CacheEntry{StatusCode: 200, Body: []byte(body)}
+	}
+
+	cache := NewLRUCache(10)
+	cache.Set("a", entry("aaaa"))
+	cache.Set("b", entry("bbbb"))
+
+	// a is used more recently than b, so b is evicted to make room for c
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("Get(a) = false, want the stored entry")
+	}
+	cache.Set("c", entry("cccc"))
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := cache.Get(key); ok != want {
+			t.Fatalf("Get(%s) = %v, want %v", key, ok, want)
+		}
+	}
+	if cache.size != 8 {
+		t.Fatalf("size = %d, want 8", cache.size)
+	}
+
+	// replacing an entry frees its old size
+	cache.Set("a", entry("aa"))
+	if cache.size != 6 {
+		t.Fatalf("size after replacing a = %d, want 6", cache.size)
+	}
+
+	// an entry over the limit is not stored and does not evict the others
+	cache.Set("d", entry("ddddddddddd"))
+	if _, ok := cache.Get("d"); ok {
+		t.Fatal("Get(d) = true, want an entry over the limit not stored")
+	}
+	if len(cache.items) != 2 {
+		t.Fatalf("stored entries = %d, want 2", len(cache.items))
+	}
+
+	cache.Delete("a")
+	if _, ok := cache.Get("a"); ok || cache.size != 4 {
+		t.Fatalf("after Delete(a): stored %v, size %d, want removed and size 4", ok, cache.size)
+	}
+}
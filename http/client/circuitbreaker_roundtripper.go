@@ -0,0 +1,299 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerSuccessThreshold = 1
+	defaultBreakerHalfOpenRequests = 1
+	defaultBreakerCoolDown         = 30 * time.Second
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerRoundTripper is a http.RoundTripper that stops sending requests to a host
+// after FailureThreshold consecutive failures. While the circuit is open requests fail fast
+// with CircuitOpenError. After CoolDown the circuit becomes half-open and lets HalfOpenRequests
+// probe requests through: SuccessThreshold successful probes close it, any failure opens it again.
+//
+// A failure is a transport error or a response whose status class (e.g. 5 for 5xx) is listed in FailureStatusClasses.
+type CircuitBreakerRoundTripper struct {
+	Proxied              http.RoundTripper
+	FailureThreshold     int
+	SuccessThreshold     int
+	HalfOpenRequests     int
+	CoolDown             time.Duration
+	FailureStatusClasses []int
+	OnStateChange        func(host string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+
+	stateGauge      *prometheus.GaugeVec
+	rejectedCounter *prometheus.CounterVec
+}
+
+type circuit struct {
+	state     CircuitState
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+	// generation changes with every state change, results of requests admitted in an older one are ignored
+	generation uint64
+}
+
+func NewCircuitBreakerRoundTripper(proxied http.RoundTripper, failureThreshold int, coolDown time.Duration) *CircuitBreakerRoundTripper {
+	if failureThreshold <= 0 {
+		failureThreshold = defaultBreakerFailureThreshold
+	}
+	if coolDown <= 0 {
+		coolDown = defaultBreakerCoolDown
+	}
+
+	cbrt := &CircuitBreakerRoundTripper{
+		Proxied:              proxied,
+		FailureThreshold:     failureThreshold,
+		SuccessThreshold:     defaultBreakerSuccessThreshold,
+		HalfOpenRequests:     defaultBreakerHalfOpenRequests,
+		CoolDown:             coolDown,
+		FailureStatusClasses: []int{5},
+		circuits:             make(map[string]*circuit),
+	}
+	cbrt.initMetrics(nil)
+
+	return cbrt
+}
+
+func (cbrt *CircuitBreakerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	generation, err := cbrt.allow(host)
+	if err != nil {
+		cbrt.rejectedCounter.WithLabelValues(host).Inc()
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	resp, err := cbrt.Proxied.RoundTrip(req)
+
+	switch {
+	case err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) && req.Context().Err() != nil:
+		// the caller gave up, the host is not to blame
+		cbrt.release(host, generation)
+	case err != nil || cbrt.isFailureStatus(resp.StatusCode):
+		cbrt.onFailure(host, generation)
+	default:
+		cbrt.onSuccess(host, generation)
+	}
+
+	return resp, err
+}
+
+// State returns the current state of the circuit for the host.
+func (cbrt *CircuitBreakerRoundTripper) State(host string) CircuitState {
+	cbrt.mu.Lock()
+	defer cbrt.mu.Unlock()
+
+	c, ok := cbrt.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+
+	return c.state
+}
+
+// RegisterMetrics registers the metrics in registerer with the client label set to name, before the first request.
+func (cbrt *CircuitBreakerRoundTripper) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	cbrt.initMetrics(prometheus.Labels{"client": name})
+	cbrt.stateGauge = metrics.MustRegisterOrExisting(registerer, cbrt.stateGauge)
+	cbrt.rejectedCounter = metrics.MustRegisterOrExisting(registerer, cbrt.rejectedCounter)
+}
+
+func (cbrt *CircuitBreakerRoundTripper) initMetrics(constLabels prometheus.Labels) {
+	cbrt.stateGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "http_client_circuit_breaker_state",
+			Help:        "State of the circuit breaker per host: 0 - closed, 1 - open, 2 - half-open.",
+			ConstLabels: constLabels,
+		},
+		[]string{"host"},
+	)
+	cbrt.rejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "http_client_circuit_breaker_rejected_total",
+			Help:        "Total number of requests rejected by an open circuit breaker.",
+			ConstLabels: constLabels,
+		},
+		[]string{"host"},
+	)
+}
+
+// allow returns the generation of the circuit the request is admitted in.
+func (cbrt *CircuitBreakerRoundTripper) allow(host string) (uint64, error) {
+	cbrt.mu.Lock()
+	c := cbrt.circuit(host)
+
+	var err error
+	var transition *stateTransition
+	if c.state == CircuitOpen {
+		if retryAfter := cbrt.CoolDown - time.Since(c.openedAt); retryAfter > 0 {
+			err = &CircuitOpenError{Host: host, RetryAfter: retryAfter}
+		} else {
+			transition = cbrt.setState(host, c, CircuitHalfOpen)
+		}
+	}
+
+	if err == nil && c.state == CircuitHalfOpen {
+		if c.probes >= max(cbrt.HalfOpenRequests, 1) {
+			err = &CircuitOpenError{Host: host, HalfOpen: true}
+		} else {
+			c.probes++
+		}
+	}
+	generation := c.generation
+	cbrt.mu.Unlock()
+
+	cbrt.notify(transition)
+	return generation, err
+}
+
+func (cbrt *CircuitBreakerRoundTripper) onSuccess(host string, generation uint64) {
+	cbrt.mu.Lock()
+	c := cbrt.circuit(host)
+	if c.generation != generation {
+		cbrt.mu.Unlock()
+		return
+	}
+	c.failures = 0
+
+	var transition *stateTransition
+	if c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+		c.successes++
+		if c.successes >= max(cbrt.SuccessThreshold, 1) {
+			transition = cbrt.setState(host, c, CircuitClosed)
+		}
+	}
+	cbrt.mu.Unlock()
+
+	cbrt.notify(transition)
+}
+
+func (cbrt *CircuitBreakerRoundTripper) onFailure(host string, generation uint64) {
+	cbrt.mu.Lock()
+	c := cbrt.circuit(host)
+	if c.generation != generation {
+		cbrt.mu.Unlock()
+		return
+	}
+
+	var transition *stateTransition
+	switch c.state {
+	case CircuitHalfOpen:
+		transition = cbrt.setState(host, c, CircuitOpen)
+	case CircuitClosed:
+		c.failures++
+		if c.failures >= cbrt.FailureThreshold {
+			transition = cbrt.setState(host, c, CircuitOpen)
+		}
+	}
+	cbrt.mu.Unlock()
+
+	cbrt.notify(transition)
+}
+
+func (cbrt *CircuitBreakerRoundTripper) release(host string, generation uint64) {
+	cbrt.mu.Lock()
+	defer cbrt.mu.Unlock()
+
+	c := cbrt.circuit(host)
+	if c.generation == generation && c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// circuit must be called with cbrt.mu held.
+func (cbrt *CircuitBreakerRoundTripper) circuit(host string) *circuit {
+	if cbrt.circuits == nil {
+		cbrt.circuits = make(map[string]*circuit)
+	}
+
+	c, ok := cbrt.circuits[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		cbrt.circuits[host] = c
+	}
+
+	return c
+}
+
+type stateTransition struct {
+	host     string
+	from, to CircuitState
+}
+
+// setState must be called with cbrt.mu held. The returned transition is passed
+// to notify after the lock is released so that OnStateChange may call State.
+func (cbrt *CircuitBreakerRoundTripper) setState(host string, c *circuit, state CircuitState) *stateTransition {
+	from := c.state
+
+	c.state = state
+	c.generation++
+	c.failures = 0
+	c.successes = 0
+	c.probes = 0
+	if state == CircuitOpen {
+		c.openedAt = time.Now()
+	}
+
+	cbrt.stateGauge.WithLabelValues(host).Set(float64(state))
+
+	if from == state {
+		return nil
+	}
+
+	return &stateTransition{host: host, from: from, to: state}
+}
+
+func (cbrt *CircuitBreakerRoundTripper) notify(transition *stateTransition) {
+	if transition == nil || cbrt.OnStateChange == nil {
+		return
+	}
+
+	cbrt.OnStateChange(transition.host, transition.from, transition.to)
+}
+
+func (cbrt *CircuitBreakerRoundTripper) isFailureStatus(code int) bool {
+	return slices.Contains(cbrt.FailureStatusClasses, code/100)
+}
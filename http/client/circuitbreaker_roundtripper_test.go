@@ -0,0 +1,231 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCircuitBreakerRegisterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	users := NewCircuitBreakerRoundTripper(http.DefaultTransport, 1, 0)
+	orders := NewCircuitBreakerRoundTripper(http.DefaultTransport, 1, 0)
+	ordersCopy := NewCircuitBreakerRoundTripper(http.DefaultTransport, 1, 0)
+
+	users.RegisterMetrics(registry, "users")
+	orders.RegisterMetrics(registry, "orders")
+	ordersCopy.RegisterMetrics(registry, "orders")
+
+	users.rejectedCounter.WithLabelValues("users.local").Inc()
+	orders.rejectedCounter.WithLabelValues("orders.local").Inc()
+	ordersCopy.rejectedCounter.WithLabelValues("orders.local").Inc()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejected := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "http_client_circuit_breaker_rejected_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "client" {
+					rejected[label.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+
+	if len(rejected) != 2 || rejected["users"] != 1 || rejected["orders"] != 2 {
+		t.Fatalf("rejected per client = %v, want users 1 and orders 2", rejected)
+	}
+}
+
+func TestCircuitBreakerStaleResults(t *testing.T) {
+	const host = "users.local"
+
+	tests := []struct {
+		name   string
+		report func(cbrt *CircuitBreakerRoundTripper, generation uint64)
+	}{
+		{name: "success", report: func(cbrt *CircuitBreakerRoundTripper, generation uint64) { cbrt.onSuccess(host, generation) }},
+		{name: "failure", report: func(cbrt *CircuitBreakerRoundTripper, generation uint64) { cbrt.onFailure(host, generation) }},
+		{name: "canceled", report: func(cbrt *CircuitBreakerRoundTripper, generation uint64) { cbrt.release(host, generation) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cbrt := NewCircuitBreakerRoundTripper(http.DefaultTransport, 1, time.Millisecond)
+
+			// a slow request admitted while the circuit is closed
+			stale, err := cbrt.allow(host)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failed, _ := cbrt.allow(host)
+			cbrt.onFailure(host, failed)
+			time.Sleep(2 * time.Millisecond)
+
+			probe, err := cbrt.allow(host)
+			if err != nil || cbrt.State(host) != CircuitHalfOpen {
+				t.Fatalf("probe: state %v, error %v, want half-open", cbrt.State(host), err)
+			}
+
+			tt.report(cbrt, stale)
+			if state := cbrt.State(host); state != CircuitHalfOpen {
+				t.Fatalf("state after a stale %s = %v, want half-open", tt.name, state)
+			}
+			// the probe slot is still taken by the probe
+			if _, err := cbrt.allow(host); err == nil {
+				t.Fatal("second probe admitted, want one probe at a time")
+			}
+
+			cbrt.onSuccess(host, probe)
+			if state := cbrt.State(host); state != CircuitClosed {
+				t.Fatalf("state after the probe = %v, want closed", state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const host = "users.local"
+
+	status := http.StatusInternalServerError
+	cbrt := NewCircuitBreakerRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	}), 2, 20*time.Millisecond)
+	cbrt.SuccessThreshold = 2
+
+	type transition struct{ from, to CircuitState }
+	var transitions []transition
+	cbrt.OnStateChange = func(changed string, from, to CircuitState) {
+		if changed != host {
+			t.Errorf("OnStateChange() host = %q, want %q", changed, host)
+		}
+		if cbrt.State(host) != to {
+			t.Errorf("State() in OnStateChange = %v, want %v", cbrt.State(host), to)
+		}
+		transitions = append(transitions, transition{from: from, to: to})
+	}
+
+	send := func() (*closeTrackingBody, error) {
+		body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+		req, err := http.NewRequest(http.MethodPost, "http://"+host+"/users", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := cbrt.RoundTrip(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return body, err
+	}
+	wantState := func(want CircuitState) {
+		t.Helper()
+		if state := cbrt.State(host); state != want {
+			t.Fatalf("State() = %v, want %v", state, want)
+		}
+	}
+
+	for range 2 {
+		if _, err := send(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantState(CircuitOpen)
+
+	body, err := send()
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.Host != host || openErr.HalfOpen || openErr.RetryAfter <= 0 {
+		t.Fatalf("RoundTrip() error = %v, want CircuitOpenError with RetryAfter", err)
+	}
+	if !body.closed {
+		t.Fatal("body of the rejected request was not closed")
+	}
+
+	// a failed probe opens the circuit again
+	time.Sleep(25 * time.Millisecond)
+	if _, err := send(); err != nil {
+		t.Fatal(err)
+	}
+	wantState(CircuitOpen)
+
+	time.Sleep(25 * time.Millisecond)
+	status = http.StatusOK
+	if _, err := send(); err != nil {
+		t.Fatal(err)
+	}
+	wantState(CircuitHalfOpen)
+	if _, err := send(); err != nil {
+		t.Fatal(err)
+	}
+	wantState(CircuitClosed)
+
+	want := []transition{
+		{from: CircuitClosed, to: CircuitOpen},
+		{from: CircuitOpen, to: CircuitHalfOpen},
+		{from: CircuitHalfOpen, to: CircuitOpen},
+		{from: CircuitOpen, to: CircuitHalfOpen},
+		{from: CircuitHalfOpen, to: CircuitClosed},
+	}
+	if !reflect.DeepEqual(transitions, want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeLimit(t *testing.T) {
+	const host = "users.local"
+
+	release := make(chan struct{})
+	admitted := make(chan struct{})
+	cbrt := NewCircuitBreakerRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		admitted <- struct{}{}
+		<-release
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}), 1, time.Millisecond)
+
+	generation, _ := cbrt.allow(host)
+	cbrt.onFailure(host, generation)
+	time.Sleep(2 * time.Millisecond)
+
+	probeDone := make(chan error)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+host+"/users", nil)
+		_, err := cbrt.RoundTrip(req)
+		probeDone <- err
+	}()
+	<-admitted
+
+	body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+	req, err := http.NewRequest(http.MethodPost, "http://"+host+"/users", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cbrt.RoundTrip(req)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || !openErr.HalfOpen {
+		t.Fatalf("RoundTrip() during the probe error = %v, want half-open CircuitOpenError", err)
+	}
+	if !body.closed {
+		t.Fatal("body of the rejected request was not closed")
+	}
+
+	close(release)
+	if err := <-probeDone; err != nil {
+		t.Fatal(err)
+	}
+	if state := cbrt.State(host); state != CircuitClosed {
+		t.Fatalf("State() after the probe = %v, want closed", state)
+	}
+}
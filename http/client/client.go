@@ -1,109 +1,104 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"errors"
-	"fmt"
 	"io"
 	"net/http"
-	"net/url"
-	"reflect"
 	"strings"
 	"time"
 )
 
+// maxErrorBodySize limits how much of an error response body is kept in ClientResponseNot200Error.
+const maxErrorBodySize = 1 << 20
+
 type Client struct {
 	httpClient *http.Client
-	baseURL    string
+	// streamClient shares the transport with httpClient but has no timeout,
+	// streams are bound only by the request context.
+	streamClient *http.Client
+	baseURL      string
+	headers      map[string]string
+	acceptStatus StatusAcceptor
+	balancer     *Balancer
 }
 
+// NewClient is a shortcut for New(baseURL, WithTimeout(timeout), WithTransport(transport)).
 func NewClient(baseURL string, timeout time.Duration, transport http.RoundTripper) *Client {
-	return &Client{
-		httpClient: &http.Client{
-			Timeout:   timeout,
-			Transport: transport,
-		},
-		baseURL: baseURL,
-	}
+	// New fails only on TLS and proxy options
+	client, _ := New(baseURL, WithTimeout(timeout), WithTransport(transport))
+	return client
 }
 
-func (c *Client) Get(ctx context.Context, endpoint string, in interface{}, headers map[string]string) (*http.Response, error) {
-	pathUrl, err := BuildURL(c.baseURL+endpoint, in)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pathUrl, nil)
-	if err != nil {
-		return nil, err
-	}
+// NewBalancedClient creates a client that sends requests to the endpoints of balancer,
+// the balancer is closed with the client. The client has no base URL: the endpoint of a request
+// is a path relative to the balancer endpoint URLs, e.g. "/users/{id}" with the endpoint
+// "http://10.0.0.1:8080/api" is sent to "http://10.0.0.1:8080/api/users/1".
+func NewBalancedClient(balancer *Balancer, timeout time.Duration) *Client {
+	client, _ := New("", WithTimeout(timeout), WithBalancer(balancer))
+	return client
+}
 
-	for key, value := range headers {
-		req.Header.Set(key, value)
+// SetAcceptStatus sets which response status codes are treated as success, by default any 2xx.
+// A single call can override it with ContextWithAcceptStatus.
+func (c *Client) SetAcceptStatus(accept StatusAcceptor) {
+	if accept == nil {
+		accept = Status2xx
 	}
 
-	return c.doRequest(req)
+	c.acceptStatus = accept
 }
 
-func (c *Client) Delete(ctx context.Context, endpoint string, in interface{}, headers map[string]string) (*http.Response, error) {
-	pathUrl, err := BuildURL(c.baseURL+endpoint, in)
-	if err != nil {
-		return nil, err
-	}
+// RequestSpec describes a request sent by Client.Do.
+type RequestSpec struct {
+	Method string
+	// Endpoint is appended to the client base URL unless it is an absolute URL, e.g. a link to the next page.
+	Endpoint string
+	// Query is a DTO passed to BuildURL to fill the endpoint path and query parameters.
+	Query   interface{}
+	Body    RequestBody
+	Headers map[string]string
+	// AcceptStatus overrides the client StatusAcceptor for this request.
+	AcceptStatus StatusAcceptor
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, pathUrl, nil)
+func (c *Client) Do(ctx context.Context, spec RequestSpec) (*http.Response, error) {
+	req, err := c.newRequest(ctx, spec)
 	if err != nil {
 		return nil, err
 	}
 
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-
 	return c.doRequest(req)
 }
 
-func (c *Client) Post(ctx context.Context, endpoint string, body interface{}, headers map[string]string) (*http.Response, error) {
-	jsonData, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
-	}
+func (c *Client) Get(ctx context.Context, endpoint string, in interface{}, headers map[string]string) (*http.Response, error) {
+	return c.Do(ctx, RequestSpec{Method: http.MethodGet, Endpoint: endpoint, Query: in, Headers: headers})
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+endpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
+func (c *Client) Head(ctx context.Context, endpoint string, in interface{}, headers map[string]string) (*http.Response, error) {
+	return c.Do(ctx, RequestSpec{Method: http.MethodHead, Endpoint: endpoint, Query: in, Headers: headers})
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
+func (c *Client) Delete(ctx context.Context, endpoint string, in interface{}, headers map[string]string) (*http.Response, error) {
+	return c.Do(ctx, RequestSpec{Method: http.MethodDelete, Endpoint: endpoint, Query: in, Headers: headers})
+}
 
-	return c.doRequest(req)
+func (c *Client) Post(ctx context.Context, endpoint string, body interface{}, headers map[string]string) (*http.Response, error) {
+	return c.Do(ctx, RequestSpec{Method: http.MethodPost, Endpoint: endpoint, Body: JSONBody(body), Headers: headers})
 }
 
 func (c *Client) Put(ctx context.Context, endpoint string, body interface{}, headers map[string]string) (*http.Response, error) {
-	jsonData, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.baseURL+endpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
+	return c.Do(ctx, RequestSpec{Method: http.MethodPut, Endpoint: endpoint, Body: JSONBody(body), Headers: headers})
+}
 
-	return c.doRequest(req)
+// Patch sends body as a JSON Merge Patch document.
+func (c *Client) Patch(ctx context.Context, endpoint string, body interface{}, headers map[string]string) (*http.Response, error) {
+	return c.Do(ctx, RequestSpec{Method: http.MethodPatch, Endpoint: endpoint, Body: MergePatchBody(body), Headers: headers})
 }
 
 func (c *Client) Close() {
+	if c.balancer != nil {
+		c.balancer.Close()
+	}
 	c.httpClient.CloseIdleConnections()
 }
 
@@ -113,9 +108,19 @@ func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
+	return c.checkResponse(req, resp)
+}
+
+func (c *Client) checkResponse(req *http.Request, resp *http.Response) (*http.Response, error) {
+	accept := acceptStatusFromContext(req.Context())
+	if accept == nil {
+		accept = c.acceptStatus
+	}
+
+	if !accept(resp.StatusCode) {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
 		if err != nil {
+			_ = resp.Body.Close()
 			return nil, err
 		}
 
@@ -125,52 +130,77 @@ func (c *Client) doRequest(req *http.Request) (*http.Response, error) {
 		}
 
 		return resp, &ClientResponseNot200Error{
-			ClientResponseCode: resp.StatusCode,
-			ClientResponseBody: string(body),
-			Err:                errors.New("response status code is not 200"),
+			ClientResponseCode:   resp.StatusCode,
+			ClientResponseBody:   string(body),
+			ClientResponseHeader: resp.Header,
+			Method:               req.Method,
+			URL:                  req.URL.String(),
+			Problem:              parseProblemDetails(resp.Header, body),
+			Err:                  statusClassError(resp.StatusCode),
 		}
 	}
 
 	return resp, nil
 }
 
-func BuildURL(template string, input interface{}) (string, error) {
-	v := reflect.ValueOf(input)
-	if v.Kind() == reflect.Ptr {
-		v = v.Elem()
+// endpointURL appends the endpoint to the base URL, unless it is absolute, and fills it with spec.Query.
+// Without Query the endpoint is used as is, so that literal braces in it are not taken for placeholders.
+func (c *Client) endpointURL(spec RequestSpec) (string, error) {
+	template := c.baseURL + spec.Endpoint
+	if isAbsoluteURL(spec.Endpoint) {
+		template = spec.Endpoint
 	}
-	t := v.Type()
 
-	if t.Kind() != reflect.Struct {
-		return "", fmt.Errorf("input is not a struct or pointer to a struct")
+	if spec.Query == nil {
+		return template, nil
 	}
 
-	isPathParam := strings.Contains(template, "{")
-	if isPathParam {
-		// path params /user/{id}/profile/{name}
-		for i := 0; i < t.NumField(); i++ {
-			fieldName := t.Field(i).Name
-			placeholder := "{" + strings.ToLower(fieldName) + "}"
-			fieldValue := fmt.Sprintf("%v", v.FieldByName(fieldName).Interface())
-			template = strings.ReplaceAll(template, placeholder, fieldValue)
-		}
-	} else {
-		// query params url?id=1&name=John
-		dataUrl, err := url.Parse(template)
+	return BuildURL(template, spec.Query)
+}
+
+func (c *Client) newRequest(ctx context.Context, spec RequestSpec) (*http.Request, error) {
+	pathUrl, err := c.endpointURL(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	var contentType string
+	if spec.Body != nil {
+		body, contentType, err = spec.Body.Encode()
 		if err != nil {
-			return template, err
+			return nil, err
 		}
+	}
+
+	if spec.AcceptStatus != nil {
+		ctx = ContextWithAcceptStatus(ctx, spec.AcceptStatus)
+	}
+	if RouteFromContext(ctx) == "" && !isAbsoluteURL(spec.Endpoint) {
+		ctx = ContextWithRoute(ctx, spec.Endpoint)
+	}
 
-		query := dataUrl.Query()
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			value := v.Field(i).Interface()
-			query.Add(strings.ToLower(field.Name), fmt.Sprintf("%v", value))
+	req, err := http.NewRequestWithContext(ctx, spec.Method, pathUrl, body)
+	if err != nil {
+		if closer, ok := body.(io.Closer); ok {
+			_ = closer.Close()
 		}
+		return nil, err
+	}
 
-		dataUrl.RawQuery = query.Encode()
-		template = dataUrl.String()
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
+	for key, value := range spec.Headers {
+		req.Header.Set(key, value)
+	}
+
+	return req, nil
+}
 
-	return template, nil
+func isAbsoluteURL(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://")
 }
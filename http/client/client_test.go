@@ -0,0 +1,263 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestClientDoEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RequestURI)
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		query    interface{}
+		want     string
+		wantErr  bool
+	}{
+		{name: "plain", endpoint: "/users", want: "/users"},
+		{name: "literal braces without query", endpoint: "/search/{raw}", want: "/search/%7Braw%7D"},
+		{name: "escape without query", endpoint: "/files/100%25", want: "/files/100%25"},
+		{name: "placeholder", endpoint: "/users/{id}", query: struct {
+			ID int `path:"id"`
+		}{ID: 7}, want: "/users/7"},
+		{name: "unresolved placeholder", endpoint: "/users/{id}", query: struct{}{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := c.Do(context.Background(), RequestSpec{Method: http.MethodGet, Endpoint: tt.endpoint, Query: tt.query})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(body); got != tt.want {
+				t.Fatalf("request URI = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestBodies(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            RequestBody
+		wantContentType string
+		wantBody        string
+		wantGetBody     bool
+	}{
+		{name: "JSON", body: JSONBody(map[string]int{"id": 7}), wantContentType: "application/json", wantBody: `{"id":7}`, wantGetBody: true},
+		{name: "merge patch", body: MergePatchBody(map[string]any{"name": nil}), wantContentType: "application/merge-patch+json", wantBody: `{"name":null}`, wantGetBody: true},
+		{name: "form", body: FormBody(url.Values{"b": {"2"}, "a": {"1 2"}}), wantContentType: "application/x-www-form-urlencoded", wantBody: "a=1+2&b=2", wantGetBody: true},
+		{name: "raw rewindable", body: RawBody(strings.NewReader("<user/>"), "application/xml"), wantContentType: "application/xml", wantBody: "<user/>", wantGetBody: true},
+		{name: "raw stream", body: RawBody(io.MultiReader(strings.NewReader("<user/>")), "application/xml"), wantContentType: "application/xml", wantBody: "<user/>"},
+	}
+
+	c, err := New("http://users.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := c.newRequest(context.Background(), RequestSpec{Method: http.MethodPost, Endpoint: "/users", Body: tt.body})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := req.Header.Get("Content-Type"); got != tt.wantContentType {
+				t.Fatalf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.wantBody {
+				t.Fatalf("body = %q, want %q", body, tt.wantBody)
+			}
+
+			if (req.GetBody != nil) != tt.wantGetBody {
+				t.Fatalf("GetBody set = %v, want %v", req.GetBody != nil, tt.wantGetBody)
+			}
+			if req.GetBody == nil {
+				return
+			}
+			// every attempt of a retried request reads the whole body again
+			for range 2 {
+				rewound, err := req.GetBody()
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err := io.ReadAll(rewound)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(body) != tt.wantBody {
+					t.Fatalf("rewound body = %q, want %q", body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	fields := map[string]string{"title": "report", "author": "john", "year": "2024", "lang": "en"}
+	newBody := func(content string) RequestBody {
+		return MultipartBody(fields, MultipartFile{FieldName: "file", FileName: `q"1".csv`, ContentType: "text/csv", Reader: strings.NewReader(content)})
+	}
+
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = r
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Do(context.Background(), RequestSpec{Method: http.MethodPost, Endpoint: "/reports", Body: newBody("a,b\n1,2\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	for name, value := range fields {
+		if got := received.FormValue(name); got != value {
+			t.Fatalf("field %s = %q, want %q", name, got, value)
+		}
+	}
+	file, header, err := received.FormFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Filename != `q"1".csv` || header.Header.Get("Content-Type") != "text/csv" || string(content) != "a,b\n1,2\n" {
+		t.Fatalf("file %q of type %q = %q", header.Filename, header.Header.Get("Content-Type"), content)
+	}
+
+	// the same fields are encoded the same way, apart from the random boundary
+	encode := func() string {
+		reader, contentType, err := newBody("a,b").Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("boundary")))
+	}
+	first := encode()
+	for range 10 {
+		if got := encode(); got != first {
+			t.Fatalf("body = %q, want %q", got, first)
+		}
+	}
+	if strings.Index(first, `name="author"`) > strings.Index(first, `name="year"`) {
+		t.Fatalf("fields are not sorted by name: %q", first)
+	}
+}
+
+func TestClientMethods(t *testing.T) {
+	type received struct {
+		method      string
+		contentType string
+		body        string
+	}
+
+	var got received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = received{method: r.Method, contentType: r.Header.Get("Content-Type"), body: string(body)}
+		w.Header().Set("X-Total-Count", "3")
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		send     func() (*http.Response, error)
+		want     received
+		wantBody string
+	}{
+		{
+			name:     "patch",
+			send:     func() (*http.Response, error) { return c.Patch(ctx, "/users/7", map[string]any{"email": nil}, nil) },
+			want:     received{method: http.MethodPatch, contentType: "application/merge-patch+json", body: `{"email":null}`},
+			wantBody: "done",
+		},
+		{
+			name: "head",
+			send: func() (*http.Response, error) { return c.Head(ctx, "/users", nil, nil) },
+			want: received{method: http.MethodHead},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.send()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			if got != tt.want {
+				t.Fatalf("server received %+v, want %+v", got, tt.want)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.wantBody || resp.Header.Get("X-Total-Count") != "3" {
+				t.Fatalf("response body %q with headers %v", body, resp.Header)
+			}
+		})
+	}
+}
@@ -0,0 +1,411 @@
+package clienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/viktor8881/service-utilities/http/client"
+)
+
+// FakeServer is an upstream for tests that answers requests matching the declared expectations.
+// Requests that match no expectation fail the test with the reasons why each expectation did not
+// match, and expectations called fewer times than required fail it when the test finishes.
+//
+//	fs := clienttest.NewFakeServer(t)
+//	fs.Expect(http.MethodGet, "/users/{id}").WithQuery("fields", "name").Respond(http.StatusOK, user)
+//	svc := NewService(fs.Client())
+type FakeServer struct {
+	t      testing.TB
+	server *httptest.Server
+
+	mu           sync.Mutex
+	expectations []*Expectation
+}
+
+// NewFakeServer starts the server, it is closed and verified when the test finishes.
+func NewFakeServer(t testing.TB) *FakeServer {
+	t.Helper()
+
+	fs := &FakeServer{t: t}
+	fs.server = httptest.NewServer(http.HandlerFunc(fs.serveHTTP))
+
+	t.Cleanup(func() {
+		fs.server.Close()
+		fs.Verify()
+	})
+
+	return fs
+}
+
+func (fs *FakeServer) URL() string {
+	return fs.server.URL
+}
+
+// Client returns a client with the server URL as its base URL.
+func (fs *FakeServer) Client(opts ...client.Option) *client.Client {
+	fs.t.Helper()
+
+	c, err := client.New(fs.server.URL, opts...)
+	if err != nil {
+		fs.t.Fatalf("clienttest: create client: %v", err)
+	}
+
+	return c
+}
+
+// Expect declares a request that the server should receive. The pattern is a path where {name} matches
+// a segment and {name...} the rest of the path, the values are available through http.Request.PathValue
+// in RespondWith. By default the expectation must be called exactly once and responds with 200 and no body.
+// Expectations are matched in the order they are declared.
+func (fs *FakeServer) Expect(method, pattern string) *Expectation {
+	e := &Expectation{
+		method:   method,
+		pattern:  pattern,
+		query:    make(map[string]string),
+		headers:  make(map[string]string),
+		status:   http.StatusOK,
+		minCalls: 1,
+		maxCalls: 1,
+	}
+
+	fs.mu.Lock()
+	fs.expectations = append(fs.expectations, e)
+	fs.mu.Unlock()
+
+	return e
+}
+
+// Verify fails the test for every expectation called fewer times than required.
+func (fs *FakeServer) Verify() {
+	fs.t.Helper()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for _, e := range fs.expectations {
+		if e.calls < e.minCalls {
+			fs.t.Errorf("clienttest: %s was called %d time(s), want %s", e, e.calls, e.timesString())
+		}
+	}
+}
+
+func (fs *FakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	fs.mu.Lock()
+	var matched *Expectation
+	// expectations for the same method and path explain the mismatch better than the rest
+	var mismatches, sameRoute []string
+	for _, e := range fs.expectations {
+		reasons := e.mismatches(r, body)
+		if len(reasons) == 0 && e.calls >= e.maxCalls {
+			reasons = []string{fmt.Sprintf("already called %d time(s), want %s", e.calls, e.timesString())}
+		}
+
+		if len(reasons) > 0 {
+			mismatch := fmt.Sprintf("  %s:\n    %s", e, strings.Join(reasons, "\n    "))
+			mismatches = append(mismatches, mismatch)
+			if _, ok := matchPattern(e.pattern, r.URL.Path); ok && e.method == r.Method {
+				sameRoute = append(sameRoute, mismatch)
+			}
+			continue
+		}
+
+		matched = e
+		e.calls++
+		break
+	}
+	fs.mu.Unlock()
+
+	if matched == nil {
+		message := fmt.Sprintf("clienttest: unexpected request %s %s", r.Method, r.URL.RequestURI())
+		if len(body) > 0 {
+			message += "\n  body: " + string(body)
+		}
+		if len(sameRoute) > 0 {
+			mismatches = sameRoute
+		}
+		if len(mismatches) > 0 {
+			message += "\n" + strings.Join(mismatches, "\n")
+		}
+		fs.t.Errorf("%s", message)
+
+		http.Error(w, "clienttest: unexpected request", http.StatusNotImplemented)
+		return
+	}
+
+	matched.serve(w, r)
+}
+
+// Expectation describes an expected request and the response to it.
+type Expectation struct {
+	method   string
+	pattern  string
+	query    map[string]string
+	headers  map[string]string
+	jsonBody any
+	hasBody  bool
+
+	status         int
+	responseHeader http.Header
+	responseBody   any
+	handler        http.HandlerFunc
+	delay          time.Duration
+	fail           bool
+
+	minCalls int
+	maxCalls int
+	calls    int
+}
+
+// WithQuery requires the query parameter to have the value.
+func (e *Expectation) WithQuery(name, value string) *Expectation {
+	e.query[name] = value
+	return e
+}
+
+// WithHeader requires the request header to have the value.
+func (e *Expectation) WithHeader(name, value string) *Expectation {
+	e.headers[name] = value
+	return e
+}
+
+// WithJSONBody requires the request body to be JSON equal to body regardless of formatting and key order.
+func (e *Expectation) WithJSONBody(body any) *Expectation {
+	e.jsonBody = body
+	e.hasBody = true
+	return e
+}
+
+// Respond sets the response. A string or []byte body is written as is, other values are encoded as JSON.
+func (e *Expectation) Respond(status int, body any) *Expectation {
+	e.status = status
+	e.responseBody = body
+	return e
+}
+
+// RespondWithHeader adds a response header.
+func (e *Expectation) RespondWithHeader(name, value string) *Expectation {
+	if e.responseHeader == nil {
+		e.responseHeader = make(http.Header)
+	}
+	e.responseHeader.Add(name, value)
+	return e
+}
+
+// RespondWith answers with the handler instead of the canned response.
+func (e *Expectation) RespondWith(handler http.HandlerFunc) *Expectation {
+	e.handler = handler
+	return e
+}
+
+// Times requires exactly n calls.
+func (e *Expectation) Times(n int) *Expectation {
+	e.minCalls, e.maxCalls = n, n
+	return e
+}
+
+// AtLeast requires n or more calls.
+func (e *Expectation) AtLeast(n int) *Expectation {
+	e.minCalls, e.maxCalls = n, int(^uint(0)>>1)
+	return e
+}
+
+// AnyTimes allows any number of calls including none.
+func (e *Expectation) AnyTimes() *Expectation {
+	return e.AtLeast(0)
+}
+
+// Delay waits before responding, or until the client gives up.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Fail closes the connection without a response, the client gets a transport error.
+func (e *Expectation) Fail() *Expectation {
+	e.fail = true
+	return e
+}
+
+func (e *Expectation) String() string {
+	return e.method + " " + e.pattern
+}
+
+func (e *Expectation) timesString() string {
+	switch {
+	case e.minCalls == e.maxCalls:
+		return fmt.Sprintf("exactly %d", e.minCalls)
+	case e.minCalls == 0:
+		return "any number"
+	default:
+		return fmt.Sprintf("at least %d", e.minCalls)
+	}
+}
+
+// mismatches returns why the request does not match the expectation, nothing if it does.
+// Path values of the pattern are set on the request.
+func (e *Expectation) mismatches(r *http.Request, body []byte) []string {
+	var reasons []string
+
+	if r.Method != e.method {
+		reasons = append(reasons, fmt.Sprintf("method: want %s, got %s", e.method, r.Method))
+	}
+
+	values, ok := matchPattern(e.pattern, r.URL.Path)
+	if !ok {
+		reasons = append(reasons, fmt.Sprintf("path: want %s, got %s", e.pattern, r.URL.Path))
+	}
+
+	query := r.URL.Query()
+	for name, want := range e.query {
+		if got := query.Get(name); got != want || !query.Has(name) {
+			reasons = append(reasons, fmt.Sprintf("query %s: want %q, got %q", name, want, got))
+		}
+	}
+
+	for name, want := range e.headers {
+		if got := r.Header.Get(name); got != want {
+			reasons = append(reasons, fmt.Sprintf("header %s: want %q, got %q", name, want, got))
+		}
+	}
+
+	if e.hasBody {
+		if reason := diffJSON(e.jsonBody, body); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	if len(reasons) == 0 {
+		for name, value := range values {
+			r.SetPathValue(name, value)
+		}
+	}
+
+	return reasons
+}
+
+func (e *Expectation) serve(w http.ResponseWriter, r *http.Request) {
+	if e.delay > 0 {
+		select {
+		case <-time.After(e.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if e.fail {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				_ = conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if e.handler != nil {
+		e.handler(w, r)
+		return
+	}
+
+	for name, values := range e.responseHeader {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	var body []byte
+	switch responseBody := e.responseBody.(type) {
+	case nil:
+	case []byte:
+		body = responseBody
+	case string:
+		body = []byte(responseBody)
+	default:
+		encoded, err := json.Marshal(responseBody)
+		if err != nil {
+			http.Error(w, "clienttest: encode response: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = encoded
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+	}
+
+	w.WriteHeader(e.status)
+	_, _ = w.Write(body)
+}
+
+// matchPattern matches a path against a pattern with {name} and {name...} segments.
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	values := make(map[string]string)
+	for i, segment := range patternSegments {
+		wildcard := strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+		name := strings.Trim(segment, "{}")
+
+		if rest, ok := strings.CutSuffix(name, "..."); wildcard && ok {
+			values[rest] = strings.Join(pathSegments[min(i, len(pathSegments)):], "/")
+			return values, true
+		}
+
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+
+		if wildcard {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			values[name] = pathSegments[i]
+			continue
+		}
+
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+
+	if len(pathSegments) != len(patternSegments) {
+		return nil, false
+	}
+
+	return values, true
+}
+
+// diffJSON compares a request body with the expected value, it returns a readable difference or nothing.
+func diffJSON(want any, body []byte) string {
+	wantJSON, err := json.Marshal(want)
+	if err != nil {
+		return "body: encode expected body: " + err.Error()
+	}
+
+	var wantValue, gotValue any
+	_ = json.Unmarshal(wantJSON, &wantValue)
+	if err := json.Unmarshal(body, &gotValue); err != nil {
+		return fmt.Sprintf("body: want JSON %s, got %q", wantJSON, body)
+	}
+
+	if reflect.DeepEqual(wantValue, gotValue) {
+		return ""
+	}
+
+	wantIndented, _ := json.MarshalIndent(wantValue, "      ", "  ")
+	gotIndented, _ := json.MarshalIndent(gotValue, "      ", "  ")
+
+	return fmt.Sprintf("body:\n      want: %s\n      got:  %s", wantIndented, gotIndented)
+}
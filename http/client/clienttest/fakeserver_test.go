@@ -0,0 +1,262 @@
+package clienttest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viktor8881/service-utilities/http/client"
+)
+
+func TestFakeServerMatchers(t *testing.T) {
+	fs := NewFakeServer(t)
+	fs.Expect(http.MethodGet, "/users/{id}").WithQuery("fields", "email").Respond(http.StatusOK, "by email")
+	fs.Expect(http.MethodGet, "/users/{id}").WithQuery("fields", "name").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "user "+r.PathValue("id"))
+	})
+	fs.Expect(http.MethodPost, "/users").
+		WithHeader("X-Tenant", "acme").
+		WithJSONBody(map[string]any{"name": "john", "age": 42}).
+		RespondWithHeader("Location", "/users/7").
+		Respond(http.StatusCreated, map[string]int{"id": 7})
+	fs.Expect(http.MethodGet, "/files/{path...}").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.PathValue("path"))
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     http.Header
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "path value and query", method: http.MethodGet, path: "/users/42?fields=name", wantStatus: http.StatusOK, wantBody: "user 42"},
+		{name: "first matching expectation", method: http.MethodGet, path: "/users/42?fields=email", wantStatus: http.StatusOK, wantBody: "by email"},
+		{
+			name:       "header and JSON body in another key order",
+			method:     http.MethodPost,
+			path:       "/users",
+			header:     http.Header{"X-Tenant": {"acme"}},
+			body:       `{"age": 42, "name": "john"}`,
+			wantStatus: http.StatusCreated,
+			wantBody:   `{"id":7}`,
+		},
+		{name: "rest of the path", method: http.MethodGet, path: "/files/a/b.txt", wantStatus: http.StatusOK, wantBody: "a/b.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, fs.URL()+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFakeServerClient(t *testing.T) {
+	fs := NewFakeServer(t)
+	fs.Expect(http.MethodGet, "/users/{id}").Respond(http.StatusOK, map[string]string{"name": "john"})
+
+	user, err := client.GetJSON[map[string]string](context.Background(), fs.Client(), "/users/1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user["name"] != "john" {
+		t.Fatalf("got %v, want the canned response", user)
+	}
+}
+
+func TestFakeServerUnexpectedRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(fs *FakeServer)
+		path  string
+		body  string
+		want  []string
+		avoid []string
+	}{
+		{
+			name: "query",
+			setup: func(fs *FakeServer) {
+				fs.Expect(http.MethodPost, "/orders").AnyTimes()
+				fs.Expect(http.MethodPost, "/users").WithQuery("dry_run", "true").AnyTimes()
+			},
+			path: "/users?dry_run=false",
+			want: []string{
+				"unexpected request POST /users?dry_run=false",
+				"POST /users:",
+				`query dry_run: want "true", got "false"`,
+			},
+			// an expectation for another route does not explain the mismatch
+			avoid: []string{"POST /orders"},
+		},
+		{
+			name: "JSON body",
+			setup: func(fs *FakeServer) {
+				fs.Expect(http.MethodPost, "/users").WithJSONBody(map[string]string{"name": "john"}).AnyTimes()
+			},
+			path: "/users",
+			body: `{"name":"jane"}`,
+			want: []string{
+				`body: {"name":"jane"}`,
+				`want: {`,
+				`"name": "john"`,
+				`got:  {`,
+				`"name": "jane"`,
+			},
+		},
+		{
+			name: "no expectation for the route",
+			setup: func(fs *FakeServer) {
+				fs.Expect(http.MethodGet, "/users").AnyTimes()
+			},
+			path: "/orders",
+			want: []string{
+				"GET /users:",
+				"method: want GET, got POST",
+				"path: want /users, got /orders",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &failureRecorder{TB: t}
+			fs := NewFakeServer(recorder)
+			tt.setup(fs)
+
+			resp, err := http.Post(fs.URL()+tt.path, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != http.StatusNotImplemented {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNotImplemented)
+			}
+
+			failures := recorder.Failures()
+			if len(failures) != 1 {
+				t.Fatalf("failures = %q, want one", failures)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(failures[0], want) {
+					t.Fatalf("failure does not contain %q:\n%s", want, failures[0])
+				}
+			}
+			for _, avoid := range tt.avoid {
+				if strings.Contains(failures[0], avoid) {
+					t.Fatalf("failure contains %q:\n%s", avoid, failures[0])
+				}
+			}
+		})
+	}
+}
+
+func TestFakeServerTimes(t *testing.T) {
+	tests := []struct {
+		name         string
+		times        func(e *Expectation)
+		calls        int
+		wantFailures []string
+	}{
+		{name: "once by default", calls: 1},
+		{name: "not called", calls: 0, wantFailures: []string{"GET /users was called 0 time(s), want exactly 1"}},
+		{name: "called too many times", calls: 2, wantFailures: []string{"already called 1 time(s), want exactly 1"}},
+		{name: "Times", times: func(e *Expectation) { e.Times(2) }, calls: 2},
+		{name: "Times not reached", times: func(e *Expectation) { e.Times(3) }, calls: 2, wantFailures: []string{"GET /users was called 2 time(s), want exactly 3"}},
+		{name: "AtLeast", times: func(e *Expectation) { e.AtLeast(2) }, calls: 5},
+		{name: "AtLeast not reached", times: func(e *Expectation) { e.AtLeast(2) }, calls: 1, wantFailures: []string{"GET /users was called 1 time(s), want at least 2"}},
+		{name: "AnyTimes", times: func(e *Expectation) { e.AnyTimes() }, calls: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &failureRecorder{TB: t}
+			fs := NewFakeServer(recorder)
+			e := fs.Expect(http.MethodGet, "/users")
+			if tt.times != nil {
+				tt.times(e)
+			}
+
+			for range tt.calls {
+				resp, err := http.Get(fs.URL() + "/users")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = resp.Body.Close()
+			}
+			fs.Verify()
+
+			failures := recorder.Failures()
+			if len(failures) != len(tt.wantFailures) {
+				t.Fatalf("failures = %q, want %q", failures, tt.wantFailures)
+			}
+			for i, want := range tt.wantFailures {
+				if !strings.Contains(failures[i], want) {
+					t.Fatalf("failure %q does not contain %q", failures[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeServerFail(t *testing.T) {
+	fs := NewFakeServer(t)
+	fs.Expect(http.MethodGet, "/users").Fail()
+
+	resp, err := http.Get(fs.URL() + "/users")
+	if err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("got %d, want a transport error", resp.StatusCode)
+	}
+}
+
+func TestFakeServerDelay(t *testing.T) {
+	fs := NewFakeServer(t)
+	fs.Expect(http.MethodGet, "/slow").Delay(time.Second)
+	fs.Expect(http.MethodGet, "/fast").Delay(20 * time.Millisecond).Respond(http.StatusOK, "done")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := fs.Client().Get(ctx, "/slow", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the client timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("request took %s, want it cut by the client timeout", elapsed)
+	}
+
+	start = time.Now()
+	resp, err := fs.Client().Get(context.Background(), "/fast", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("response came after %s, want the 20ms delay", elapsed)
+	}
+}
@@ -0,0 +1,374 @@
+// Package clienttest provides helpers for testing code built on client.Client.
+package clienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/viktor8881/service-utilities/internal/redact"
+)
+
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette and fails on requests that are not recorded.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests through Proxied and writes them to the cassette.
+	ModeRecord
+)
+
+// Cassette is the file format of recorded interactions, stored as YAML when the file
+// extension is .yaml or .yml and as JSON otherwise.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions" yaml:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request" yaml:"request"`
+	Response RecordedResponse `json:"response" yaml:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method" yaml:"method"`
+	URL    string      `json:"url" yaml:"url"`
+	Header http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code" yaml:"status_code"`
+	Header     http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body       string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Matcher reports whether a request matches a recorded one, body is the redacted request body.
+type Matcher func(req *http.Request, body []byte, recorded RecordedRequest) bool
+
+// DefaultMatchers match requests by method and URL.
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL}
+
+func MatchMethod(req *http.Request, _ []byte, recorded RecordedRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL compares the whole URL, the query parameters are compared regardless of their order.
+func MatchURL(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	return MatchPath(req, body, recorded) && MatchQuery(req, body, recorded)
+}
+
+// MatchPath compares the URL without the query.
+func MatchPath(req *http.Request, _ []byte, recorded RecordedRequest) bool {
+	recordedURL, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+
+	return req.URL.Scheme == recordedURL.Scheme && req.URL.Host == recordedURL.Host && req.URL.Path == recordedURL.Path
+}
+
+func MatchQuery(req *http.Request, _ []byte, recorded RecordedRequest) bool {
+	recordedURL, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(normalizeQuery(req.URL.Query()), normalizeQuery(recordedURL.Query()))
+}
+
+// MatchBody compares JSON bodies semantically and other bodies byte by byte.
+func MatchBody(_ *http.Request, body []byte, recorded RecordedRequest) bool {
+	var actual, expected any
+	if json.Unmarshal(body, &actual) == nil && json.Unmarshal([]byte(recorded.Body), &expected) == nil {
+		return reflect.DeepEqual(actual, expected)
+	}
+
+	return string(body) == recorded.Body
+}
+
+// RecordReplayRoundTripper is a http.RoundTripper that records traffic to a cassette file
+// and replays it in tests without the real upstream.
+//
+// RedactHeaders, RedactQueryParams and RedactBodyFields (JSON paths like "user.password", see redact.JSONFields)
+// are masked in recorded requests and responses; in replay mode they are masked in incoming requests
+// too, so that matchers see the same values as recorded.
+type RecordReplayRoundTripper struct {
+	Proxied           http.RoundTripper
+	Mode              Mode
+	Matchers          []Matcher
+	RedactHeaders     []string
+	RedactQueryParams []string
+	RedactBodyFields  []string
+	// AllowRepeats lets a recorded interaction be replayed more than once.
+	AllowRepeats bool
+
+	t        testing.TB
+	path     string
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+// NewRecordReplayRoundTripper loads the cassette at path in replay mode. In record mode the cassette
+// is written when the test finishes. Requests that do not match any recorded interaction fail the test.
+func NewRecordReplayRoundTripper(t testing.TB, proxied http.RoundTripper, path string, mode Mode) *RecordReplayRoundTripper {
+	t.Helper()
+
+	rrt := &RecordReplayRoundTripper{
+		Proxied:           proxied,
+		Mode:              mode,
+		Matchers:          DefaultMatchers,
+		RedactHeaders:     []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"},
+		RedactQueryParams: []string{"api_key", "apikey", "access_token", "token", "client_secret", "password"},
+		t:                 t,
+		path:              path,
+	}
+
+	switch mode {
+	case ModeReplay:
+		if err := rrt.load(); err != nil {
+			t.Fatalf("clienttest: load cassette %s: %v", path, err)
+		}
+	case ModeRecord:
+		t.Cleanup(func() {
+			if err := rrt.Save(); err != nil {
+				t.Errorf("clienttest: save cassette %s: %v", path, err)
+			}
+		})
+	}
+
+	return rrt
+}
+
+func (rrt *RecordReplayRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rrt.Mode == ModeRecord {
+		return rrt.record(req, body)
+	}
+
+	return rrt.replay(req, body)
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (rrt *RecordReplayRoundTripper) Save() error {
+	rrt.mu.Lock()
+	defer rrt.mu.Unlock()
+
+	var data []byte
+	var err error
+	if isYAML(rrt.path) {
+		data, err = yaml.Marshal(&rrt.cassette)
+	} else {
+		data, err = json.MarshalIndent(&rrt.cassette, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rrt.path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(rrt.path, data, 0o644)
+}
+
+func (rrt *RecordReplayRoundTripper) record(req *http.Request, body []byte) (*http.Response, error) {
+	// the body of req is read already, a clone carries a copy of it so that the caller's request is left as is
+	if body != nil {
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := rrt.Proxied.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// the body length may change after redaction, the replayed response gets the actual one
+	respHeader := redact.Header(resp.Header, rrt.RedactHeaders)
+	respHeader.Del("Content-Length")
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    redact.URL(req.URL, rrt.RedactQueryParams).String(),
+			Header: redact.Header(req.Header, rrt.RedactHeaders),
+			Body:   string(rrt.redactBody(body)),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     respHeader,
+			Body:       string(rrt.redactBody(respBody)),
+		},
+	}
+
+	rrt.mu.Lock()
+	rrt.cassette.Interactions = append(rrt.cassette.Interactions, interaction)
+	rrt.used = append(rrt.used, true)
+	rrt.mu.Unlock()
+
+	return resp, nil
+}
+
+func (rrt *RecordReplayRoundTripper) replay(req *http.Request, body []byte) (*http.Response, error) {
+	body = rrt.redactBody(body)
+
+	// the matchers compare the request as it would have been recorded
+	matchReq := req
+	if redactedURL := redact.URL(req.URL, rrt.RedactQueryParams); redactedURL != req.URL {
+		matchReq = req.WithContext(req.Context())
+		matchReq.URL = redactedURL
+	}
+
+	rrt.mu.Lock()
+	defer rrt.mu.Unlock()
+
+	found := -1
+	for i, interaction := range rrt.cassette.Interactions {
+		if (rrt.used[i] && !rrt.AllowRepeats) || !rrt.matches(matchReq, body, interaction.Request) {
+			continue
+		}
+
+		found = i
+		if !rrt.used[i] {
+			break
+		}
+	}
+
+	if found < 0 {
+		err := &UnmatchedRequestError{Method: req.Method, URL: matchReq.URL.String(), Body: string(body)}
+		rrt.t.Errorf("clienttest: %v", err)
+		return nil, err
+	}
+
+	rrt.used[found] = true
+	recorded := rrt.cassette.Interactions[found].Response
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+func (rrt *RecordReplayRoundTripper) matches(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	for _, match := range rrt.Matchers {
+		if !match(req, body, recorded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (rrt *RecordReplayRoundTripper) redactBody(body []byte) []byte {
+	if len(rrt.RedactBodyFields) == 0 || len(body) == 0 {
+		return body
+	}
+
+	redacted, _ := redact.JSONFields(body, rrt.RedactBodyFields)
+	return redacted
+}
+
+func (rrt *RecordReplayRoundTripper) load() error {
+	data, err := os.ReadFile(rrt.path)
+	if err != nil {
+		return err
+	}
+
+	if isYAML(rrt.path) {
+		err = yaml.Unmarshal(data, &rrt.cassette)
+	} else {
+		err = json.Unmarshal(data, &rrt.cassette)
+	}
+	if err != nil {
+		return err
+	}
+
+	rrt.used = make([]bool, len(rrt.cassette.Interactions))
+	return nil
+}
+
+// UnmatchedRequestError is returned in replay mode for a request that is not in the cassette.
+type UnmatchedRequestError struct {
+	Method string
+	URL    string
+	Body   string
+}
+
+func (e *UnmatchedRequestError) Error() string {
+	mess := fmt.Sprintf("UnmatchedRequestError: no recorded interaction for %s %s", e.Method, e.URL)
+	if e.Body != "" {
+		mess += ", body: " + e.Body
+	}
+
+	return mess
+}
+
+// readRequestBody reads the body, through http.Request.GetBody when it is set, and closes req.Body.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	if req.GetBody == nil {
+		return io.ReadAll(req.Body)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	return io.ReadAll(body)
+}
+
+func normalizeQuery(query url.Values) url.Values {
+	if len(query) == 0 {
+		return nil
+	}
+
+	return query
+}
+
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -0,0 +1,261 @@
+package clienttest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// failureRecorder collects the failures reported by the helpers instead of failing the test.
+type failureRecorder struct {
+	testing.TB
+
+	mu       sync.Mutex
+	failures []string
+}
+
+func (r *failureRecorder) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *failureRecorder) Fatalf(format string, args ...any) {
+	r.Errorf(format, args...)
+}
+
+func (r *failureRecorder) Failures() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.failures)
+}
+
+// trackedBody reports whether the round tripper closed the request body.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRecordReplayRoundTripper(t *testing.T) {
+	for _, name := range []string{"cassette.yaml", "cassette.json"} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.Header().Set("Set-Cookie", "session=secret")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = fmt.Fprintf(w, `{"echo":%s,"token":"secret"}`, body)
+			}))
+			defer server.Close()
+
+			path := filepath.Join(t.TempDir(), name)
+			url := server.URL + "/users?b=2&a=1"
+
+			t.Run("record", func(t *testing.T) {
+				rrt := NewRecordReplayRoundTripper(t, http.DefaultTransport, path, ModeRecord)
+				rrt.Matchers = append(DefaultMatchers, MatchBody)
+				rrt.RedactBodyFields = []string{"token"}
+
+				body := &trackedBody{Reader: strings.NewReader(`{"name":"john"}`)}
+				req := newRecorderRequest(t, http.MethodPost, url, body)
+				resp, err := rrt.RoundTrip(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := readRecorderResponse(t, resp); got != `{"echo":{"name":"john"},"token":"secret"}` {
+					t.Fatalf("recorded response body = %s, want the upstream one", got)
+				}
+				if !body.closed || req.Body != body {
+					t.Fatalf("request body closed %t, replaced %t, want closed and left in place", body.closed, req.Body != body)
+				}
+			})
+
+			rrt := NewRecordReplayRoundTripper(t, nil, path, ModeReplay)
+			rrt.Matchers = append(DefaultMatchers, MatchBody)
+
+			body := &trackedBody{Reader: strings.NewReader(` { "name": "john" } `)}
+			resp, err := rrt.RoundTrip(newRecorderRequest(t, http.MethodPost, server.URL+"/users?a=1&b=2", body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("replayed status = %d, want %d", resp.StatusCode, http.StatusCreated)
+			}
+			if got := resp.Header.Get("Set-Cookie"); strings.Contains(got, "secret") {
+				t.Fatalf("replayed Set-Cookie = %q, want it redacted", got)
+			}
+			if got := readRecorderResponse(t, resp); strings.Contains(got, "secret") || !strings.Contains(got, `"echo"`) {
+				t.Fatalf("replayed body = %s, want the recorded one with the token redacted", got)
+			}
+			if !body.closed {
+				t.Fatal("request body is not closed in replay mode")
+			}
+		})
+	}
+}
+
+func TestRecordReplayRoundTripperUnmatched(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	t.Run("record", func(t *testing.T) {
+		rrt := NewRecordReplayRoundTripper(t, http.DefaultTransport, path, ModeRecord)
+		resp, err := rrt.RoundTrip(newRecorderRequest(t, http.MethodGet, server.URL+"/users", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	})
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		replayed     bool
+		allowRepeats bool
+		wantFailure  bool
+	}{
+		{name: "another method", method: http.MethodDelete, path: "/users", wantFailure: true},
+		{name: "another path", method: http.MethodGet, path: "/orders", wantFailure: true},
+		{name: "replayed twice", method: http.MethodGet, path: "/users", replayed: true, wantFailure: true},
+		{name: "replayed twice with AllowRepeats", method: http.MethodGet, path: "/users", replayed: true, allowRepeats: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &failureRecorder{TB: t}
+			rrt := NewRecordReplayRoundTripper(recorder, nil, path, ModeReplay)
+			rrt.AllowRepeats = tt.allowRepeats
+
+			if tt.replayed {
+				resp, err := rrt.RoundTrip(newRecorderRequest(t, http.MethodGet, server.URL+"/users", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = resp.Body.Close()
+			}
+
+			url := server.URL + tt.path
+			resp, err := rrt.RoundTrip(newRecorderRequest(t, tt.method, url, nil))
+
+			var unmatched *UnmatchedRequestError
+			if !tt.wantFailure {
+				if err != nil || len(recorder.Failures()) > 0 {
+					t.Fatalf("error %v, failures %v, want the recorded response", err, recorder.Failures())
+				}
+				_ = resp.Body.Close()
+				return
+			}
+			if !errors.As(err, &unmatched) || unmatched.Method != tt.method || unmatched.URL != url {
+				t.Fatalf("error = %v, want UnmatchedRequestError for %s %s", err, tt.method, url)
+			}
+			if failures := recorder.Failures(); len(failures) != 1 || !strings.Contains(failures[0], "no recorded interaction") {
+				t.Fatalf("test failures = %v, want one about the unmatched request", failures)
+			}
+		})
+	}
+}
+
+func TestRecordReplayRoundTripperRedactQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != "secret" {
+			t.Errorf("upstream got api_key %q, want the real one", r.URL.Query().Get("api_key"))
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+	t.Run("record", func(t *testing.T) {
+		rrt := NewRecordReplayRoundTripper(t, http.DefaultTransport, path, ModeRecord)
+		resp, err := rrt.RoundTrip(newRecorderRequest(t, http.MethodGet, server.URL+"/users?page=2&API_KEY=secret&api_key=secret", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	})
+
+	cassette, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(cassette), "secret") || !strings.Contains(string(cassette), "page=2") {
+		t.Fatalf("cassette = %s, want the api_key redacted and the other parameters kept", cassette)
+	}
+
+	// another key matches the recorded request, the other parameters still have to match
+	tests := []struct {
+		name        string
+		query       string
+		wantFailure bool
+	}{
+		{name: "another key", query: "?api_key=other&page=2&API_KEY=other"},
+		{name: "another page", query: "?api_key=other&page=3&API_KEY=other", wantFailure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &failureRecorder{TB: t}
+			rrt := NewRecordReplayRoundTripper(recorder, nil, path, ModeReplay)
+
+			resp, err := rrt.RoundTrip(newRecorderRequest(t, http.MethodGet, server.URL+"/users"+tt.query, nil))
+			if tt.wantFailure {
+				var unmatched *UnmatchedRequestError
+				if !errors.As(err, &unmatched) || strings.Contains(unmatched.URL, "other") {
+					t.Fatalf("error = %v, want UnmatchedRequestError with the api_key redacted", err)
+				}
+				return
+			}
+
+			if err != nil || len(recorder.Failures()) > 0 {
+				t.Fatalf("error %v, failures %v, want the recorded response", err, recorder.Failures())
+			}
+			if got := readRecorderResponse(t, resp); got != "ok" {
+				t.Fatalf("replayed body = %q, want ok", got)
+			}
+		})
+	}
+}
+
+func newRecorderRequest(t *testing.T, method, url string, body io.ReadCloser) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Body = body
+	}
+
+	return req
+}
+
+func readRecorderResponse(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
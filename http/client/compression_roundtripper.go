@@ -0,0 +1,244 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+
+	defaultCompressionMinSize = 1 << 10
+)
+
+var defaultAcceptEncodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+
+// CompressionStats describes the compression of a request body.
+type CompressionStats struct {
+	Encoding       string
+	OriginalSize   int64
+	CompressedSize int64
+	Duration       time.Duration
+}
+
+// Ratio is the original size divided by the compressed size.
+func (s *CompressionStats) Ratio() float64 {
+	if s.CompressedSize == 0 {
+		return 0
+	}
+
+	return float64(s.OriginalSize) / float64(s.CompressedSize)
+}
+
+type compressionStatsContextKey struct{}
+
+// CompressionStatsFromContext returns the stats filled by CompressionRoundTripper, the Encoding
+// is empty if the request body was not compressed. It returns nil unless the request went through
+// CompressionRoundTripper or MetricRoundTripper.
+func CompressionStatsFromContext(ctx context.Context) *CompressionStats {
+	stats, _ := ctx.Value(compressionStatsContextKey{}).(*CompressionStats)
+	return stats
+}
+
+// withCompressionStats makes sure the request carries stats that round trippers down the chain fill.
+func withCompressionStats(req *http.Request) (*http.Request, *CompressionStats) {
+	if stats := CompressionStatsFromContext(req.Context()); stats != nil {
+		return req, stats
+	}
+
+	stats := &CompressionStats{}
+	return req.WithContext(context.WithValue(req.Context(), compressionStatsContextKey{}, stats)), stats
+}
+
+// CompressionRoundTripper is a http.RoundTripper that compresses request bodies of at least MinSize bytes
+// with Encoding, and asks for compressed responses with AcceptEncodings, decoding zstd, br and gzip responses
+// transparently. If the caller sets Accept-Encoding itself, the response is returned as is.
+//
+// A body is sent as is when it does not get smaller or when its length is unknown: such bodies are streamed,
+// e.g. MultipartBody, and compressing them would read them into memory first.
+//
+// The request compression is reported through CompressionStatsFromContext, MetricRoundTripper exports it.
+type CompressionRoundTripper struct {
+	Proxied         http.RoundTripper
+	Encoding        string
+	MinSize         int64
+	AcceptEncodings []string
+}
+
+func NewCompressionRoundTripper(proxied http.RoundTripper, encoding string, minSize int64) *CompressionRoundTripper {
+	if encoding == "" {
+		encoding = EncodingGzip
+	}
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+
+	return &CompressionRoundTripper{
+		Proxied:         proxied,
+		Encoding:        encoding,
+		MinSize:         minSize,
+		AcceptEncodings: defaultAcceptEncodings,
+	}
+}
+
+func (crt *CompressionRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req, stats := withCompressionStats(req)
+
+	req, err := crt.compressRequest(req, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	decode := req.Header.Get("Accept-Encoding") == "" && len(crt.AcceptEncodings) > 0
+	if decode {
+		req.Header.Set("Accept-Encoding", strings.Join(crt.AcceptEncodings, ", "))
+	}
+
+	resp, err := crt.Proxied.RoundTrip(req)
+	if err != nil || !decode {
+		return resp, err
+	}
+
+	decodeResponse(resp)
+
+	return resp, nil
+}
+
+// compressRequest returns a clone of req, so that headers can be changed without touching the caller's request.
+func (crt *CompressionRoundTripper) compressRequest(req *http.Request, stats *CompressionStats) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+		return req.Clone(req.Context()), nil
+	}
+
+	// for client requests a zero ContentLength with a body means the length is unknown,
+	// such bodies are streamed (e.g. MultipartBody) and are not read into memory
+	if req.ContentLength <= 0 || req.ContentLength < crt.MinSize {
+		return req.Clone(req.Context()), nil
+	}
+
+	start := time.Now()
+
+	original, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder, err := newEncoder(crt.Encoding, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encoder.Write(original); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	body, compressedReq := original, req.Clone(req.Context())
+	if compressed := buf.Bytes(); len(compressed) < len(original) {
+		body = compressed
+
+		stats.Encoding = crt.Encoding
+		stats.OriginalSize = int64(len(original))
+		stats.CompressedSize = int64(len(compressed))
+		stats.Duration = time.Since(start)
+
+		compressedReq.Header.Set("Content-Encoding", crt.Encoding)
+		compressedReq.Header.Del("Content-Length")
+	}
+
+	compressedReq.Body = io.NopCloser(bytes.NewReader(body))
+	compressedReq.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	compressedReq.ContentLength = int64(len(body))
+
+	return compressedReq, nil
+}
+
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w)
+	case EncodingBrotli:
+		return brotli.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+func decodeResponse(resp *http.Response) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != EncodingGzip && encoding != EncodingZstd && encoding != EncodingBrotli {
+		return
+	}
+
+	if resp.Body == nil || resp.Body == http.NoBody || resp.ContentLength == 0 {
+		return
+	}
+
+	resp.Body = &decodingBody{body: resp.Body, encoding: encoding}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// decodingBody creates the decoder on the first Read, so that RoundTrip does not block on reading the body.
+type decodingBody struct {
+	body     io.ReadCloser
+	encoding string
+	reader   io.Reader
+	closer   func()
+	err      error
+}
+
+func (db *decodingBody) Read(p []byte) (int, error) {
+	if db.reader == nil && db.err == nil {
+		db.init()
+	}
+	if db.err != nil {
+		return 0, db.err
+	}
+
+	return db.reader.Read(p)
+}
+
+func (db *decodingBody) init() {
+	switch db.encoding {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(db.body)
+		db.reader, db.err = reader, err
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(db.body, zstd.WithDecoderConcurrency(1))
+		if err == nil {
+			db.reader, db.closer = decoder, decoder.Close
+		}
+		db.err = err
+	case EncodingBrotli:
+		db.reader = brotli.NewReader(db.body)
+	}
+}
+
+func (db *decodingBody) Close() error {
+	if db.closer != nil {
+		db.closer()
+	}
+
+	return db.body.Close()
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressionRoundTripperRequest(t *testing.T) {
+	compressible := strings.Repeat("compressible ", 1000)
+	incompressible := make([]byte, 4096)
+	_, _ = rand.Read(incompressible)
+
+	tests := []struct {
+		name         string
+		encoding     string
+		body         string
+		wantEncoding string
+	}{
+		{name: "gzip", encoding: EncodingGzip, body: compressible, wantEncoding: EncodingGzip},
+		{name: "zstd", encoding: EncodingZstd, body: compressible, wantEncoding: EncodingZstd},
+		{name: "br", encoding: EncodingBrotli, body: compressible, wantEncoding: EncodingBrotli},
+		{name: "below MinSize", encoding: EncodingGzip, body: "small"},
+		{name: "not smaller", encoding: EncodingGzip, body: string(incompressible)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotEncoding string
+			var gotBody []byte
+			var gotLength int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotEncoding = r.Header.Get("Content-Encoding")
+				gotLength = r.ContentLength
+				gotBody = decodeRequestBody(t, gotEncoding, r.Body)
+			}))
+			defer server.Close()
+
+			crt := NewCompressionRoundTripper(http.DefaultTransport, tt.encoding, 0)
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, stats := withCompressionStats(req)
+
+			resp, err := crt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			if gotEncoding != tt.wantEncoding || stats.Encoding != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, stats encoding = %q, want %q", gotEncoding, stats.Encoding, tt.wantEncoding)
+			}
+			if string(gotBody) != tt.body {
+				t.Fatalf("upstream got a body of %d bytes, want the original %d bytes", len(gotBody), len(tt.body))
+			}
+			if tt.wantEncoding == "" && gotLength != int64(len(tt.body)) {
+				t.Fatalf("Content-Length = %d, want the original %d", gotLength, len(tt.body))
+			}
+			if tt.wantEncoding != "" && (stats.OriginalSize != int64(len(tt.body)) || stats.CompressedSize != gotLength) {
+				t.Fatalf("stats = %+v, want %d bytes compressed to %d", stats, len(tt.body), gotLength)
+			}
+		})
+	}
+}
+
+func TestCompressionRoundTripperStreamedBody(t *testing.T) {
+	received := make(chan struct{})
+	var gotEncoding string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotEncoding = r.Header.Get("Content-Encoding")
+
+		first := make([]byte, len("first "))
+		if _, err := io.ReadFull(r.Body, first); err != nil {
+			t.Error(err)
+			return
+		}
+		close(received)
+
+		rest, _ := io.ReadAll(r.Body)
+		gotBody = append(first, rest...)
+	}))
+	defer server.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(pw, "first ")
+		// the rest is written only after the upstream got the first part, a buffered body never gets there
+		select {
+		case <-received:
+			_, _ = io.WriteString(pw, strings.Repeat("rest ", 1000))
+			_ = pw.Close()
+		case <-time.After(5 * time.Second):
+			_ = pw.CloseWithError(io.ErrUnexpectedEOF)
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crt := NewCompressionRoundTripper(http.DefaultTransport, EncodingGzip, 1)
+	resp, err := crt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if gotEncoding != "" {
+		t.Fatalf("streamed body sent with Content-Encoding %q, want it as is", gotEncoding)
+	}
+	if want := "first " + strings.Repeat("rest ", 1000); string(gotBody) != want {
+		t.Fatalf("upstream got %d bytes, want %d", len(gotBody), len(want))
+	}
+}
+
+func TestCompressionRoundTripperResponse(t *testing.T) {
+	const body = "decoded response body"
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd, EncodingBrotli} {
+		t.Run(encoding, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", encoding)
+				encoder, err := newEncoder(encoding, w)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, _ = io.WriteString(encoder, body)
+				_ = encoder.Close()
+			}))
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := NewCompressionRoundTripper(http.DefaultTransport, "", 0).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body || resp.Header.Get("Content-Encoding") != "" {
+				t.Fatalf("got %q with Content-Encoding %q, want %q decoded", got, resp.Header.Get("Content-Encoding"), body)
+			}
+		})
+	}
+}
+
+func decodeRequestBody(t *testing.T, encoding string, body io.Reader) []byte {
+	t.Helper()
+
+	var reader io.Reader
+	switch encoding {
+	case "":
+		reader = body
+	case EncodingGzip:
+		decoder, err := gzip.NewReader(body)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		reader = decoder
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(body)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		defer decoder.Close()
+		reader = decoder
+	case EncodingBrotli:
+		reader = brotli.NewReader(body)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, reader); err != nil {
+		t.Error(err)
+	}
+
+	return buf.Bytes()
+}
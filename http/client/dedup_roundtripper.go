@@ -0,0 +1,192 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+const defaultDedupMaxBodySize = 1 << 20
+
+// defaultDedupKeyHeaders are the request headers that may change the response.
+var defaultDedupKeyHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie"}
+
+// DedupRoundTripper is a http.RoundTripper that collapses identical concurrent GET and HEAD requests into one
+// upstream request. Requests are identical when they have the same method, URL and values of KeyHeaders.
+// The response body is read into memory and every waiter gets its own copy of the response, bodies larger
+// than MaxBodySize are not shared and the other waiters send their own requests.
+//
+// The shared request is not cancelled when the request that started it is, but it keeps its deadline.
+// A waiter whose context is done stops waiting, the other waiters send the request again when the
+// shared one ran out of the deadline of the request that started it.
+type DedupRoundTripper struct {
+	Proxied     http.RoundTripper
+	KeyHeaders  []string
+	MaxBodySize int64
+
+	group singleflight.Group
+
+	sharedCounter *prometheus.CounterVec
+}
+
+func NewDedupRoundTripper(proxied http.RoundTripper) *DedupRoundTripper {
+	drt := &DedupRoundTripper{
+		Proxied:     proxied,
+		KeyHeaders:  defaultDedupKeyHeaders,
+		MaxBodySize: defaultDedupMaxBodySize,
+	}
+	drt.initMetrics(nil)
+
+	return drt
+}
+
+// sharedResponse is a response with the body read into memory, tooLarge is set when the body is over MaxBodySize.
+type sharedResponse struct {
+	resp     *http.Response
+	body     []byte
+	tooLarge bool
+}
+
+func (drt *DedupRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != "") ||
+		(req.Body != nil && req.Body != http.NoBody) {
+		return drt.Proxied.RoundTrip(req)
+	}
+
+	var leader bool
+	var leaderResp *http.Response
+	ch := drt.group.DoChan(drt.key(req), func() (any, error) {
+		leader = true
+		shared, err := drt.fetch(req)
+		if err == nil && shared.tooLarge {
+			leaderResp = shared.resp
+		}
+		return shared, err
+	})
+
+	var result singleflight.Result
+	select {
+	case result = <-ch:
+	case <-req.Context().Done():
+		go func() {
+			// nobody else reads the unshared response of the leader
+			if result := <-ch; result.Err == nil && leader && leaderResp != nil {
+				_ = leaderResp.Body.Close()
+			}
+		}()
+		return nil, req.Context().Err()
+	}
+
+	if result.Err != nil {
+		if !leader && req.Context().Err() == nil && errors.Is(result.Err, context.DeadlineExceeded) {
+			return drt.RoundTrip(req)
+		}
+		return nil, result.Err
+	}
+
+	shared := result.Val.(*sharedResponse)
+	if shared.tooLarge {
+		if leader {
+			return leaderResp, nil
+		}
+		return drt.Proxied.RoundTrip(req)
+	}
+
+	if !leader {
+		drt.sharedCounter.WithLabelValues(req.URL.Host).Inc()
+	}
+
+	return shared.response(req), nil
+}
+
+// RegisterMetrics registers the metrics in registerer with the client label set to name, before the first request.
+func (drt *DedupRoundTripper) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	drt.initMetrics(prometheus.Labels{"client": name})
+	drt.sharedCounter = metrics.MustRegisterOrExisting(registerer, drt.sharedCounter)
+}
+
+func (drt *DedupRoundTripper) initMetrics(constLabels prometheus.Labels) {
+	drt.sharedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "http_client_dedup_shared_total",
+			Help:        "Total number of requests answered with the response of an identical concurrent request.",
+			ConstLabels: constLabels,
+		},
+		[]string{"host"},
+	)
+}
+
+func (drt *DedupRoundTripper) key(req *http.Request) string {
+	var key strings.Builder
+	key.WriteString(req.Method)
+	key.WriteString(" ")
+	key.WriteString(req.URL.String())
+	for _, name := range drt.KeyHeaders {
+		key.WriteString("\n")
+		key.WriteString(name)
+		key.WriteString(": ")
+		key.WriteString(strings.Join(req.Header.Values(name), ", "))
+	}
+
+	return key.String()
+}
+
+// fetch sends the shared request, the response of a body over MaxBodySize is returned unread.
+func (drt *DedupRoundTripper) fetch(req *http.Request) (*sharedResponse, error) {
+	ctx, cancel := context.WithoutCancel(req.Context()), context.CancelFunc(func() {})
+	if deadline, ok := req.Context().Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+
+	resp, err := drt.Proxied.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var body []byte
+	if resp.ContentLength <= drt.MaxBodySize {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, drt.MaxBodySize+1))
+		if err != nil {
+			_ = resp.Body.Close()
+			cancel()
+			return nil, err
+		}
+	}
+
+	if resp.ContentLength > drt.MaxBodySize || int64(len(body)) > drt.MaxBodySize {
+		// the part of the body already read goes in front of the rest
+		resp.Body = &releasingBody{
+			ReadCloser: struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body},
+			release: cancel,
+		}
+		return &sharedResponse{resp: resp, tooLarge: true}, nil
+	}
+
+	_ = resp.Body.Close()
+	cancel()
+
+	return &sharedResponse{resp: resp, body: body}, nil
+}
+
+func (s *sharedResponse) response(req *http.Request) *http.Response {
+	resp := *s.resp
+	resp.Header = s.resp.Header.Clone()
+	resp.Trailer = s.resp.Trailer.Clone()
+	resp.Body = io.NopCloser(bytes.NewReader(s.body))
+	resp.ContentLength = int64(len(s.body))
+	resp.Request = req
+
+	return &resp
+}
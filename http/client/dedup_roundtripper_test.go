@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newDedupServer answers every request with body after delay.
+func newDedupServer(t *testing.T, delay time.Duration, body string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		time.Sleep(delay)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+// sendConcurrently sends the requests at once and returns the bodies, or the errors, in the same order.
+func sendConcurrently(drt *DedupRoundTripper, reqs ...*http.Request) ([]string, []error) {
+	bodies := make([]string, len(reqs))
+	errs := make([]error, len(reqs))
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := drt.RoundTrip(req)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			bodies[i], errs[i] = string(body), err
+		}()
+	}
+	wg.Wait()
+
+	return bodies, errs
+}
+
+func TestDedupRoundTripperSharing(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		headers     []http.Header
+		maxBodySize int64
+		wantCalls   int32
+	}{
+		{name: "GET", method: http.MethodGet, wantCalls: 1},
+		{name: "POST", method: http.MethodPost, wantCalls: 4},
+		{name: "body over MaxBodySize", method: http.MethodGet, maxBodySize: 4, wantCalls: 4},
+		{
+			name:   "different key header",
+			method: http.MethodGet,
+			headers: []http.Header{
+				{"Authorization": {"Bearer a"}},
+				{"Authorization": {"Bearer b"}},
+				{"Authorization": {"Bearer a"}},
+				{"Authorization": {"Bearer b"}},
+			},
+			wantCalls: 2,
+		},
+		{
+			name:   "different other header",
+			method: http.MethodGet,
+			headers: []http.Header{
+				{"X-Request-Id": {"1"}},
+				{"X-Request-Id": {"2"}},
+				{"X-Request-Id": {"3"}},
+				{"X-Request-Id": {"4"}},
+			},
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const body = "shared body"
+			server, calls := newDedupServer(t, 100*time.Millisecond, body)
+
+			drt := NewDedupRoundTripper(http.DefaultTransport)
+			if tt.maxBodySize > 0 {
+				drt.MaxBodySize = tt.maxBodySize
+			}
+
+			reqs := make([]*http.Request, 4)
+			for i := range reqs {
+				req, err := http.NewRequest(tt.method, server.URL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.headers != nil {
+					req.Header = tt.headers[i]
+				}
+				reqs[i] = req
+			}
+
+			bodies, errs := sendConcurrently(drt, reqs...)
+			for i := range reqs {
+				if errs[i] != nil || bodies[i] != body {
+					t.Fatalf("request %d got %q, %v, want %q", i, bodies[i], errs[i], body)
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Fatalf("upstream got %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDedupRoundTripperResponseCopies(t *testing.T) {
+	server, _ := newDedupServer(t, 100*time.Millisecond, "body")
+	drt := NewDedupRoundTripper(http.DefaultTransport)
+
+	resps := make([]*http.Response, 2)
+	var wg sync.WaitGroup
+	for i := range resps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resps[i], err = drt.RoundTrip(req); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	// reading or changing one copy must not affect the other
+	if _, err := io.ReadAll(resps[0].Body); err != nil {
+		t.Fatal(err)
+	}
+	_ = resps[0].Body.Close()
+	resps[0].Header.Set("X-Changed", "1")
+
+	body, err := io.ReadAll(resps[1].Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resps[1].Body.Close()
+	if string(body) != "body" || resps[1].Header.Get("X-Changed") != "" {
+		t.Fatalf("second copy got body %q and headers %v", body, resps[1].Header)
+	}
+}
+
+func TestDedupRoundTripperLeaderDeadline(t *testing.T) {
+	server, _ := newDedupServer(t, 100*time.Millisecond, "body")
+	drt := NewDedupRoundTripper(http.DefaultTransport)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	leaderReq, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, errs := sendConcurrently(drt, leaderReq)
+		leaderErr <- errs[0]
+	}()
+	// the waiters without a deadline join the request of the leader
+	time.Sleep(5 * time.Millisecond)
+
+	reqs := make([]*http.Request, 9)
+	for i := range reqs {
+		if reqs[i], err = http.NewRequest(http.MethodGet, server.URL, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bodies, errs := sendConcurrently(drt, reqs...)
+	for i := range reqs {
+		if errs[i] != nil || bodies[i] != "body" {
+			t.Fatalf("waiter %d got %q, %v, want the body", i, bodies[i], errs[i])
+		}
+	}
+	if err := <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("leader error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDedupRoundTripperWaiterContext(t *testing.T) {
+	server, _ := newDedupServer(t, 100*time.Millisecond, "body")
+	drt := NewDedupRoundTripper(http.DefaultTransport)
+
+	leaderReq, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderBody := make(chan string, 1)
+	go func() {
+		bodies, _ := sendConcurrently(drt, leaderReq)
+		leaderBody <- bodies[0]
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := drt.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("waiter error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Fatalf("waiter waited %v for the shared request", elapsed)
+	}
+	if got := <-leaderBody; got != "body" {
+		t.Fatalf("leader body = %q, want %q", got, "body")
+	}
+}
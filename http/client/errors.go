@@ -1,20 +1,144 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"time"
 )
 
+// Sentinel errors per status class, ClientResponseNot200Error wraps one of them.
+var (
+	ErrClientError      = errors.New("client error response")
+	ErrServerError      = errors.New("server error response")
+	ErrUnexpectedStatus = errors.New("unexpected response status code")
+)
+
+// ClientResponseNot200Error is returned when the response status code is not accepted by the client.
 type ClientResponseNot200Error struct {
-	ClientResponseCode int
-	ClientResponseBody string
-	Err                error
+	ClientResponseCode   int
+	ClientResponseBody   string
+	ClientResponseDTO    any
+	ClientResponseHeader http.Header
+	Method               string
+	URL                  string
+	// Problem is set when the response is an application/problem+json document (RFC 9457).
+	Problem *ProblemDetails
+	Err     error
 }
 
 func (e *ClientResponseNot200Error) Error() string {
 	mess := fmt.Sprintf("ClientResponseNot200Error: code: %d, message: %s", e.ClientResponseCode, e.ClientResponseBody)
+	if e.Method != "" || e.URL != "" {
+		mess += fmt.Sprintf(", request: %s %s", e.Method, e.URL)
+	}
 	if e.Err != nil {
 		mess += "; error: " + e.Err.Error()
 	}
 
 	return mess
 }
+
+func (e *ClientResponseNot200Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *ClientResponseNot200Error) IsNotFound() bool {
+	return e.ClientResponseCode == http.StatusNotFound
+}
+
+func (e *ClientResponseNot200Error) IsClientError() bool {
+	return e.ClientResponseCode >= 400 && e.ClientResponseCode < 500
+}
+
+func (e *ClientResponseNot200Error) IsServerError() bool {
+	return e.ClientResponseCode >= 500 && e.ClientResponseCode < 600
+}
+
+// IsRetryable reports whether repeating the same request may succeed.
+func (e *ClientResponseNot200Error) IsRetryable() bool {
+	return e.ClientResponseCode == http.StatusRequestTimeout || slices.Contains(defaultRetryStatusCodes, e.ClientResponseCode)
+}
+
+// ProblemDetails is an error response body defined by RFC 9457.
+type ProblemDetails struct {
+	Type       string         `json:"type,omitempty"`
+	Title      string         `json:"title,omitempty"`
+	Status     int            `json:"status,omitempty"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+func statusClassError(code int) error {
+	switch {
+	case code >= 400 && code < 500:
+		return ErrClientError
+	case code >= 500 && code < 600:
+		return ErrServerError
+	default:
+		return ErrUnexpectedStatus
+	}
+}
+
+// CircuitOpenError is returned by CircuitBreakerRoundTripper when the circuit for the host is open.
+type CircuitOpenError struct {
+	Host       string
+	HalfOpen   bool
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.HalfOpen {
+		return fmt.Sprintf("CircuitOpenError: host: %s, circuit is half-open, probe limit reached", e.Host)
+	}
+
+	return fmt.Sprintf("CircuitOpenError: host: %s, circuit is open, retry after: %s", e.Host, e.RetryAfter)
+}
+
+// RateLimitedError is returned by RateLimitRoundTripper when a request can not get a token in time.
+type RateLimitedError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("RateLimitedError: key: %s, retry after: %s", e.Key, e.RetryAfter)
+}
+
+// BulkheadFullError is returned by BulkheadRoundTripper when a request can not get a slot:
+// the queue is full or the wait in the queue timed out.
+type BulkheadFullError struct {
+	Key          string
+	Limit        int
+	QueueTimeout bool
+}
+
+func (e *BulkheadFullError) Error() string {
+	if e.QueueTimeout {
+		return fmt.Sprintf("BulkheadFullError: key: %s, limit: %d, queue timeout", e.Key, e.Limit)
+	}
+
+	return fmt.Sprintf("BulkheadFullError: key: %s, limit: %d, queue is full", e.Key, e.Limit)
+}
+
+// TokenError is returned when the OAuth2 token endpoint rejects the token request.
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+	Body        string
+}
+
+func (e *TokenError) Error() string {
+	mess := fmt.Sprintf("TokenError: code: %d", e.StatusCode)
+	if e.Code != "" {
+		mess += ", error: " + e.Code
+	}
+	if e.Description != "" {
+		mess += ", description: " + e.Description
+	}
+
+	return mess
+}
@@ -0,0 +1,284 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+const (
+	defaultHedgingMaxAttempts = 2
+	defaultHedgingDelay       = 100 * time.Millisecond
+
+	hedgingLatencyWindow     = 128
+	hedgingMinLatencySamples = 20
+)
+
+// HedgingRoundTripper is a http.RoundTripper that cuts tail latency of safe requests: when there is no
+// response after Delay it sends another copy of the request, up to MaxAttempts copies in total. The first
+// successful response (no error and a status below 500) is returned and the other copies are cancelled.
+// A failed copy starts the next one right away; when all of them fail the last result is returned.
+//
+// With Percentile (e.g. 0.95) the delay is that percentile of the recently observed latencies of the host,
+// Delay is used until enough of them are collected.
+//
+// Only GET, HEAD and OPTIONS requests are hedged. HedgeIdempotent also hedges the other idempotent requests
+// (PUT, DELETE and requests with an Idempotency-Key), the upstream then gets concurrent copies of the write
+// and the response of any of them may be returned, e.g. 404 of a second DELETE instead of 204 of the first.
+// Other requests, and requests whose body can not be rewound through http.Request.GetBody, are sent once.
+type HedgingRoundTripper struct {
+	Proxied         http.RoundTripper
+	MaxAttempts     int
+	Delay           time.Duration
+	Percentile      float64
+	KeyFunc         func(req *http.Request) string
+	HedgeIdempotent bool
+
+	mu        sync.Mutex
+	latencies map[string]*latencyWindow
+
+	hedgedCounter *prometheus.CounterVec
+}
+
+func NewHedgingRoundTripper(proxied http.RoundTripper, delay time.Duration) *HedgingRoundTripper {
+	if delay <= 0 {
+		delay = defaultHedgingDelay
+	}
+
+	hrt := &HedgingRoundTripper{
+		Proxied:     proxied,
+		MaxAttempts: defaultHedgingMaxAttempts,
+		Delay:       delay,
+		latencies:   make(map[string]*latencyWindow),
+	}
+	hrt.initMetrics(nil)
+
+	return hrt
+}
+
+type hedgeResult struct {
+	index   int
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+	latency time.Duration
+}
+
+func (hrt *HedgingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if hrt.MaxAttempts < 2 || !hrt.hedgeable(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return hrt.Proxied.RoundTrip(req)
+	}
+
+	key := hrt.key(req)
+	delay := hrt.delay(key)
+
+	results := make(chan hedgeResult, hrt.MaxAttempts)
+	cancels := make([]context.CancelFunc, 0, hrt.MaxAttempts)
+	launched, pending := 0, 0
+	launch := func() error {
+		ctx, cancel := context.WithCancel(req.Context())
+		attemptReq := req.Clone(ctx)
+		if launched > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return err
+			}
+			attemptReq.Body = body
+		}
+		index := launched
+		cancels = append(cancels, cancel)
+		launched++
+		pending++
+
+		go func() {
+			start := time.Now()
+			resp, err := hrt.Proxied.RoundTrip(attemptReq)
+			results <- hedgeResult{index: index, resp: resp, err: err, cancel: cancel, latency: time.Since(start)}
+		}()
+
+		return nil
+	}
+
+	if err := launch(); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	for pending > 0 {
+		var hedge <-chan time.Time
+		if launched < hrt.MaxAttempts {
+			hedge = timer.C
+		}
+
+		select {
+		case <-hedge:
+			if err := launch(); err == nil {
+				hrt.hedgedCounter.WithLabelValues(key).Inc()
+			}
+			timer.Reset(delay)
+
+		case result := <-results:
+			pending--
+
+			if result.err == nil && result.resp.StatusCode < http.StatusInternalServerError {
+				hrt.observe(key, result.latency)
+				for i, cancel := range cancels {
+					if i != result.index {
+						cancel()
+					}
+				}
+				go discardHedges(results, pending)
+				return withCancelOnClose(result), nil
+			}
+
+			if last.cancel != nil {
+				discardHedge(last)
+			}
+			last = result
+
+			if launched < hrt.MaxAttempts && req.Context().Err() == nil {
+				if err := launch(); err == nil {
+					hrt.hedgedCounter.WithLabelValues(key).Inc()
+				}
+				timer.Reset(delay)
+			}
+		}
+	}
+
+	if last.err != nil {
+		last.cancel()
+		return nil, last.err
+	}
+
+	return withCancelOnClose(last), nil
+}
+
+// RegisterMetrics registers the metrics in registerer with the client label set to name, before the first request.
+func (hrt *HedgingRoundTripper) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	hrt.initMetrics(prometheus.Labels{"client": name})
+	hrt.hedgedCounter = metrics.MustRegisterOrExisting(registerer, hrt.hedgedCounter)
+}
+
+func (hrt *HedgingRoundTripper) initMetrics(constLabels prometheus.Labels) {
+	hrt.hedgedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "http_client_hedged_requests_total",
+			Help:        "Total number of hedged copies of requests sent.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+}
+
+func (hrt *HedgingRoundTripper) hedgeable(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return hrt.HedgeIdempotent && isIdempotent(req)
+}
+
+func (hrt *HedgingRoundTripper) key(req *http.Request) string {
+	if hrt.KeyFunc != nil {
+		return hrt.KeyFunc(req)
+	}
+
+	return req.URL.Host
+}
+
+func (hrt *HedgingRoundTripper) delay(key string) time.Duration {
+	if hrt.Percentile <= 0 {
+		return hrt.Delay
+	}
+
+	hrt.mu.Lock()
+	defer hrt.mu.Unlock()
+
+	window, ok := hrt.latencies[key]
+	if !ok || len(window.samples) < hedgingMinLatencySamples {
+		return hrt.Delay
+	}
+
+	return window.percentile(hrt.Percentile)
+}
+
+func (hrt *HedgingRoundTripper) observe(key string, latency time.Duration) {
+	if hrt.Percentile <= 0 {
+		return
+	}
+
+	hrt.mu.Lock()
+	defer hrt.mu.Unlock()
+
+	if hrt.latencies == nil {
+		hrt.latencies = make(map[string]*latencyWindow)
+	}
+
+	window, ok := hrt.latencies[key]
+	if !ok {
+		window = &latencyWindow{}
+		hrt.latencies[key] = window
+	}
+	window.add(latency)
+}
+
+// withCancelOnClose keeps the context of the winning copy alive until its body is read or closed.
+func withCancelOnClose(result hedgeResult) *http.Response {
+	resp := result.resp
+	if resp.Body == nil || resp.Body == http.NoBody {
+		result.cancel()
+	} else {
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: result.cancel}
+	}
+
+	return resp
+}
+
+// discardHedges releases the responses of the cancelled copies.
+func discardHedges(results <-chan hedgeResult, pending int) {
+	for range pending {
+		discardHedge(<-results)
+	}
+}
+
+func discardHedge(result hedgeResult) {
+	result.cancel()
+	if result.resp != nil {
+		_ = result.resp.Body.Close()
+	}
+}
+
+// latencyWindow keeps the last hedgingLatencyWindow latencies.
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < hedgingLatencyWindow {
+		w.samples = append(w.samples, latency)
+		return
+	}
+
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % hedgingLatencyWindow
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	sorted := slices.Clone(w.samples)
+	slices.Sort(sorted)
+
+	index := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(index, 0), len(sorted)-1)]
+}
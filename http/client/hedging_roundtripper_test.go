@@ -0,0 +1,170 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type hedgeReply struct {
+	delay  time.Duration
+	status int
+	body   string
+}
+
+// newHedgeServer answers the n-th request with replies[n], the last reply is repeated.
+func newHedgeServer(t *testing.T, replies ...hedgeReply) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		reply := replies[min(n, len(replies))-1]
+
+		select {
+		case <-time.After(reply.delay):
+		case <-r.Context().Done():
+			return
+		}
+
+		w.WriteHeader(reply.status)
+		_, _ = io.WriteString(w, reply.body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &calls
+}
+
+func TestHedgingRoundTripperMethods(t *testing.T) {
+	tests := []struct {
+		name            string
+		method          string
+		header          string
+		hedgeIdempotent bool
+		wantCalls       int32
+	}{
+		{name: "GET", method: http.MethodGet, wantCalls: 2},
+		{name: "HEAD", method: http.MethodHead, wantCalls: 2},
+		{name: "OPTIONS", method: http.MethodOptions, wantCalls: 2},
+		{name: "PUT", method: http.MethodPut, wantCalls: 1},
+		{name: "DELETE", method: http.MethodDelete, wantCalls: 1},
+		{name: "POST with Idempotency-Key", method: http.MethodPost, header: "Idempotency-Key", wantCalls: 1},
+		{name: "PUT with HedgeIdempotent", method: http.MethodPut, hedgeIdempotent: true, wantCalls: 2},
+		{name: "DELETE with HedgeIdempotent", method: http.MethodDelete, hedgeIdempotent: true, wantCalls: 2},
+		{name: "POST with Idempotency-Key and HedgeIdempotent", method: http.MethodPost, header: "Idempotency-Key", hedgeIdempotent: true, wantCalls: 2},
+		{name: "POST with HedgeIdempotent", method: http.MethodPost, hedgeIdempotent: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := newHedgeServer(t,
+				hedgeReply{delay: 200 * time.Millisecond, status: http.StatusOK},
+				hedgeReply{status: http.StatusOK},
+			)
+
+			hrt := NewHedgingRoundTripper(http.DefaultTransport, 10*time.Millisecond)
+			hrt.HedgeIdempotent = tt.hedgeIdempotent
+
+			req, err := http.NewRequest(tt.method, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set(tt.header, "key")
+			}
+
+			resp, err := hrt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Fatalf("upstream got %d copies of %s, want %d", got, tt.name, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestHedgingRoundTripperWinner(t *testing.T) {
+	tests := []struct {
+		name       string
+		replies    []hedgeReply
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "faster copy",
+			replies: []hedgeReply{
+				{delay: time.Second, status: http.StatusOK, body: "first"},
+				{status: http.StatusOK, body: "second"},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "second",
+		},
+		{
+			name: "client error of the faster copy",
+			replies: []hedgeReply{
+				{delay: time.Second, status: http.StatusOK, body: "first"},
+				{status: http.StatusNotFound, body: "second"},
+			},
+			wantStatus: http.StatusNotFound,
+			wantBody:   "second",
+		},
+		{
+			name: "server error of the faster copy",
+			replies: []hedgeReply{
+				{delay: 100 * time.Millisecond, status: http.StatusOK, body: "first"},
+				{status: http.StatusBadGateway, body: "second"},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "first",
+		},
+		{
+			name: "failed first copy",
+			replies: []hedgeReply{
+				{status: http.StatusServiceUnavailable, body: "first"},
+				{status: http.StatusOK, body: "second"},
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "second",
+		},
+		{
+			name: "all copies failed",
+			replies: []hedgeReply{
+				{delay: 100 * time.Millisecond, status: http.StatusServiceUnavailable, body: "first"},
+				{status: http.StatusBadGateway, body: "second"},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newHedgeServer(t, tt.replies...)
+			hrt := NewHedgingRoundTripper(http.DefaultTransport, 10*time.Millisecond)
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := hrt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || strings.TrimSpace(string(body)) != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxResponseBodySize is the default limit of a response body read by the JSON helpers.
+const DefaultMaxResponseBodySize int64 = 10 << 20
+
+var ErrResponseBodyTooLarge = errors.New("response body is too large")
+
+type jsonOptions struct {
+	errorDTO        any
+	maxResponseSize int64
+}
+
+type JSONOption func(*jsonOptions)
+
+// WithErrorDTO decodes the body of an error response into dto (a pointer)
+// and stores it in ClientResponseNot200Error.ClientResponseDTO.
+func WithErrorDTO(dto any) JSONOption {
+	return func(o *jsonOptions) {
+		o.errorDTO = dto
+	}
+}
+
+// WithMaxResponseSize limits how many bytes of a successful response body are read.
+func WithMaxResponseSize(size int64) JSONOption {
+	return func(o *jsonOptions) {
+		o.maxResponseSize = size
+	}
+}
+
+func GetJSON[Out any](ctx context.Context, c *Client, endpoint string, in interface{}, headers map[string]string, opts ...JSONOption) (Out, error) {
+	resp, err := c.Get(ctx, endpoint, in, headers)
+	return decodeJSONResponse[Out](resp, err, opts)
+}
+
+func DeleteJSON[Out any](ctx context.Context, c *Client, endpoint string, in interface{}, headers map[string]string, opts ...JSONOption) (Out, error) {
+	resp, err := c.Delete(ctx, endpoint, in, headers)
+	return decodeJSONResponse[Out](resp, err, opts)
+}
+
+func PostJSON[In, Out any](ctx context.Context, c *Client, endpoint string, body In, headers map[string]string, opts ...JSONOption) (Out, error) {
+	resp, err := c.Post(ctx, endpoint, body, headers)
+	return decodeJSONResponse[Out](resp, err, opts)
+}
+
+func PutJSON[In, Out any](ctx context.Context, c *Client, endpoint string, body In, headers map[string]string, opts ...JSONOption) (Out, error) {
+	resp, err := c.Put(ctx, endpoint, body, headers)
+	return decodeJSONResponse[Out](resp, err, opts)
+}
+
+func decodeJSONResponse[Out any](resp *http.Response, err error, opts []JSONOption) (Out, error) {
+	var out Out
+
+	o := jsonOptions{maxResponseSize: DefaultMaxResponseBodySize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if err != nil {
+		var not200Err *ClientResponseNot200Error
+		if o.errorDTO != nil && errors.As(err, &not200Err) && not200Err.ClientResponseBody != "" {
+			if json.Unmarshal([]byte(not200Err.ClientResponseBody), o.errorDTO) == nil {
+				not200Err.ClientResponseDTO = o.errorDTO
+			}
+		}
+
+		return out, err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, o.maxResponseSize+1))
+	if err != nil {
+		return out, err
+	}
+
+	if int64(len(body)) > o.maxResponseSize {
+		return out, fmt.Errorf("%w: limit is %d bytes", ErrResponseBodyTooLarge, o.maxResponseSize)
+	}
+
+	if len(body) == 0 {
+		return out, nil
+	}
+
+	if err := json.Unmarshal(body, &out); err != nil {
+		return out, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type jsonUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type jsonErrorDTO struct {
+	Code string `json:"code"`
+}
+
+func TestGetJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		opts        []JSONOption
+		want        jsonUser
+		wantErr     error
+		wantErrCode string
+	}{
+		{name: "decoded", status: http.StatusOK, body: `{"id":7,"name":"john"}`, want: jsonUser{ID: 7, Name: "john"}},
+		{name: "empty body", status: http.StatusNoContent},
+		{name: "body over the limit", status: http.StatusOK, body: `{"id":7,"name":"john"}`, opts: []JSONOption{WithMaxResponseSize(10)}, wantErr: ErrResponseBodyTooLarge},
+		{name: "body at the limit", status: http.StatusOK, body: `{"id":7}`, opts: []JSONOption{WithMaxResponseSize(8)}, want: jsonUser{ID: 7}},
+		{name: "error DTO", status: http.StatusNotFound, body: `{"code":"not_found"}`, opts: []JSONOption{WithErrorDTO(&jsonErrorDTO{})}, wantErr: ErrClientError, wantErrCode: "not_found"},
+		{name: "error without DTO", status: http.StatusBadGateway, body: `{"code":"down"}`, wantErr: ErrServerError},
+		{name: "error DTO of a non-JSON body", status: http.StatusInternalServerError, body: `oops`, opts: []JSONOption{WithErrorDTO(&jsonErrorDTO{})}, wantErr: ErrServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.RequestURI() != "/users?id=7" {
+					t.Errorf("request URI = %s, want /users?id=7", r.URL.RequestURI())
+				}
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			c, err := New(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := GetJSON[jsonUser](context.Background(), c, "/users", struct{ ID int }{ID: 7}, nil, tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetJSON() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("GetJSON() = %+v, want %+v", got, tt.want)
+			}
+
+			var not200Err *ClientResponseNot200Error
+			if !errors.As(err, &not200Err) {
+				return
+			}
+			if not200Err.ClientResponseBody != tt.body {
+				t.Fatalf("error body = %q, want %q", not200Err.ClientResponseBody, tt.body)
+			}
+			dto, _ := not200Err.ClientResponseDTO.(*jsonErrorDTO)
+			if (dto == nil) != (tt.wantErrCode == "") || (dto != nil && dto.Code != tt.wantErrCode) {
+				t.Fatalf("error DTO = %+v, want code %q", not200Err.ClientResponseDTO, tt.wantErrCode)
+			}
+		})
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Tenant") != "acme" {
+			t.Errorf("got %s with Content-Type %q and X-Tenant %q", r.Method, r.Header.Get("Content-Type"), r.Header.Get("X-Tenant"))
+		}
+
+		var user jsonUser
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			t.Errorf("decode request body: %v", err)
+		}
+		user.ID = 7
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(user)
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := PostJSON[jsonUser, jsonUser](context.Background(), c, "/users", jsonUser{Name: "john"}, map[string]string{"X-Tenant": "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (jsonUser{ID: 7, Name: "john"}) {
+		t.Fatalf("PostJSON() = %+v, want the created user", got)
+	}
+}
+
+func TestJSONHelpersCloseBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "success", status: http.StatusOK, body: `{"id":7}`},
+		{name: "invalid JSON", status: http.StatusOK, body: `{"id":`},
+		{name: "body over the limit", status: http.StatusOK, body: strings.Repeat(" ", 100)},
+		{name: "error", status: http.StatusConflict, body: `{"code":"conflict"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &closeTrackingBody{Reader: strings.NewReader(tt.body)}
+			c, err := New("http://users.local", WithTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: tt.status, Header: http.Header{}, Body: body, Request: req}, nil
+			})))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _ = GetJSON[jsonUser](context.Background(), c, "/users", nil, nil, WithMaxResponseSize(50))
+			if !body.closed {
+				t.Fatal("response body is not closed")
+			}
+		})
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// closeTrackingBody reports whether the response body was closed.
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
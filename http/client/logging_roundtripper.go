@@ -2,61 +2,224 @@ package client
 
 import (
 	"bytes"
-	"go.uber.org/zap"
+	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
+	"github.com/viktor8881/service-utilities/internal/redact"
 )
 
+const defaultMaxLoggedBodySize = 4 << 10
+
+// defaultRedactHeaders are masked in logs unless RedactHeaders is changed.
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
 // LoggingRoundTripper is a http.RoundTripper that logs requests and responses
+//
+// Every request and transport error is logged, responses only with TurnOnAll. With LogFailures 4xx and 5xx
+// responses are logged without TurnOnAll too. Each outcome is logged at its own level, Info by default.
+// Headers listed in RedactHeaders and JSON body fields listed in RedactBodyFields (paths like "user.password",
+// "items.*.token") are masked, bodies are cut to MaxBodySize. A request body is logged only if it can be
+// rewound through http.Request.GetBody, so streamed bodies are left untouched. With LogResponseBody the
+// response body is copied while the caller reads it and the response is logged when the body is closed.
+//
+// SuccessSampleEvery > 1 logs only every n-th request unless it fails.
+// The request ID stored with correlation.WithRequestID is logged as requestID.
 type LoggingRoundTripper struct {
 	Proxied   http.RoundTripper
 	Logger    *zap.Logger
 	TurnOnAll bool
+
+	RedactHeaders    []string
+	RedactBodyFields []string
+	MaxBodySize      int
+	LogResponseBody  bool
+	LogFailures      bool
+
+	RequestLevel        zapcore.Level
+	SuccessLevel        zapcore.Level
+	ClientErrorLevel    zapcore.Level
+	ServerErrorLevel    zapcore.Level
+	TransportErrorLevel zapcore.Level
+
+	SuccessSampleEvery uint64
+	requestCount       atomic.Uint64
 }
 
 func NewLoggingRoundTripper(proxied http.RoundTripper, logger *zap.Logger, turnOnAll bool) *LoggingRoundTripper {
 	return &LoggingRoundTripper{
-		Proxied:   proxied,
-		Logger:    logger,
-		TurnOnAll: turnOnAll,
+		Proxied:             proxied,
+		Logger:              logger,
+		TurnOnAll:           turnOnAll,
+		RedactHeaders:       defaultRedactHeaders,
+		MaxBodySize:         defaultMaxLoggedBodySize,
+		RequestLevel:        zapcore.InfoLevel,
+		SuccessLevel:        zapcore.InfoLevel,
+		ClientErrorLevel:    zapcore.InfoLevel,
+		ServerErrorLevel:    zapcore.InfoLevel,
+		TransportErrorLevel: zapcore.InfoLevel,
 	}
 }
 
 func (lrt *LoggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	start := time.Now()
+	sampled := lrt.SuccessSampleEvery <= 1 || lrt.requestCount.Add(1)%lrt.SuccessSampleEvery == 1
 
-	var requestBody []byte
-	if req.Body != nil {
-		requestBody, _ = io.ReadAll(req.Body)
-		req.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	fields := []zap.Field{
+		zap.String("url", req.Method+": "+req.URL.String()),
+		zap.Any("requestHeaders", redact.Header(req.Header, lrt.RedactHeaders)),
+		zap.String("requestBody", lrt.requestBody(req)),
+	}
+	if requestID := correlation.RequestIDFromContext(req.Context()); requestID != "" {
+		fields = append(fields, zap.String("requestID", requestID))
+	}
+	if attempt := RetryAttemptFromContext(req.Context()); attempt > 0 {
+		fields = append(fields, zap.Int("attempt", attempt))
 	}
 
-	lrt.Logger.Info("httpclient: send request",
-		zap.String("url", req.Method+": "+req.URL.String()),
-		zap.String("requestBody", string(requestBody)),
-	)
+	if sampled {
+		lrt.Logger.Log(lrt.RequestLevel, "httpclient: send request", fields...)
+	}
 
 	resp, err := lrt.Proxied.RoundTrip(req)
 	if err != nil {
-		lrt.Logger.Info("httpclient: request error",
-			zap.String("url", req.Method+": "+req.URL.String()),
-			zap.String("requestBody", string(requestBody)),
-			zap.Error(err),
-		)
+		lrt.Logger.Log(lrt.TransportErrorLevel, "httpclient: request error", append(fields, zap.Error(err))...)
 
 		return nil, err
 	}
 
-	if lrt.TurnOnAll {
-		duration := time.Since(start)
-		lrt.Logger.Info("httpclient: request processed",
-			zap.String("url", req.Method+": "+req.URL.String()),
-			zap.String("requestBody", string(requestBody)),
-			zap.String("StatusResponse", resp.Status),
-			zap.Duration("Duration", duration),
-		)
+	level, failed := lrt.SuccessLevel, resp.StatusCode >= 400
+	switch {
+	case resp.StatusCode >= 500:
+		level = lrt.ServerErrorLevel
+	case resp.StatusCode >= 400:
+		level = lrt.ClientErrorLevel
+	}
+
+	if !(lrt.TurnOnAll && (sampled || failed)) && !(lrt.LogFailures && failed) {
+		return resp, nil
+	}
+
+	duration := time.Since(start)
+	fields = append(fields,
+		zap.String("StatusResponse", resp.Status),
+		zap.Duration("Duration", duration),
+		zap.Any("responseHeaders", redact.Header(resp.Header, lrt.RedactHeaders)),
+	)
+	if cacheStatus := resp.Header.Get(CacheStatusHeader); cacheStatus != "" {
+		fields = append(fields, zap.String("cache", cacheStatus))
+	}
+
+	if !lrt.LogResponseBody || resp.Body == nil || resp.Body == http.NoBody {
+		lrt.Logger.Log(level, "httpclient: request processed", fields...)
+		return resp, nil
+	}
+
+	resp.Body = &teeBody{
+		ReadCloser: resp.Body,
+		limit:      lrt.maxBodySize(),
+		onDone: func(body []byte, truncated bool) {
+			lrt.Logger.Log(level, "httpclient: request processed",
+				append(fields, zap.String("responseBody", lrt.formatBody(body, truncated)))...)
+		},
 	}
 
 	return resp, nil
 }
+
+func (lrt *LoggingRoundTripper) requestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+
+	if req.GetBody == nil {
+		return "[body is a stream]"
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return "[body is unavailable]"
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	limit := lrt.maxBodySize()
+	data, _ := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	truncated := len(data) > limit
+	if truncated {
+		data = data[:limit]
+	}
+
+	return lrt.formatBody(data, truncated)
+}
+
+func (lrt *LoggingRoundTripper) formatBody(body []byte, truncated bool) string {
+	if len(lrt.RedactBodyFields) > 0 {
+		if truncated {
+			// a cut JSON document can not be redacted reliably
+			return fmt.Sprintf("[body is larger than %d bytes]", lrt.maxBodySize())
+		}
+		body, _ = redact.JSONFields(body, lrt.RedactBodyFields)
+	}
+
+	if truncated {
+		return string(body) + "...[truncated]"
+	}
+
+	return string(body)
+}
+
+func (lrt *LoggingRoundTripper) maxBodySize() int {
+	if lrt.MaxBodySize <= 0 {
+		return defaultMaxLoggedBodySize
+	}
+
+	return lrt.MaxBodySize
+}
+
+// teeBody keeps the first limit bytes of the body while it is read and calls onDone on EOF or Close.
+type teeBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	once      sync.Once
+	onDone    func(body []byte, truncated bool)
+}
+
+func (tb *teeBody) Read(p []byte) (int, error) {
+	n, err := tb.ReadCloser.Read(p)
+	if n > 0 {
+		if tb.buf.Len()+n > tb.limit {
+			tb.truncated = true
+		}
+		if free := tb.limit - tb.buf.Len(); free > 0 {
+			tb.buf.Write(p[:min(n, free)])
+		}
+	}
+
+	if err == io.EOF {
+		tb.done()
+	}
+
+	return n, err
+}
+
+func (tb *teeBody) Close() error {
+	tb.done()
+	return tb.ReadCloser.Close()
+}
+
+func (tb *teeBody) done() {
+	tb.once.Do(func() {
+		tb.onDone(tb.buf.Bytes(), tb.truncated)
+	})
+}
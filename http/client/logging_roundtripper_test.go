@@ -0,0 +1,170 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type loggedEntry struct {
+	level   zapcore.Level
+	message string
+}
+
+func TestLoggingRoundTripperDefaults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		url       string
+		turnOnAll bool
+		want      []loggedEntry
+	}{
+		{
+			name: "success",
+			url:  server.URL + "/",
+			want: []loggedEntry{{zapcore.InfoLevel, "httpclient: send request"}},
+		},
+		{
+			name: "client error",
+			url:  server.URL + "/not-found",
+			want: []loggedEntry{{zapcore.InfoLevel, "httpclient: send request"}},
+		},
+		{
+			name: "server error",
+			url:  server.URL + "/error",
+			want: []loggedEntry{{zapcore.InfoLevel, "httpclient: send request"}},
+		},
+		{
+			name: "transport error",
+			url:  "http://127.0.0.1:1/",
+			want: []loggedEntry{
+				{zapcore.InfoLevel, "httpclient: send request"},
+				{zapcore.InfoLevel, "httpclient: request error"},
+			},
+		},
+		{
+			name:      "server error with TurnOnAll",
+			url:       server.URL + "/error",
+			turnOnAll: true,
+			want: []loggedEntry{
+				{zapcore.InfoLevel, "httpclient: send request"},
+				{zapcore.InfoLevel, "httpclient: request processed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			lrt := NewLoggingRoundTripper(http.DefaultTransport, zap.New(core), tt.turnOnAll)
+
+			roundTripLogged(t, lrt, tt.url)
+
+			assertLogged(t, logs, tt.want)
+		})
+	}
+}
+
+func TestLoggingRoundTripperLevels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/not-found":
+			w.WriteHeader(http.StatusNotFound)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want []loggedEntry
+	}{
+		{
+			name: "success",
+			url:  server.URL + "/",
+			want: []loggedEntry{{zapcore.DebugLevel, "httpclient: send request"}},
+		},
+		{
+			name: "client error",
+			url:  server.URL + "/not-found",
+			want: []loggedEntry{
+				{zapcore.DebugLevel, "httpclient: send request"},
+				{zapcore.WarnLevel, "httpclient: request processed"},
+			},
+		},
+		{
+			name: "server error",
+			url:  server.URL + "/error",
+			want: []loggedEntry{
+				{zapcore.DebugLevel, "httpclient: send request"},
+				{zapcore.ErrorLevel, "httpclient: request processed"},
+			},
+		},
+		{
+			name: "transport error",
+			url:  "http://127.0.0.1:1/",
+			want: []loggedEntry{
+				{zapcore.DebugLevel, "httpclient: send request"},
+				{zapcore.ErrorLevel, "httpclient: request error"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			lrt := NewLoggingRoundTripper(http.DefaultTransport, zap.New(core), false)
+			lrt.LogFailures = true
+			lrt.RequestLevel = zapcore.DebugLevel
+			lrt.ClientErrorLevel = zapcore.WarnLevel
+			lrt.ServerErrorLevel = zapcore.ErrorLevel
+			lrt.TransportErrorLevel = zapcore.ErrorLevel
+
+			roundTripLogged(t, lrt, tt.url)
+
+			assertLogged(t, logs, tt.want)
+		})
+	}
+}
+
+func roundTripLogged(t *testing.T, lrt *LoggingRoundTripper, url string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, err := lrt.RoundTrip(req); err == nil {
+		_ = resp.Body.Close()
+	}
+}
+
+func assertLogged(t *testing.T, logs *observer.ObservedLogs, want []loggedEntry) {
+	t.Helper()
+
+	var got []loggedEntry
+	for _, entry := range logs.All() {
+		got = append(got, loggedEntry{level: entry.Level, message: entry.Message})
+	}
+
+	if !slices.Equal(got, want) {
+		t.Fatalf("logged %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTokenRequestTimeout = 30 * time.Second
+
+// Token is an OAuth2 access token.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is zero when the token does not expire.
+	Expiry time.Time
+}
+
+// validFor reports whether the token is still valid after delta.
+func (t *Token) validFor(delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry)
+}
+
+// TokenSource returns an access token.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// ClientCredentialsSource fetches tokens with the OAuth2 client credentials grant (RFC 6749, section 4.4).
+type ClientCredentialsSource struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values
+	// HTTPClient is used to call TokenURL, a client with a 30s timeout by default.
+	HTTPClient *http.Client
+}
+
+func NewClientCredentialsSource(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentialsSource {
+	return &ClientCredentialsSource{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}
+}
+
+func (s *ClientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	values := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.Scopes) > 0 {
+		values.Set("scope", strings.Join(s.Scopes, " "))
+	}
+	for key, params := range s.EndpointParams {
+		values[key] = params
+	}
+
+	return requestToken(ctx, s.HTTPClient, s.TokenURL, s.ClientID, s.ClientSecret, values)
+}
+
+// RefreshTokenSource fetches tokens with the OAuth2 refresh token grant (RFC 6749, section 6).
+// A refresh token rotated by the server replaces the current one.
+type RefreshTokenSource struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func NewRefreshTokenSource(tokenURL, clientID, clientSecret, refreshToken string) *RefreshTokenSource {
+	return &RefreshTokenSource{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		refreshToken: refreshToken,
+	}
+}
+
+func (s *RefreshTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.refreshToken},
+	}
+	if len(s.Scopes) > 0 {
+		values.Set("scope", strings.Join(s.Scopes, " "))
+	}
+
+	token, err := requestToken(ctx, s.HTTPClient, s.TokenURL, s.ClientID, s.ClientSecret, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RefreshToken != "" {
+		s.refreshToken = token.RefreshToken
+	}
+
+	return token, nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func requestToken(ctx context.Context, httpClient *http.Client, tokenURL, clientID, clientSecret string, values url.Values) (*Token, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTokenRequestTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	var tr tokenResponse
+	decodeErr := json.Unmarshal(body, &tr)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || tr.Error != "" {
+		return nil, &TokenError{
+			StatusCode:  resp.StatusCode,
+			Code:        tr.Error,
+			Description: tr.ErrorDescription,
+			Body:        string(body),
+		}
+	}
+
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decode token response: %w", decodeErr)
+	}
+	if tr.AccessToken == "" {
+		return nil, &TokenError{StatusCode: resp.StatusCode, Description: "access_token is missing", Body: string(body)}
+	}
+
+	token := &Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	if tr.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientCredentialsSourceToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		response   string
+		wantToken  string
+		wantExpiry bool
+		wantCode   string
+		wantErr    bool
+	}{
+		{name: "expiring token", status: http.StatusOK, response: `{"access_token":"abc","token_type":"bearer","expires_in":3600}`, wantToken: "abc", wantExpiry: true},
+		{name: "token without expiry", status: http.StatusOK, response: `{"access_token":"abc"}`, wantToken: "abc"},
+		{name: "error response", status: http.StatusBadRequest, response: `{"error":"invalid_client","error_description":"unknown client"}`, wantCode: "invalid_client", wantErr: true},
+		{name: "error with status 200", status: http.StatusOK, response: `{"error":"invalid_scope"}`, wantCode: "invalid_scope", wantErr: true},
+		{name: "missing access token", status: http.StatusOK, response: `{"token_type":"bearer"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				clientID, clientSecret, _ := r.BasicAuth()
+				if r.Method != http.MethodPost || clientID != "id%3A1" || clientSecret != "secret" ||
+					r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("scope") != "read write" ||
+					r.PostFormValue("audience") != "api" {
+					t.Errorf("unexpected token request %s %v, client %q:%q", r.Method, r.PostForm, clientID, clientSecret)
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprint(w, tt.response)
+			}))
+			defer server.Close()
+
+			source := NewClientCredentialsSource(server.URL, "id:1", "secret", "read", "write")
+			source.EndpointParams = map[string][]string{"audience": {"api"}}
+
+			token, err := source.Token(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Token() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var tokenErr *TokenError
+				if !errors.As(err, &tokenErr) || tokenErr.Code != tt.wantCode {
+					t.Fatalf("Token() error = %v, want a TokenError with code %q", err, tt.wantCode)
+				}
+				return
+			}
+
+			if token.AccessToken != tt.wantToken || token.Expiry.IsZero() == tt.wantExpiry {
+				t.Fatalf("Token() = %+v, want access token %q with expiry %v", token, tt.wantToken, tt.wantExpiry)
+			}
+			if tt.wantExpiry && time.Until(token.Expiry) <= 59*time.Minute {
+				t.Fatalf("Token() expiry = %v, want in an hour", token.Expiry)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/viktor8881/service-utilities/tlsconfig"
+)
+
+// RoundTripperFactory wraps the next round tripper of the chain, e.g.
+//
+//	func(next http.RoundTripper) http.RoundTripper { return NewMetricsRoundTripper(next) }
+type RoundTripperFactory func(next http.RoundTripper) http.RoundTripper
+
+// ConnectionPool tunes the connections of the underlying http.Transport, zero values keep the defaults.
+type ConnectionPool struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+}
+
+type clientOptions struct {
+	timeout      time.Duration
+	transport    http.RoundTripper
+	headers      map[string]string
+	tlsConfig    *tls.Config
+	tlsReloader  *tlsconfig.Reloader
+	caFiles      []string
+	certFile     string
+	keyFile      string
+	proxy        string
+	pool         *ConnectionPool
+	middlewares  []RoundTripperFactory
+	acceptStatus StatusAcceptor
+	balancer     *Balancer
+}
+
+type Option func(*clientOptions)
+
+// WithTimeout limits the whole request including reading the response body, there is no timeout by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithTransport sets the innermost round tripper, http.DefaultTransport by default. The TLS, proxy
+// and connection pool options require it to be a *http.Transport and are applied to a clone of it.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
+}
+
+// WithDefaultHeaders sets headers sent with every request, headers passed to a call take precedence.
+func WithDefaultHeaders(headers map[string]string) Option {
+	return func(o *clientOptions) {
+		for key, value := range headers {
+			o.headers[key] = value
+		}
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) {
+		o.headers["User-Agent"] = userAgent
+	}
+}
+
+// WithTLSConfig sets the base TLS config, WithCAFile and WithClientCertificate are applied to a clone of it.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *clientOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithTLSReloader presents the client certificate of reloader and verifies servers with its CA bundle,
+// both are picked up on rotation without recreating the client. The other TLS options still apply,
+// but the reloader's certificate and CA bundle take precedence. It can not be combined with WithCAFile
+// when the reloader has a CA bundle, add the certificates to that bundle instead.
+func WithTLSReloader(reloader *tlsconfig.Reloader) Option {
+	return func(o *clientOptions) {
+		o.tlsReloader = reloader
+	}
+}
+
+// WithCAFile trusts the PEM certificates in the files in addition to the system roots.
+func WithCAFile(paths ...string) Option {
+	return func(o *clientOptions) {
+		o.caFiles = append(o.caFiles, paths...)
+	}
+}
+
+// WithClientCertificate presents the PEM certificate and key to servers that require mutual TLS.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(o *clientOptions) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// WithProxy sends requests through the proxy, by default the proxy is taken from the environment.
+func WithProxy(proxyURL string) Option {
+	return func(o *clientOptions) {
+		o.proxy = proxyURL
+	}
+}
+
+func WithConnectionPool(pool ConnectionPool) Option {
+	return func(o *clientOptions) {
+		o.pool = &pool
+	}
+}
+
+// WithMiddleware adds round trippers around the transport. The first factory is the outermost:
+// WithMiddleware(retry, metrics) sends a request through retry, then metrics, then the transport.
+// Calling it again adds factories inside the ones added before.
+func WithMiddleware(factories ...RoundTripperFactory) Option {
+	return func(o *clientOptions) {
+		o.middlewares = append(o.middlewares, factories...)
+	}
+}
+
+// WithAcceptStatus is the same as Client.SetAcceptStatus.
+func WithAcceptStatus(accept StatusAcceptor) Option {
+	return func(o *clientOptions) {
+		o.acceptStatus = accept
+	}
+}
+
+// WithBalancer sends requests to the endpoints of balancer, the base URL is then usually empty
+// (see NewBalancedClient). The balancer sits between the middlewares and the transport unless its
+// Proxied is already set, and is closed with the client.
+func WithBalancer(balancer *Balancer) Option {
+	return func(o *clientOptions) {
+		o.balancer = balancer
+	}
+}
+
+// New creates a client sending requests to baseURL, by default through http.DefaultTransport without a timeout.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	options := clientOptions{headers: make(map[string]string)}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	transport, err := options.buildTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if options.balancer != nil {
+		if options.balancer.Proxied == nil {
+			options.balancer.Proxied = transport
+		}
+		roundTripper = options.balancer
+	}
+	for i := len(options.middlewares) - 1; i >= 0; i-- {
+		roundTripper = options.middlewares[i](roundTripper)
+	}
+
+	acceptStatus := options.acceptStatus
+	if acceptStatus == nil {
+		acceptStatus = Status2xx
+	}
+
+	return &Client{
+		httpClient: &http.Client{
+			Timeout:   options.timeout,
+			Transport: roundTripper,
+		},
+		streamClient: &http.Client{
+			Transport: roundTripper,
+		},
+		baseURL:      baseURL,
+		headers:      options.headers,
+		acceptStatus: acceptStatus,
+		balancer:     options.balancer,
+	}, nil
+}
+
+func (o *clientOptions) buildTransport() (http.RoundTripper, error) {
+	if o.tlsConfig == nil && o.tlsReloader == nil && len(o.caFiles) == 0 && o.certFile == "" && o.proxy == "" && o.pool == nil {
+		if o.transport == nil {
+			return http.DefaultTransport, nil
+		}
+		return o.transport, nil
+	}
+
+	base := o.transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpTransport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("TLS, proxy and connection pool options require the transport to be *http.Transport")
+	}
+	transport := httpTransport.Clone()
+
+	tlsConfig, err := o.buildTLSConfig(transport.TLSClientConfig)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if o.tlsReloader != nil {
+		if len(o.caFiles) > 0 && o.tlsReloader.CertPool() != nil {
+			// the reloader verifies servers with its own pool only, the files would be silently ignored
+			return nil, errors.New("WithCAFile can not be combined with WithTLSReloader that has a CA file")
+		}
+		// the transport adds h2 to its own config only, the dialer gets a config of its own
+		if transport.ForceAttemptHTTP2 && len(tlsConfig.NextProtos) == 0 {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+		transport.TLSClientConfig = o.tlsReloader.WrapClientConfig(tlsConfig)
+		// the dialed address is needed to verify servers addressed by IP
+		transport.DialTLSContext = o.tlsReloader.DialTLSContext(tlsConfig, transport.DialContext)
+	}
+
+	if o.proxy != "" {
+		proxyURL, err := url.Parse(o.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if o.pool != nil {
+		if o.pool.MaxIdleConns > 0 {
+			transport.MaxIdleConns = o.pool.MaxIdleConns
+		}
+		if o.pool.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = o.pool.MaxIdleConnsPerHost
+		}
+		if o.pool.MaxConnsPerHost > 0 {
+			transport.MaxConnsPerHost = o.pool.MaxConnsPerHost
+		}
+		if o.pool.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = o.pool.IdleConnTimeout
+		}
+	}
+
+	return transport, nil
+}
+
+func (o *clientOptions) buildTLSConfig(current *tls.Config) (*tls.Config, error) {
+	config := current
+	if o.tlsConfig != nil {
+		config = o.tlsConfig
+	}
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		config = config.Clone()
+	}
+
+	if len(o.caFiles) > 0 {
+		pool := config.RootCAs
+		if pool == nil {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				systemPool = x509.NewCertPool()
+			}
+			pool = systemPool
+		} else {
+			pool = pool.Clone()
+		}
+
+		for _, path := range o.caFiles {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", path)
+			}
+		}
+		config.RootCAs = pool
+	}
+
+	if o.certFile != "" || o.keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = append(config.Certificates, certificate)
+	}
+
+	return config, nil
+}
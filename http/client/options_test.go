@@ -0,0 +1,349 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/viktor8881/service-utilities/tlsconfig"
+)
+
+// newTLSTestServer starts an HTTP/2 server that requires a client certificate and responds with the protocol.
+// It returns the PEM files of its own certificate, which is self-signed and valid for 127.0.0.1.
+func newTLSTestServer(t *testing.T) (server *httptest.Server, certFile, keyFile string) {
+	t.Helper()
+
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	certificate := server.TLS.Certificates[0]
+	keyDER, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return server, certFile, keyFile
+}
+
+func TestNewTLSReloaderWithOtherTLSOptions(t *testing.T) {
+	server, certFile, keyFile := newTLSTestServer(t)
+
+	newReloader := func(files tlsconfig.Files) *tlsconfig.Reloader {
+		reloader, err := tlsconfig.NewReloader(files, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(reloader.Close)
+		return reloader
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{
+			name: "CA file and reloader certificate",
+			opts: []Option{WithCAFile(certFile), WithTLSReloader(newReloader(tlsconfig.Files{CertFile: certFile, KeyFile: keyFile}))},
+		},
+		{
+			name: "reloader certificate before TLS config",
+			opts: []Option{
+				WithTLSReloader(newReloader(tlsconfig.Files{CertFile: certFile, KeyFile: keyFile})),
+				WithTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}),
+			},
+		},
+		{
+			name: "client certificate and reloader CA",
+			opts: []Option{WithClientCertificate(certFile, keyFile), WithTLSReloader(newReloader(tlsconfig.Files{CAFile: certFile}))},
+		},
+		{
+			name:    "reloader certificate without the server's CA",
+			opts:    []Option{WithTLSReloader(newReloader(tlsconfig.Files{CertFile: certFile, KeyFile: keyFile}))},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(server.URL, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := c.Do(context.Background(), RequestSpec{Method: http.MethodGet, Endpoint: "/"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(body); got != "HTTP/2.0" {
+				t.Fatalf("protocol = %q, want HTTP/2.0", got)
+			}
+		})
+	}
+}
+
+func TestNewRejectsCAFileWithReloaderCA(t *testing.T) {
+	_, certFile, _ := newTLSTestServer(t)
+
+	reloader, err := tlsconfig.NewReloader(tlsconfig.Files{CAFile: certFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Close()
+
+	if _, err := New("https://127.0.0.1", WithCAFile(certFile), WithTLSReloader(reloader)); err == nil {
+		t.Fatal("New() error = nil, want an error for WithCAFile with a reloader CA")
+	}
+}
+
+func TestNewMiddlewareOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var order []string
+	record := func(name string) RoundTripperFactory {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	c, err := New(server.URL, WithMiddleware(record("retry"), record("metrics")), WithMiddleware(record("auth")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Get(context.Background(), "/", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if want := []string{"retry", "metrics", "auth"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("middleware order = %v, want %v", order, want)
+	}
+}
+
+func TestNewHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		headers map[string]string
+		want    map[string]string
+	}{
+		{
+			name: "default headers",
+			opts: []Option{WithDefaultHeaders(map[string]string{"X-Tenant": "acme", "Accept": "application/json"})},
+			want: map[string]string{"X-Tenant": "acme", "Accept": "application/json"},
+		},
+		{
+			name:    "per-call headers take precedence",
+			opts:    []Option{WithDefaultHeaders(map[string]string{"X-Tenant": "acme", "Accept": "application/json"})},
+			headers: map[string]string{"X-Tenant": "globex"},
+			want:    map[string]string{"X-Tenant": "globex", "Accept": "application/json"},
+		},
+		{
+			name:    "user agent",
+			opts:    []Option{WithUserAgent("billing/1.2")},
+			headers: map[string]string{"X-Request-Id": "42"},
+			want:    map[string]string{"User-Agent": "billing/1.2", "X-Request-Id": "42"},
+		},
+		{
+			name:    "per-call user agent",
+			opts:    []Option{WithUserAgent("billing/1.2")},
+			headers: map[string]string{"User-Agent": "billing-cron/1.2"},
+			want:    map[string]string{"User-Agent": "billing-cron/1.2"},
+		},
+		{
+			name: "later default headers override earlier ones",
+			opts: []Option{WithDefaultHeaders(map[string]string{"X-Tenant": "acme"}), WithDefaultHeaders(map[string]string{"X-Tenant": "globex"})},
+			want: map[string]string{"X-Tenant": "globex"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+			}))
+			defer server.Close()
+
+			c, err := New(server.URL, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := c.Get(context.Background(), "/", nil, tt.headers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			for key, value := range tt.want {
+				if got.Get(key) != value {
+					t.Fatalf("header %s = %q, want %q", key, got.Get(key), value)
+				}
+			}
+		})
+	}
+}
+
+func TestNewConnectionPool(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+
+	tests := []struct {
+		name string
+		pool ConnectionPool
+		want ConnectionPool
+	}{
+		{
+			name: "all settings",
+			pool: ConnectionPool{MaxIdleConns: 10, MaxIdleConnsPerHost: 5, MaxConnsPerHost: 20, IdleConnTimeout: time.Minute},
+			want: ConnectionPool{MaxIdleConns: 10, MaxIdleConnsPerHost: 5, MaxConnsPerHost: 20, IdleConnTimeout: time.Minute},
+		},
+		{
+			name: "zero values keep the defaults",
+			pool: ConnectionPool{MaxConnsPerHost: 20},
+			want: ConnectionPool{
+				MaxIdleConns:        defaults.MaxIdleConns,
+				MaxIdleConnsPerHost: defaults.MaxIdleConnsPerHost,
+				MaxConnsPerHost:     20,
+				IdleConnTimeout:     defaults.IdleConnTimeout,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New("http://users.local", WithConnectionPool(tt.pool))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			transport, ok := c.httpClient.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("transport = %T, want *http.Transport", c.httpClient.Transport)
+			}
+			if transport == defaults {
+				t.Fatal("pool settings applied to http.DefaultTransport instead of a clone")
+			}
+
+			got := ConnectionPool{
+				MaxIdleConns:        transport.MaxIdleConns,
+				MaxIdleConnsPerHost: transport.MaxIdleConnsPerHost,
+				MaxConnsPerHost:     transport.MaxConnsPerHost,
+				IdleConnTimeout:     transport.IdleConnTimeout,
+			}
+			if got != tt.want {
+				t.Fatalf("pool = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		_, _ = io.WriteString(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	c, err := New("http://users.invalid", WithProxy(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Get(context.Background(), "/users/7", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "proxied" || requested != "http://users.invalid/users/7" {
+		t.Fatalf("proxy received %q and responded %q, want the absolute upstream URL", requested, body)
+	}
+
+	if _, err := New("http://users.invalid", WithProxy("http://proxy\x7f.local")); err == nil {
+		t.Fatal("New() error = nil, want an error for an invalid proxy URL")
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	custom := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "custom transport", opts: []Option{WithTransport(custom)}},
+		{name: "custom transport with TLS config", opts: []Option{WithTransport(custom), WithTLSConfig(&tls.Config{})}, wantErr: true},
+		{name: "custom transport with CA file", opts: []Option{WithTransport(custom), WithCAFile("ca.pem")}, wantErr: true},
+		{name: "custom transport with proxy", opts: []Option{WithTransport(custom), WithProxy("http://proxy.local")}, wantErr: true},
+		{name: "custom transport with connection pool", opts: []Option{WithTransport(custom), WithConnectionPool(ConnectionPool{MaxConnsPerHost: 1})}, wantErr: true},
+		{name: "http.Transport with proxy", opts: []Option{WithTransport(&http.Transport{}), WithProxy("http://proxy.local")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New("http://users.local", tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "*http.Transport") {
+				t.Fatalf("New() error = %v, want the transport type error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageStrategy tells Paginate how to request pages and where to find the items and the next page.
+type PageStrategy[T any] interface {
+	// FirstPage returns the URL of the first page, built from the request spec.
+	FirstPage(u *url.URL) *url.URL
+	// NextPage decodes the items of a page requested with u and returns the URL of the next page,
+	// nil after the last one.
+	NextPage(u *url.URL, resp *http.Response, body []byte) ([]T, *url.URL, error)
+}
+
+// ErrCrossOriginPage is returned by Paginate when a next page is on another scheme or host than the first one.
+var ErrCrossOriginPage = errors.New("next page is on another origin")
+
+type pageOptions struct {
+	maxItems    int
+	maxPages    int
+	prefetch    bool
+	crossOrigin bool
+}
+
+type PageOption func(*pageOptions)
+
+// WithMaxItems stops the iteration after n items.
+func WithMaxItems(n int) PageOption {
+	return func(o *pageOptions) {
+		o.maxItems = n
+	}
+}
+
+// WithMaxPages stops the iteration after n pages.
+func WithMaxPages(n int) PageOption {
+	return func(o *pageOptions) {
+		o.maxPages = n
+	}
+}
+
+// WithPrefetch requests the next page while the items of the current one are consumed.
+func WithPrefetch() PageOption {
+	return func(o *pageOptions) {
+		o.prefetch = true
+	}
+}
+
+// WithCrossOriginPages follows next pages to other schemes and hosts. The default headers and credentials
+// of the client's round trippers are sent there too, so only use it with upstreams that are fully trusted.
+func WithCrossOriginPages() PageOption {
+	return func(o *pageOptions) {
+		o.crossOrigin = true
+	}
+}
+
+type pageResult[T any] struct {
+	items []T
+	next  *url.URL
+	err   error
+}
+
+// Paginate requests the pages of a list endpoint described by spec and yields all items. The iteration
+// stops on the last page, on the first error (which is yielded) or when the caller stops it, in which
+// case a prefetched request is cancelled. All pages are requested with the method, body and headers of spec.
+// A page on another origin than the first one fails with ErrCrossOriginPage unless WithCrossOriginPages is set.
+func Paginate[T any](ctx context.Context, c *Client, spec RequestSpec, strategy PageStrategy[T], opts ...PageOption) iter.Seq2[T, error] {
+	options := pageOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// next pages are requested by absolute URL, the metrics keep the route of the list endpoint
+		if RouteFromContext(ctx) == "" && !isAbsoluteURL(spec.Endpoint) {
+			ctx = ContextWithRoute(ctx, spec.Endpoint)
+		}
+
+		first, err := c.firstPageURL(spec)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+
+		checkOrigin := func(u *url.URL) error {
+			if options.crossOrigin || sameOrigin(first, u) {
+				return nil
+			}
+			return fmt.Errorf("%w: %s", ErrCrossOriginPage, u.Redacted())
+		}
+
+		fetch := func(u *url.URL) pageResult[T] {
+			return fetchPage(ctx, c, spec, strategy, u)
+		}
+
+		firstPage := strategy.FirstPage(first)
+		if err := checkOrigin(firstPage); err != nil {
+			yield(zero, err)
+			return
+		}
+
+		result := fetch(firstPage)
+		items, pages := 0, 0
+		for {
+			if result.err != nil {
+				yield(zero, result.err)
+				return
+			}
+			pages++
+
+			last := result.next == nil || (options.maxPages > 0 && pages >= options.maxPages)
+
+			// the page links come from the upstream, which must not redirect the client's credentials elsewhere
+			var nextErr error
+			if !last {
+				if nextErr = checkOrigin(result.next); nextErr != nil {
+					last = true
+				}
+			}
+
+			var prefetched chan pageResult[T]
+			if options.prefetch && !last {
+				prefetched = make(chan pageResult[T], 1)
+				go func(u *url.URL) {
+					prefetched <- fetch(u)
+				}(result.next)
+			}
+
+			for _, item := range result.items {
+				if options.maxItems > 0 && items >= options.maxItems {
+					return
+				}
+				items++
+
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if nextErr != nil {
+				yield(zero, nextErr)
+				return
+			}
+
+			if last || (options.maxItems > 0 && items >= options.maxItems) {
+				return
+			}
+
+			if prefetched != nil {
+				result = <-prefetched
+			} else {
+				result = fetch(result.next)
+			}
+		}
+	}
+}
+
+func (c *Client) firstPageURL(spec RequestSpec) (*url.URL, error) {
+	rawURL, err := c.endpointURL(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Parse(rawURL)
+}
+
+func fetchPage[T any](ctx context.Context, c *Client, spec RequestSpec, strategy PageStrategy[T], u *url.URL) pageResult[T] {
+	spec.Endpoint = u.String()
+	spec.Query = nil
+
+	resp, err := c.Do(ctx, spec)
+	if err != nil {
+		return pageResult[T]{err: err}
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, DefaultMaxResponseBodySize+1))
+	if err != nil {
+		return pageResult[T]{err: err}
+	}
+	if int64(len(body)) > DefaultMaxResponseBodySize {
+		return pageResult[T]{err: ErrResponseBodyTooLarge}
+	}
+
+	items, next, err := strategy.NextPage(u, resp, body)
+	return pageResult[T]{items: items, next: next, err: err}
+}
+
+type linkHeaderPages[T any] struct {
+	itemsField string
+}
+
+// LinkHeaderPages follows the rel="next" link of the RFC 8288 (RFC 5988) Link header. Items are the JSON array
+// at itemsField (a dot separated path like "data.items"), or the whole body if itemsField is empty.
+func LinkHeaderPages[T any](itemsField string) PageStrategy[T] {
+	return linkHeaderPages[T]{itemsField: itemsField}
+}
+
+func (s linkHeaderPages[T]) FirstPage(u *url.URL) *url.URL {
+	return u
+}
+
+func (s linkHeaderPages[T]) NextPage(u *url.URL, resp *http.Response, body []byte) ([]T, *url.URL, error) {
+	items, err := decodeItems[T](body, s.itemsField)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next := nextLink(resp.Header)
+	if next == "" {
+		return items, nil, nil
+	}
+
+	nextURL, err := u.Parse(next)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid next link %q: %w", next, err)
+	}
+
+	return items, nextURL, nil
+}
+
+type cursorPages[T any] struct {
+	itemsField  string
+	cursorField string
+	cursorParam string
+}
+
+// CursorPages reads the items at itemsField and the cursor of the next page at cursorField of the JSON body
+// and passes the cursor in the cursorParam query parameter. An empty or missing cursor, or the cursor
+// of the current page, ends the iteration.
+func CursorPages[T any](itemsField, cursorField, cursorParam string) PageStrategy[T] {
+	return cursorPages[T]{itemsField: itemsField, cursorField: cursorField, cursorParam: cursorParam}
+}
+
+func (s cursorPages[T]) FirstPage(u *url.URL) *url.URL {
+	return u
+}
+
+func (s cursorPages[T]) NextPage(u *url.URL, _ *http.Response, body []byte) ([]T, *url.URL, error) {
+	items, err := decodeItems[T](body, s.itemsField)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := jsonField(body, s.cursorField)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cursor any
+	if raw != nil {
+		// numeric cursors are kept as they are, a float64 would round IDs above 2^53
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&cursor); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var value string
+	switch cursor := cursor.(type) {
+	case nil:
+	case string:
+		value = cursor
+	case json.Number:
+		value = cursor.String()
+	default:
+		return nil, nil, fmt.Errorf("cursor field %q is neither a string nor a number", s.cursorField)
+	}
+
+	// a server that returns the cursor it was given would be asked for the same page forever
+	if value == "" || len(items) == 0 || value == u.Query().Get(s.cursorParam) {
+		return items, nil, nil
+	}
+
+	return items, withQueryParam(u, s.cursorParam, value), nil
+}
+
+type offsetPages[T any] struct {
+	itemsField  string
+	offsetParam string
+	limitParam  string
+	limit       int
+}
+
+// OffsetPages requests pages of limit items with the offsetParam and limitParam query parameters
+// and reads the items at itemsField of the JSON body. A page shorter than limit ends the iteration.
+func OffsetPages[T any](itemsField, offsetParam, limitParam string, limit int) PageStrategy[T] {
+	return offsetPages[T]{itemsField: itemsField, offsetParam: offsetParam, limitParam: limitParam, limit: limit}
+}
+
+func (s offsetPages[T]) FirstPage(u *url.URL) *url.URL {
+	u = withQueryParam(u, s.limitParam, strconv.Itoa(s.limit))
+
+	if u.Query().Get(s.offsetParam) == "" {
+		u = withQueryParam(u, s.offsetParam, "0")
+	}
+
+	return u
+}
+
+func (s offsetPages[T]) NextPage(u *url.URL, _ *http.Response, body []byte) ([]T, *url.URL, error) {
+	items, err := decodeItems[T](body, s.itemsField)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(items) == 0 || len(items) < s.limit {
+		return items, nil, nil
+	}
+
+	offset, err := strconv.Atoi(u.Query().Get(s.offsetParam))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid offset: %w", err)
+	}
+
+	return items, withQueryParam(u, s.offsetParam, strconv.Itoa(offset+len(items))), nil
+}
+
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		originPort(a) == originPort(b)
+}
+
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	default:
+		return ""
+	}
+}
+
+func withQueryParam(u *url.URL, name, value string) *url.URL {
+	next := *u
+	query := next.Query()
+	query.Set(name, value)
+	next.RawQuery = query.Encode()
+
+	return &next
+}
+
+func decodeItems[T any](body []byte, field string) ([]T, error) {
+	raw, err := jsonField(body, field)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var items []T
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// jsonField returns the value at a dot separated path of a JSON object, nil if it is missing.
+func jsonField(body []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(body)
+	if path == "" {
+		return raw, nil
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("field %q: %w", path, err)
+		}
+
+		var ok bool
+		if raw, ok = object[key]; !ok {
+			return nil, nil
+		}
+	}
+
+	return raw, nil
+}
+
+// nextLink returns the target of the rel="next" link of the Link headers.
+func nextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			if !ok {
+				continue
+			}
+
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPaginateCrossOriginLink(t *testing.T) {
+	var foreignCalls atomic.Int32
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		foreignCalls.Add(1)
+		_, _ = w.Write([]byte(`[3]`))
+	}))
+	defer foreign.Close()
+
+	tests := []struct {
+		name        string
+		next        func(origin string) string
+		opts        []PageOption
+		wantItems   []int
+		wantErr     error
+		wantForeign int32
+	}{
+		{name: "relative link", next: func(string) string { return "/items?page=2" }, wantItems: []int{1, 2}},
+		{name: "absolute link to the same origin", next: func(origin string) string { return origin + "/items?page=2" }, wantItems: []int{1, 2}},
+		{name: "link to another host", next: func(string) string { return foreign.URL + "/items?page=2" }, wantItems: []int{1}, wantErr: ErrCrossOriginPage},
+		{name: "link to another scheme", next: func(origin string) string { return "https" + origin[len("http"):] + "/items?page=2" }, wantItems: []int{1}, wantErr: ErrCrossOriginPage},
+		{name: "scheme relative link to another host", next: func(string) string { return "//" + foreign.Listener.Addr().String() + "/items" }, wantItems: []int{1}, wantErr: ErrCrossOriginPage},
+		{name: "cross origin opt-in", next: func(string) string { return foreign.URL + "/items?page=2" }, opts: []PageOption{WithCrossOriginPages()}, wantItems: []int{1, 3}, wantForeign: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			foreignCalls.Store(0)
+
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("page") == "2" {
+					_, _ = w.Write([]byte(`[2]`))
+					return
+				}
+				w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, tt.next(server.URL)))
+				_, _ = w.Write([]byte(`[1]`))
+			}))
+			defer server.Close()
+
+			c, err := New(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var items []int
+			var gotErr error
+			for item, err := range Paginate(context.Background(), c, RequestSpec{Method: http.MethodGet, Endpoint: "/items"}, LinkHeaderPages[int](""), tt.opts...) {
+				if err != nil {
+					gotErr = err
+					break
+				}
+				items = append(items, item)
+			}
+
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Fatalf("Paginate() error = %v, want %v", gotErr, tt.wantErr)
+			}
+			if fmt.Sprint(items) != fmt.Sprint(tt.wantItems) {
+				t.Fatalf("Paginate() items = %v, want %v", items, tt.wantItems)
+			}
+			if got := foreignCalls.Load(); got != tt.wantForeign {
+				t.Fatalf("requests to the other origin = %d, want %d", got, tt.wantForeign)
+			}
+		})
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "https://api.local/items", b: "https://api.local/items?page=2", want: true},
+		{a: "https://api.local/items", b: "https://API.local:443/items", want: true},
+		{a: "http://api.local/items", b: "http://api.local:80/items", want: true},
+		{a: "https://api.local/items", b: "http://api.local/items"},
+		{a: "https://api.local/items", b: "https://api.local:8443/items"},
+		{a: "https://api.local/items", b: "https://evil.local/items"},
+		{a: "https://api.local/items", b: "https://api.local.evil.local/items"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.b, func(t *testing.T) {
+			a, _ := url.Parse(tt.a)
+			b, _ := url.Parse(tt.b)
+			if got := sameOrigin(a, b); got != tt.want {
+				t.Fatalf("sameOrigin(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// collectPages returns the items of Paginate up to the first error.
+func collectPages[T any](t *testing.T, c *Client, endpoint string, strategy PageStrategy[T], opts ...PageOption) ([]T, error) {
+	t.Helper()
+
+	var items []T
+	for item, err := range Paginate(context.Background(), c, RequestSpec{Method: http.MethodGet, Endpoint: endpoint}, strategy, opts...) {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func TestPaginateCursor(t *testing.T) {
+	// the integer cursor can not be represented by a float64
+	pages := map[string]string{
+		"":                 `{"data":{"items":[1,2]},"next":9007199254740993}`,
+		"9007199254740993": `{"data":{"items":[3]},"next":"abc"}`,
+		"abc":              `{"data":{"items":[4]},"next":"abc"}`,
+	}
+
+	var cursors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+
+		page, ok := pages[cursor]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := collectPages(t, c, "/items", CursorPages[int]("data.items", "next", "cursor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(items) != "[1 2 3 4]" {
+		t.Fatalf("Paginate() items = %v, want [1 2 3 4]", items)
+	}
+	if got := fmt.Sprintf("%q", cursors); got != `["" "9007199254740993" "abc"]` {
+		t.Fatalf("requested cursors = %s", got)
+	}
+}
+
+func TestPaginateOffset(t *testing.T) {
+	tests := []struct {
+		name         string
+		total        int
+		opts         []PageOption
+		wantItems    string
+		wantRequests int32
+	}{
+		{name: "short last page", total: 5, wantItems: "[0 1 2 3 4]", wantRequests: 3},
+		{name: "empty last page", total: 4, wantItems: "[0 1 2 3]", wantRequests: 3},
+		{name: "max items", total: 10, opts: []PageOption{WithMaxItems(3)}, wantItems: "[0 1 2]", wantRequests: 2},
+		{name: "max pages", total: 10, opts: []PageOption{WithMaxPages(2)}, wantItems: "[0 1 2 3]", wantRequests: 2},
+		{name: "prefetch", total: 5, opts: []PageOption{WithPrefetch()}, wantItems: "[0 1 2 3 4]", wantRequests: 3},
+		{name: "prefetch with max pages", total: 10, opts: []PageOption{WithPrefetch(), WithMaxPages(2)}, wantItems: "[0 1 2 3]", wantRequests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+				if limit != 2 || r.URL.Query().Get("sort") != "id" {
+					t.Errorf("unexpected query %s", r.URL.RawQuery)
+				}
+
+				items := []int{}
+				for i := offset; i < min(offset+limit, tt.total); i++ {
+					items = append(items, i)
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+			}))
+			defer server.Close()
+
+			c, err := New(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			items, err := collectPages(t, c, "/items?sort=id", OffsetPages[int]("items", "offset", "limit", 2), tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(items); got != tt.wantItems {
+				t.Fatalf("Paginate() items = %s, want %s", got, tt.wantItems)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Fatalf("requested %d pages, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPaginatePrefetchStop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		_ = json.NewEncoder(w).Encode([]int{offset, offset + 1})
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the endless list stops when the caller breaks out of the loop
+	var items []int
+	for item, err := range Paginate(context.Background(), c, RequestSpec{Method: http.MethodGet, Endpoint: "/items"}, OffsetPages[int]("", "offset", "limit", 2), WithPrefetch()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, item)
+		if len(items) == 5 {
+			break
+		}
+	}
+
+	if fmt.Sprint(items) != "[0 1 2 3 4]" {
+		t.Fatalf("Paginate() items = %v, want [0 1 2 3 4]", items)
+	}
+}
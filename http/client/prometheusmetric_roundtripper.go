@@ -1,58 +1,302 @@
 package client
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
 )
 
+const unknownRoute = "unknown"
+
+var defaultSizeBuckets = prometheus.ExponentialBuckets(64, 4, 10)
+
+type routeContextKey struct{}
+
+// ContextWithRoute sets the route template used as the metrics label, e.g. "/users/{id}".
+// Client sets the endpoint of every request as its route.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeContextKey{}).(string)
+	return route
+}
+
+type MetricsConfig struct {
+	// Namespace and Subsystem prefix the metric names, e.g. Subsystem "client" turns http_requests_total
+	// into client_http_requests_total so that it does not collide with the server metrics of the service.
+	Namespace string
+	Subsystem string
+	// Registerer is used by RegisterMetrics, prometheus.DefaultRegisterer if nil.
+	Registerer      prometheus.Registerer
+	ConstLabels     prometheus.Labels
+	DurationBuckets []float64
+	SizeBuckets     []float64
+	// RouteFunc returns a low-cardinality route label for the request. By default the route
+	// is taken from the request context (see ContextWithRoute).
+	RouteFunc func(req *http.Request) string
+}
+
+// MetricRoundTripper is a http.RoundTripper that exports Prometheus metrics of the requests labelled by
+// method, host and route.
+//
+// http_request_duration_seconds and http_requests_total keep their names, but the url, status and error
+// labels of earlier versions are replaced by route, code and class: every distinct URL made a new series.
 type MetricRoundTripper struct {
-	Proxied         http.RoundTripper
+	Proxied   http.RoundTripper
+	routeFunc func(req *http.Request) string
+	cfg       MetricsConfig
+
 	requestDuration *prometheus.HistogramVec
 	requestCounter  *prometheus.CounterVec
+	inFlight        *prometheus.GaugeVec
+	requestSize     *prometheus.HistogramVec
+	responseSize    *prometheus.HistogramVec
+	cacheCounter    *prometheus.CounterVec
+
+	compressionRatio    *prometheus.HistogramVec
+	compressionDuration *prometheus.HistogramVec
 }
 
 func NewMetricsRoundTripper(proxied http.RoundTripper) *MetricRoundTripper {
-	return &MetricRoundTripper{
-		Proxied: proxied,
-		requestDuration: prometheus.NewHistogramVec(
-			prometheus.HistogramOpts{
-				Name: "http_request_duration_seconds",
-				Help: "Duration of HTTP requests in seconds.",
-			},
-			[]string{"method", "url", "error"},
-		),
-		requestCounter: prometheus.NewCounterVec(
-			prometheus.CounterOpts{
-				Name: "http_requests_total",
-				Help: "Total number of HTTP requests.",
-			},
-			[]string{"method", "url", "status", "error"},
-		),
+	return NewMetricsRoundTripperWithConfig(proxied, MetricsConfig{})
+}
+
+func NewMetricsRoundTripperWithConfig(proxied http.RoundTripper, cfg MetricsConfig) *MetricRoundTripper {
+	if cfg.DurationBuckets == nil {
+		cfg.DurationBuckets = prometheus.DefBuckets
 	}
+	if cfg.SizeBuckets == nil {
+		cfg.SizeBuckets = defaultSizeBuckets
+	}
+
+	lrt := &MetricRoundTripper{
+		Proxied:   proxied,
+		routeFunc: cfg.RouteFunc,
+		cfg:       cfg,
+	}
+	lrt.initMetrics(cfg.ConstLabels)
+
+	return lrt
+}
+
+func (lrt *MetricRoundTripper) initMetrics(constLabels prometheus.Labels) {
+	cfg := lrt.cfg
+
+	requestLabels := []string{"method", "host", "route"}
+	responseLabels := []string{"method", "host", "route", "code", "class"}
+
+	lrt.requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_request_duration_seconds",
+			Help:        "Duration of HTTP requests in seconds.",
+			ConstLabels: constLabels,
+			Buckets:     cfg.DurationBuckets,
+		},
+		responseLabels,
+	)
+	lrt.requestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_requests_total",
+			Help:        "Total number of HTTP requests.",
+			ConstLabels: constLabels,
+		},
+		responseLabels,
+	)
+	lrt.inFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_requests_in_flight",
+			Help:        "Number of HTTP requests waiting for a response.",
+			ConstLabels: constLabels,
+		},
+		requestLabels,
+	)
+	lrt.requestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_request_size_bytes",
+			Help:        "Size of HTTP request bodies in bytes.",
+			ConstLabels: constLabels,
+			Buckets:     cfg.SizeBuckets,
+		},
+		requestLabels,
+	)
+	lrt.responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_response_size_bytes",
+			Help:        "Size of HTTP response bodies in bytes.",
+			ConstLabels: constLabels,
+			Buckets:     cfg.SizeBuckets,
+		},
+		responseLabels,
+	)
+	lrt.cacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_cache_requests_total",
+			Help:        "Total number of HTTP requests by cache status of CachingRoundTripper.",
+			ConstLabels: constLabels,
+		},
+		[]string{"method", "host", "route", "cache"},
+	)
+	lrt.compressionRatio = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_request_compression_ratio",
+			Help:        "Ratio of original to compressed size of request bodies compressed by CompressionRoundTripper.",
+			ConstLabels: constLabels,
+			Buckets:     []float64{1, 1.5, 2, 3, 5, 8, 13, 21},
+		},
+		[]string{"method", "host", "route", "encoding"},
+	)
+	lrt.compressionDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   cfg.Subsystem,
+			Name:        "http_request_compression_duration_seconds",
+			Help:        "Time spent compressing request bodies in seconds.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.ExponentialBuckets(0.0001, 4, 8),
+		},
+		[]string{"method", "host", "route", "encoding"},
+	)
 }
 
 func (lrt *MetricRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, host, route := req.Method, req.URL.Host, lrt.route(req)
+
+	inFlight := lrt.inFlight.WithLabelValues(method, host, route)
+	inFlight.Inc()
+	lrt.requestSize.WithLabelValues(method, host, route).Observe(float64(max(req.ContentLength, 0)))
+
+	// the stats are attached here so that a CompressionRoundTripper further down the chain can fill them
+	req, compression := withCompressionStats(req)
+
 	start := time.Now()
 
 	resp, err := lrt.Proxied.RoundTrip(req)
 	duration := time.Since(start).Seconds()
+	inFlight.Dec()
+
+	if compression.Encoding != "" {
+		lrt.compressionRatio.WithLabelValues(method, host, route, compression.Encoding).Observe(compression.Ratio())
+		lrt.compressionDuration.WithLabelValues(method, host, route, compression.Encoding).Observe(compression.Duration.Seconds())
+	}
 
-	errorLabel := "false"
 	if err != nil {
-		errorLabel = "true"
-		lrt.requestDuration.WithLabelValues(req.Method, req.URL.String(), errorLabel).Observe(duration)
-		lrt.requestCounter.WithLabelValues(req.Method, req.URL.String(), "error", errorLabel).Inc()
+		lrt.requestDuration.WithLabelValues(method, host, route, "error", "error").Observe(duration)
+		lrt.requestCounter.WithLabelValues(method, host, route, "error", "error").Inc()
 		return nil, err
 	}
 
-	lrt.requestDuration.WithLabelValues(req.Method, req.URL.String(), errorLabel).Observe(duration)
-	lrt.requestCounter.WithLabelValues(req.Method, req.URL.String(), resp.Status, errorLabel).Inc()
+	code := strconv.Itoa(resp.StatusCode)
+	class := statusClass(resp.StatusCode)
+	lrt.requestDuration.WithLabelValues(method, host, route, code, class).Observe(duration)
+	lrt.requestCounter.WithLabelValues(method, host, route, code, class).Inc()
+
+	if cacheStatus := resp.Header.Get(CacheStatusHeader); cacheStatus != "" {
+		lrt.cacheCounter.WithLabelValues(method, host, route, cacheStatus).Inc()
+	}
+
+	responseSize := lrt.responseSize.WithLabelValues(method, host, route, code, class)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		responseSize.Observe(0)
+	} else {
+		resp.Body = &countingBody{ReadCloser: resp.Body, observe: responseSize.Observe}
+	}
 
 	return resp, nil
 }
 
+// RegisterMetrics registers the metrics in the Registerer of the config before the first request.
 func (lrt *MetricRoundTripper) RegisterMetrics() {
-	prometheus.MustRegister(lrt.requestDuration, lrt.requestCounter)
+	lrt.register(lrt.cfg.Registerer)
+}
+
+// RegisterNamedMetrics registers the metrics in registerer with the client label set to name, before the first
+// request. Unlike the other round trippers MetricRoundTripper keeps RegisterMetrics for the global registry.
+func (lrt *MetricRoundTripper) RegisterNamedMetrics(registerer prometheus.Registerer, name string) {
+	constLabels := prometheus.Labels{"client": name}
+	for key, value := range lrt.cfg.ConstLabels {
+		constLabels[key] = value
+	}
+	lrt.initMetrics(constLabels)
+
+	lrt.register(registerer)
+}
+
+func (lrt *MetricRoundTripper) register(registerer prometheus.Registerer) {
+	lrt.requestDuration = metrics.MustRegisterOrExisting(registerer, lrt.requestDuration)
+	lrt.requestCounter = metrics.MustRegisterOrExisting(registerer, lrt.requestCounter)
+	lrt.inFlight = metrics.MustRegisterOrExisting(registerer, lrt.inFlight)
+	lrt.requestSize = metrics.MustRegisterOrExisting(registerer, lrt.requestSize)
+	lrt.responseSize = metrics.MustRegisterOrExisting(registerer, lrt.responseSize)
+	lrt.cacheCounter = metrics.MustRegisterOrExisting(registerer, lrt.cacheCounter)
+	lrt.compressionRatio = metrics.MustRegisterOrExisting(registerer, lrt.compressionRatio)
+	lrt.compressionDuration = metrics.MustRegisterOrExisting(registerer, lrt.compressionDuration)
+}
+
+func (lrt *MetricRoundTripper) route(req *http.Request) string {
+	route := ""
+	if lrt.routeFunc != nil {
+		route = lrt.routeFunc(req)
+	} else {
+		route = RouteFromContext(req.Context())
+	}
+
+	if route == "" {
+		return unknownRoute
+	}
+
+	return route
+}
+
+func statusClass(code int) string {
+	if code < 100 || code >= 600 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// countingBody observes the number of bytes read once the body is read to the end or closed.
+type countingBody struct {
+	io.ReadCloser
+	n       int64
+	once    sync.Once
+	observe func(float64)
+}
+
+func (cb *countingBody) Read(p []byte) (int, error) {
+	n, err := cb.ReadCloser.Read(p)
+	cb.n += int64(n)
+	if err == io.EOF {
+		cb.once.Do(func() { cb.observe(float64(cb.n)) })
+	}
+
+	return n, err
+}
+
+func (cb *countingBody) Close() error {
+	cb.once.Do(func() { cb.observe(float64(cb.n)) })
+	return cb.ReadCloser.Close()
 }
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherMetric returns the metrics of the family name by their label values joined with ",".
+func gatherMetric(t *testing.T, registry *prometheus.Registry, name string) map[string]*dto.Metric {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byLabels := make(map[string]*dto.Metric)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "host" {
+					values = append(values, label.GetValue())
+				}
+			}
+			byLabels[strings.Join(values, ",")] = metric
+		}
+	}
+
+	return byLabels
+}
+
+func TestMetricRoundTripperRoute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		routeFunc  func(req *http.Request) string
+		endpoint   string
+		query      any
+		wantLabels string
+	}{
+		{
+			name:     "endpoint template",
+			endpoint: "/users/{id}",
+			query: struct {
+				ID int `path:"id"`
+			}{ID: 7},
+			wantLabels: "4xx,users,404,GET,/users/{id}",
+		},
+		{
+			name:       "route func",
+			routeFunc:  func(*http.Request) string { return "users" },
+			endpoint:   "/users/7",
+			wantLabels: "4xx,users,404,GET,users",
+		},
+		{
+			name:       "absolute URL",
+			endpoint:   server.URL + "/users/7",
+			wantLabels: "4xx,users,404,GET,unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+
+			c, err := New(server.URL, WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+				mrt := NewMetricsRoundTripperWithConfig(next, MetricsConfig{RouteFunc: tt.routeFunc})
+				mrt.RegisterNamedMetrics(registry, "users")
+				return mrt
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := c.Do(context.Background(), RequestSpec{Method: http.MethodGet, Endpoint: tt.endpoint, Query: tt.query})
+			if err == nil {
+				t.Fatalf("Do() status = %d, want an error", resp.StatusCode)
+			}
+
+			counters := gatherMetric(t, registry, "http_requests_total")
+			if len(counters) != 1 || counters[tt.wantLabels] == nil {
+				t.Fatalf("requests_total series = %v, want one with labels %s", counters, tt.wantLabels)
+			}
+		})
+	}
+}
+
+func TestMetricRoundTripperRegisterNamedMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+
+	// registering the same name twice must share the metrics instead of panicking
+	for _, name := range []string{"users", "orders", "orders"} {
+		mrt := NewMetricsRoundTripper(http.DefaultTransport)
+		mrt.RegisterNamedMetrics(registry, name)
+
+		req, err := http.NewRequestWithContext(ContextWithRoute(context.Background(), "/"), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mrt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	counters := gatherMetric(t, registry, "http_requests_total")
+	if got := counters["2xx,users,200,GET,/"].GetCounter().GetValue(); got != 1 {
+		t.Fatalf("users requests = %v, want 1", got)
+	}
+	if got := counters["2xx,orders,200,GET,/"].GetCounter().GetValue(); got != 2 {
+		t.Fatalf("orders requests = %v, want 2", got)
+	}
+}
+
+func TestMetricRoundTripperRegisterMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+
+	// a second client of the same config shares the metrics instead of panicking
+	for range 2 {
+		mrt := NewMetricsRoundTripperWithConfig(http.DefaultTransport, MetricsConfig{Subsystem: "client", Registerer: registry})
+		mrt.RegisterMetrics()
+
+		req, err := http.NewRequestWithContext(ContextWithRoute(context.Background(), "/users"), http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := mrt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+	}
+
+	counters := gatherMetric(t, registry, "client_http_requests_total")
+	if got := counters["2xx,204,GET,/users"].GetCounter().GetValue(); got != 2 {
+		t.Fatalf("requests = %v, want 2 in client_http_requests_total", counters)
+	}
+}
+
+func TestMetricRoundTripperSizes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+		_, _ = io.WriteString(w, " and more")
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	mrt := NewMetricsRoundTripper(http.DefaultTransport)
+	mrt.RegisterNamedMetrics(registry, "echo")
+
+	req, err := http.NewRequestWithContext(ContextWithRoute(context.Background(), "/echo"), http.MethodPost, server.URL, strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := mrt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the response size is observed once the body is read
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	requestSize := gatherMetric(t, registry, "http_request_size_bytes")["echo,POST,/echo"]
+	if got := requestSize.GetHistogram().GetSampleSum(); got != 5 {
+		t.Fatalf("request size = %v, want 5", got)
+	}
+	responseSize := gatherMetric(t, registry, "http_response_size_bytes")["2xx,echo,200,POST,/echo"]
+	if got := responseSize.GetHistogram().GetSampleSum(); got != 14 || responseSize.GetHistogram().GetSampleCount() != 1 {
+		t.Fatalf("response size = %v in %d samples, want 14 in 1", got, responseSize.GetHistogram().GetSampleCount())
+	}
+	inFlight := gatherMetric(t, registry, "http_requests_in_flight")["echo,POST,/echo"]
+	if got := inFlight.GetGauge().GetValue(); got != 0 {
+		t.Fatalf("requests in flight = %v, want 0", got)
+	}
+}
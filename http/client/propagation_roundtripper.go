@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
+)
+
+// PropagationRoundTripper is a http.RoundTripper that writes the request ID and baggage stored in the request
+// context (see package correlation) into RequestIDHeader and BaggageHeader. Headers set by the caller are kept,
+// an empty header name turns off its propagation.
+type PropagationRoundTripper struct {
+	Proxied         http.RoundTripper
+	RequestIDHeader string
+	BaggageHeader   string
+}
+
+func NewPropagationRoundTripper(proxied http.RoundTripper) *PropagationRoundTripper {
+	return &PropagationRoundTripper{
+		Proxied:         proxied,
+		RequestIDHeader: correlation.HeaderRequestID,
+		BaggageHeader:   correlation.HeaderBaggage,
+	}
+}
+
+func (prt *PropagationRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	requestID := correlation.RequestIDFromContext(ctx)
+	setRequestID := prt.RequestIDHeader != "" && requestID != "" && req.Header.Get(prt.RequestIDHeader) == ""
+
+	baggage := correlation.FormatBaggage(correlation.BaggageFromContext(ctx))
+	setBaggage := prt.BaggageHeader != "" && baggage != "" && req.Header.Get(prt.BaggageHeader) == ""
+
+	if setRequestID || setBaggage {
+		req = req.Clone(ctx)
+		if setRequestID {
+			req.Header.Set(prt.RequestIDHeader, requestID)
+		}
+		if setBaggage {
+			req.Header.Set(prt.BaggageHeader, baggage)
+		}
+	}
+
+	return prt.Proxied.RoundTrip(req)
+}
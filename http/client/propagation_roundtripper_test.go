@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
+)
+
+func TestPropagationRoundTripper(t *testing.T) {
+	ctx := correlation.WithRequestID(context.Background(), "req-42")
+	ctx = correlation.WithBaggage(ctx, "tenant", "acme")
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		configure     func(prt *PropagationRoundTripper)
+		header        http.Header
+		wantRequestID string
+		wantBaggage   string
+	}{
+		{name: "from the context", ctx: ctx, wantRequestID: "req-42", wantBaggage: "tenant=acme"},
+		{name: "empty context", ctx: context.Background()},
+		{
+			name:          "headers set by the caller are kept",
+			ctx:           ctx,
+			header:        http.Header{"X-Request-Id": {"caller"}, "Baggage": {"tenant=globex"}},
+			wantRequestID: "caller",
+			wantBaggage:   "tenant=globex",
+		},
+		{
+			name:          "custom request ID header",
+			ctx:           ctx,
+			configure:     func(prt *PropagationRoundTripper) { prt.RequestIDHeader = "X-Correlation-ID" },
+			wantRequestID: "",
+			wantBaggage:   "tenant=acme",
+		},
+		{
+			name:          "propagation turned off",
+			ctx:           ctx,
+			configure:     func(prt *PropagationRoundTripper) { prt.RequestIDHeader, prt.BaggageHeader = "", "" },
+			wantRequestID: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent http.Header
+			prt := NewPropagationRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				sent = req.Header
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+			}))
+			if tt.configure != nil {
+				tt.configure(prt)
+			}
+
+			req, err := http.NewRequestWithContext(tt.ctx, http.MethodGet, "http://users.local/users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			callerHeader := req.Header.Clone()
+
+			if _, err := prt.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := sent.Get(correlation.HeaderRequestID); got != tt.wantRequestID {
+				t.Fatalf("%s = %q, want %q", correlation.HeaderRequestID, got, tt.wantRequestID)
+			}
+			if got := sent.Get(correlation.HeaderBaggage); got != tt.wantBaggage {
+				t.Fatalf("%s = %q, want %q", correlation.HeaderBaggage, got, tt.wantBaggage)
+			}
+			if tt.configure != nil && prt.RequestIDHeader != "" {
+				if got := sent.Get(prt.RequestIDHeader); got != "req-42" {
+					t.Fatalf("%s = %q, want req-42", prt.RequestIDHeader, got)
+				}
+			}
+			// the round tripper must not modify the caller's request
+			if len(req.Header) != len(callerHeader) {
+				t.Fatalf("caller's request headers = %v, want %v", req.Header, callerHeader)
+			}
+		})
+	}
+}
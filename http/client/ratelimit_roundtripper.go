@@ -0,0 +1,258 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+// RateLimitRoundTripper is a http.RoundTripper that limits outgoing requests with a token bucket
+// per key: Rate requests per second with bursts up to Burst. The key is the request host unless
+// KeyFunc is set. A Rate of 0 or less turns the limiter off, requests are sent right away.
+//
+// By default a request waits for a token as long as its context deadline allows, otherwise it fails
+// with RateLimitedError. With FailFast the request fails immediately when there is no token.
+//
+// The bucket also follows the upstream quota: when a response reports X-RateLimit-Remaining: 0
+// (or is 429 with Retry-After) the key is paused until X-RateLimit-Reset (or Retry-After). The bucket
+// starts refilling at the end of the pause, so the requests waiting for it are sent at Rate, not all at once.
+// Requests that were already waiting when the pause was reported wait for its end too.
+//
+// The key is also the key label of the metrics. A KeyFunc returning a high-cardinality key, e.g. a tenant
+// or user ID, needs KeyLabel to map it to a bounded set of values, otherwise every key creates new series.
+type RateLimitRoundTripper struct {
+	Proxied  http.RoundTripper
+	Rate     float64
+	Burst    int
+	KeyFunc  func(req *http.Request) string
+	KeyLabel func(key string) string
+	FailFast bool
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+
+	waitDuration    *prometheus.HistogramVec
+	rejectedCounter *prometheus.CounterVec
+}
+
+// tokenBucket holds the number of tokens at the time last, which is in the future while the key is paused.
+// pauses counts the pauses, a token reserved before the last one is void.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	pauses int
+}
+
+func NewRateLimitRoundTripper(proxied http.RoundTripper, rate float64, burst int) *RateLimitRoundTripper {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	rlrt := &RateLimitRoundTripper{
+		Proxied: proxied,
+		Rate:    rate,
+		Burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+	rlrt.initMetrics(nil)
+
+	return rlrt
+}
+
+func (rlrt *RateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rlrt.Rate <= 0 {
+		return rlrt.Proxied.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	key := rlrt.key(req)
+
+	start := time.Now()
+	for {
+		wait, pauses := rlrt.reserve(key)
+		if wait <= 0 {
+			break
+		}
+
+		deadline, hasDeadline := ctx.Deadline()
+		if rlrt.FailFast || (hasDeadline && time.Until(deadline) < wait) {
+			rlrt.cancel(key, pauses)
+			rlrt.rejectedCounter.WithLabelValues(rlrt.label(key)).Inc()
+			closeRequestBody(req)
+			return nil, &RateLimitedError{Key: key, RetryAfter: wait}
+		}
+
+		if err := sleepContext(ctx, wait); err != nil {
+			rlrt.cancel(key, pauses)
+			closeRequestBody(req)
+			return nil, err
+		}
+
+		// a pause reported while the request slept means the upstream quota is exhausted, wait for it again
+		if !rlrt.pausedSince(key, pauses) {
+			break
+		}
+	}
+	rlrt.waitDuration.WithLabelValues(rlrt.label(key)).Observe(time.Since(start).Seconds())
+
+	resp, err := rlrt.Proxied.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rlrt.adapt(key, resp)
+
+	return resp, nil
+}
+
+// RegisterMetrics registers the metrics in registerer with the client label set to name, before the first request.
+func (rlrt *RateLimitRoundTripper) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	rlrt.initMetrics(prometheus.Labels{"client": name})
+	rlrt.waitDuration = metrics.MustRegisterOrExisting(registerer, rlrt.waitDuration)
+	rlrt.rejectedCounter = metrics.MustRegisterOrExisting(registerer, rlrt.rejectedCounter)
+}
+
+func (rlrt *RateLimitRoundTripper) initMetrics(constLabels prometheus.Labels) {
+	rlrt.waitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:        "http_client_rate_limit_wait_seconds",
+			Help:        "Time requests wait for a rate limit token in seconds.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+	rlrt.rejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "http_client_rate_limit_rejected_total",
+			Help:        "Total number of requests rejected by the rate limiter.",
+			ConstLabels: constLabels,
+		},
+		[]string{"key"},
+	)
+}
+
+func (rlrt *RateLimitRoundTripper) key(req *http.Request) string {
+	if rlrt.KeyFunc != nil {
+		return rlrt.KeyFunc(req)
+	}
+
+	return req.URL.Host
+}
+
+func (rlrt *RateLimitRoundTripper) label(key string) string {
+	if rlrt.KeyLabel != nil {
+		return rlrt.KeyLabel(key)
+	}
+
+	return key
+}
+
+// reserve takes a token from the bucket and returns how long to wait until it is available
+// and the number of pauses the token was reserved after.
+func (rlrt *RateLimitRoundTripper) reserve(key string) (time.Duration, int) {
+	rlrt.mu.Lock()
+	defer rlrt.mu.Unlock()
+
+	now := time.Now()
+	b := rlrt.bucket(key, now)
+
+	if now.After(b.last) {
+		b.tokens = min(float64(rlrt.Burst), b.tokens+now.Sub(b.last).Seconds()*rlrt.Rate)
+		b.last = now
+	}
+	b.tokens--
+
+	wait := b.last.Sub(now)
+	if b.tokens < 0 {
+		wait += time.Duration(-b.tokens / rlrt.Rate * float64(time.Second))
+	}
+
+	return wait, b.pauses
+}
+
+// cancel returns the token of a request that has not been sent, unless a pause has voided it.
+func (rlrt *RateLimitRoundTripper) cancel(key string, pauses int) {
+	rlrt.mu.Lock()
+	defer rlrt.mu.Unlock()
+
+	b := rlrt.bucket(key, time.Now())
+	if b.pauses == pauses {
+		b.tokens = min(float64(rlrt.Burst), b.tokens+1)
+	}
+}
+
+func (rlrt *RateLimitRoundTripper) pausedSince(key string, pauses int) bool {
+	rlrt.mu.Lock()
+	defer rlrt.mu.Unlock()
+
+	return rlrt.bucket(key, time.Now()).pauses != pauses
+}
+
+func (rlrt *RateLimitRoundTripper) adapt(key string, resp *http.Response) {
+	var pauseUntil time.Time
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	hasRemaining := err == nil
+	if hasRemaining && remaining <= 0 {
+		pauseUntil = parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"))
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			pauseUntil = time.Now().Add(retryAfter)
+		}
+	}
+
+	if !hasRemaining && pauseUntil.IsZero() {
+		return
+	}
+
+	rlrt.mu.Lock()
+	defer rlrt.mu.Unlock()
+
+	b := rlrt.bucket(key, time.Now())
+	if hasRemaining {
+		b.tokens = min(b.tokens, float64(max(remaining, 0)))
+	}
+	if pauseUntil.After(b.last) {
+		// one request is sent when the pause ends, the others wait for the bucket to refill
+		b.tokens = 1
+		b.last = pauseUntil
+		b.pauses++
+	}
+}
+
+// bucket must be called with rlrt.mu held.
+func (rlrt *RateLimitRoundTripper) bucket(key string, now time.Time) *tokenBucket {
+	if rlrt.buckets == nil {
+		rlrt.buckets = make(map[string]*tokenBucket)
+	}
+
+	b, ok := rlrt.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rlrt.Burst), last: now}
+		rlrt.buckets[key] = b
+	}
+
+	return b
+}
+
+// parseRateLimitReset parses X-RateLimit-Reset which is either a unix timestamp or a number of seconds.
+func parseRateLimitReset(value string) time.Time {
+	reset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || reset < 0 {
+		return time.Time{}
+	}
+
+	// values this large can only be unix timestamps
+	if reset > 1_000_000_000 {
+		return time.Unix(reset, 0)
+	}
+
+	return time.Now().Add(time.Duration(reset) * time.Second)
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRateLimitRoundTripperUnlimited(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "3600")
+	}))
+	defer server.Close()
+
+	for _, rate := range []float64{0, -1} {
+		rlrt := NewRateLimitRoundTripper(http.DefaultTransport, rate, 1)
+		rlrt.FailFast = true
+
+		for range 5 {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := rlrt.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("rate %v: %v, want no limit", rate, err)
+			}
+			_ = resp.Body.Close()
+		}
+	}
+
+	if got := calls.Load(); got != 10 {
+		t.Fatalf("upstream got %d requests, want 10", got)
+	}
+}
+
+func TestRateLimitRoundTripperLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		failFast bool
+		timeout  time.Duration
+		wantErr  bool
+	}{
+		{name: "wait", timeout: time.Second},
+		{name: "wait without deadline"},
+		{name: "deadline shorter than the wait", timeout: 10 * time.Millisecond, wantErr: true},
+		{name: "fail fast", failFast: true, timeout: time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rlrt := NewRateLimitRoundTripper(http.DefaultTransport, 20, 1)
+			rlrt.FailFast = tt.failFast
+
+			send := func() error {
+				ctx := context.Background()
+				if tt.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+					defer cancel()
+				}
+
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				resp, err := rlrt.RoundTrip(req)
+				if err == nil {
+					_ = resp.Body.Close()
+				}
+				return err
+			}
+
+			if err := send(); err != nil {
+				t.Fatalf("first request: %v, want it sent with the burst token", err)
+			}
+
+			start := time.Now()
+			err := send()
+
+			var limited *RateLimitedError
+			if tt.wantErr {
+				if !errors.As(err, &limited) || limited.RetryAfter <= 0 {
+					t.Fatalf("second request: %v, want RateLimitedError", err)
+				}
+				if elapsed := time.Since(start); elapsed >= 40*time.Millisecond {
+					t.Fatalf("rejection took %s, want it without waiting for the token", elapsed)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("second request: %v, want it sent after the wait", err)
+			}
+			if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+				t.Fatalf("second request waited %s, want about 50ms", elapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimitRoundTripperPause(t *testing.T) {
+	const key = "users.local"
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+	}{
+		{
+			name:   "X-RateLimit-Reset",
+			status: http.StatusOK,
+			header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"2"}},
+		},
+		{
+			name:   "Retry-After",
+			status: http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": {"2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rlrt := NewRateLimitRoundTripper(http.DefaultTransport, 10, 5)
+			rlrt.adapt(key, &http.Response{StatusCode: tt.status, Header: tt.header})
+
+			// the waiters are spread by the rate after the pause instead of all waking up when it ends
+			var prev time.Duration
+			for i := range 4 {
+				wait, _ := rlrt.reserve(key)
+				if wait < time.Second || wait > 2*time.Second+time.Duration(i)*100*time.Millisecond {
+					t.Fatalf("waiter %d waits %s, want it after the 2s pause", i, wait)
+				}
+				if i > 0 && (wait-prev < 90*time.Millisecond || wait-prev > 110*time.Millisecond) {
+					t.Fatalf("waiter %d wakes %s after the previous one, want 100ms", i, wait-prev)
+				}
+				prev = wait
+			}
+		})
+	}
+}
+
+func TestRateLimitRoundTripperRemaining(t *testing.T) {
+	const key = "users.local"
+
+	rlrt := NewRateLimitRoundTripper(http.DefaultTransport, 10, 5)
+	rlrt.adapt(key, &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Ratelimit-Remaining": {"1"}}})
+
+	if wait, _ := rlrt.reserve(key); wait != 0 {
+		t.Fatalf("first request waits %s, want the one remaining token", wait)
+	}
+	if wait, _ := rlrt.reserve(key); wait <= 0 {
+		t.Fatal("second request does not wait, want the bucket capped by X-RateLimit-Remaining")
+	}
+}
+
+func TestRateLimitRoundTripperPauseWhileWaiting(t *testing.T) {
+	var calls atomic.Int32
+	var secondAt atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			// the quota runs out while the second request waits for its token
+			time.Sleep(20 * time.Millisecond)
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "1")
+			return
+		}
+		secondAt.Store(time.Now().UnixNano())
+	}))
+	defer server.Close()
+
+	rlrt := NewRateLimitRoundTripper(http.DefaultTransport, 20, 1)
+	send := func() error {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := rlrt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	start := time.Now()
+	first := make(chan error, 1)
+	go func() {
+		first <- send()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+
+	if waited := time.Duration(secondAt.Load() - start.UnixNano()); waited < 900*time.Millisecond {
+		t.Fatalf("second request was sent after %s, want it after the 1s pause", waited)
+	}
+}
+
+func TestRateLimitRoundTripperRejected(t *testing.T) {
+	rlrt := NewRateLimitRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	}), 1, 1)
+	rlrt.KeyFunc = func(req *http.Request) string { return req.Header.Get("X-Tenant") }
+	rlrt.KeyLabel = func(string) string { return "tenants" }
+
+	registry := prometheus.NewRegistry()
+	rlrt.RegisterMetrics(registry, "users")
+
+	send := func(ctx context.Context, tenant string) (*closeTrackingBody, error) {
+		body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://users.local/users", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Tenant", tenant)
+		_, err = rlrt.RoundTrip(req)
+		return body, err
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if _, err := send(context.Background(), tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rlrt.FailFast = true
+	body, err := send(context.Background(), "acme")
+	var limitedErr *RateLimitedError
+	if !errors.As(err, &limitedErr) || limitedErr.Key != "acme" {
+		t.Fatalf("RoundTrip() error = %v, want RateLimitedError for acme", err)
+	}
+	if !body.closed {
+		t.Fatal("body of the rejected request was not closed")
+	}
+
+	rlrt.FailFast = false
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	body, err = send(ctx, "globex")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("RoundTrip() error = %v, want context.Canceled", err)
+	}
+	if !body.closed {
+		t.Fatal("body of the request canceled while waiting was not closed")
+	}
+
+	// the tenants share one series instead of a series per tenant
+	rejected := gatherMetric(t, registry, "http_client_rate_limit_rejected_total")
+	if len(rejected) != 1 || rejected["users,tenants"].GetCounter().GetValue() != 1 {
+		t.Fatalf("rejected series = %v, want one for the tenants label", rejected)
+	}
+	if waits := gatherMetric(t, registry, "http_client_rate_limit_wait_seconds"); len(waits) != 1 || waits["users,tenants"] == nil {
+		t.Fatalf("wait series = %v, want one for the tenants label", waits)
+	}
+}
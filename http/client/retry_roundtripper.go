@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+
+	// maxDrainBodySize limits how much of a discarded response body is read
+	// so that the connection can be reused.
+	maxDrainBodySize = 64 << 10
+)
+
+// defaultRetryStatusCodes are the response codes that are worth retrying.
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+type attemptContextKey struct{}
+
+// RetryAttemptFromContext returns the attempt number (starting from 1) set by RetryRoundTripper,
+// or 0 if the request is not sent through it.
+func RetryAttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptContextKey{}).(int)
+	return attempt
+}
+
+// RetryRoundTripper is a http.RoundTripper that retries failed requests with exponential backoff and jitter.
+// Only idempotent requests are retried unless RetryNonIdempotent is set. A request with a body is retried
+// only when its body can be rewound through http.Request.GetBody. A Retry-After longer than MaxDelay
+// is not waited for, the response is returned instead.
+type RetryRoundTripper struct {
+	Proxied            http.RoundTripper
+	MaxAttempts        int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	RetryStatusCodes   []int
+	RetryNonIdempotent bool
+}
+
+func NewRetryRoundTripper(proxied http.RoundTripper, maxAttempts int) *RetryRoundTripper {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+
+	return &RetryRoundTripper{
+		Proxied:          proxied,
+		MaxAttempts:      maxAttempts,
+		BaseDelay:        defaultRetryBaseDelay,
+		MaxDelay:         defaultRetryMaxDelay,
+		RetryStatusCodes: slices.Clone(defaultRetryStatusCodes),
+	}
+}
+
+func (rrt *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	maxAttempts := rrt.MaxAttempts
+	if !rrt.canRetry(req) {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := rrt.newAttemptRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := rrt.Proxied.RoundTrip(attemptReq)
+		if attempt >= maxAttempts || !rrt.shouldRetry(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := rrt.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				// the server will not take the request earlier, so the caller decides what to do
+				if retryAfter > rrt.MaxDelay {
+					return resp, err
+				}
+				delay = retryAfter
+			}
+		}
+
+		// there is no point to wait if the context expires before the next attempt
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return resp, err
+		}
+
+		if resp != nil {
+			drainBody(resp.Body)
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (rrt *RetryRoundTripper) canRetry(req *http.Request) bool {
+	if !rrt.RetryNonIdempotent && !isIdempotent(req) {
+		return false
+	}
+
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func (rrt *RetryRoundTripper) newAttemptRequest(req *http.Request, attempt int) (*http.Request, error) {
+	attemptReq := req.Clone(context.WithValue(req.Context(), attemptContextKey{}, attempt))
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	return attemptReq, nil
+}
+
+func (rrt *RetryRoundTripper) shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	return slices.Contains(rrt.RetryStatusCodes, resp.StatusCode)
+}
+
+// backoff returns a random delay in [0, min(MaxDelay, BaseDelay*2^(attempt-1))] ("full jitter").
+func (rrt *RetryRoundTripper) backoff(attempt int) time.Duration {
+	delay := rrt.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if d := rrt.BaseDelay << shift; d > 0 && d < delay {
+			delay = d
+		}
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(delay + 1)
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// parseRetryAfter parses the Retry-After header which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	return max(time.Until(date), 0), true
+}
+
+func drainBody(body io.ReadCloser) {
+	if body == nil {
+		return
+	}
+
+	_, _ = io.CopyN(io.Discard, body, maxDrainBodySize)
+	_ = body.Close()
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
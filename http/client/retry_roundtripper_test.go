@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryRoundTripperRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		maxDelay   time.Duration
+		wantCalls  int32
+		wantStatus int
+	}{
+		{name: "no Retry-After", maxDelay: 10 * time.Millisecond, wantCalls: 2, wantStatus: http.StatusOK},
+		{name: "zero seconds", retryAfter: "0", maxDelay: 10 * time.Millisecond, wantCalls: 2, wantStatus: http.StatusOK},
+		{name: "date in the past", retryAfter: "Mon, 02 Jan 2006 15:04:05 GMT", maxDelay: 10 * time.Millisecond, wantCalls: 2, wantStatus: http.StatusOK},
+		{name: "longer than MaxDelay", retryAfter: "3600", maxDelay: 10 * time.Millisecond, wantCalls: 1, wantStatus: http.StatusTooManyRequests},
+		{name: "date later than MaxDelay", retryAfter: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), maxDelay: time.Second, wantCalls: 1, wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if calls.Add(1) == 1 {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			rrt := NewRetryRoundTripper(http.DefaultTransport, 3)
+			rrt.BaseDelay = time.Millisecond
+			rrt.MaxDelay = tt.maxDelay
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			resp, err := rrt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus || calls.Load() != tt.wantCalls {
+				t.Fatalf("status = %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), tt.wantStatus, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed > tt.maxDelay+time.Second {
+				t.Fatalf("RoundTrip() took %s, longer than MaxDelay %s", elapsed, tt.maxDelay)
+			}
+		})
+	}
+}
+
+func TestNewRetryRoundTripperStatusCodes(t *testing.T) {
+	rrt := NewRetryRoundTripper(http.DefaultTransport, 3)
+	rrt.RetryStatusCodes[0] = http.StatusInternalServerError
+
+	if defaultRetryStatusCodes[0] != http.StatusTooManyRequests {
+		t.Fatalf("changing RetryStatusCodes changed the defaults: %v", defaultRetryStatusCodes)
+	}
+}
+
+func TestRetryRoundTripperIdempotency(t *testing.T) {
+	tests := []struct {
+		name               string
+		method             string
+		header             http.Header
+		retryNonIdempotent bool
+		wantCalls          int32
+	}{
+		{name: "GET", method: http.MethodGet, wantCalls: 3},
+		{name: "PUT", method: http.MethodPut, wantCalls: 3},
+		{name: "DELETE", method: http.MethodDelete, wantCalls: 3},
+		{name: "POST", method: http.MethodPost, wantCalls: 1},
+		{name: "PATCH", method: http.MethodPatch, wantCalls: 1},
+		{name: "POST with Idempotency-Key", method: http.MethodPost, header: http.Header{"Idempotency-Key": {"k1"}}, wantCalls: 3},
+		{name: "POST with X-Idempotency-Key", method: http.MethodPost, header: http.Header{"X-Idempotency-Key": {"k1"}}, wantCalls: 3},
+		{name: "POST opted in", method: http.MethodPost, retryNonIdempotent: true, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			rrt := NewRetryRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls.Add(1)
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+			}), 3)
+			rrt.BaseDelay = time.Millisecond
+			rrt.RetryNonIdempotent = tt.retryNonIdempotent
+
+			req, err := http.NewRequest(tt.method, "http://users.local/users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+
+			resp, err := rrt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != tt.wantCalls {
+				t.Fatalf("status %d after %d calls, want 503 after %d", resp.StatusCode, calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryRoundTripperRewindBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       io.Reader
+		wantBodies []string
+	}{
+		{name: "rewindable", body: strings.NewReader("payload"), wantBodies: []string{"payload", "payload", "payload"}},
+		{name: "streamed", body: io.MultiReader(strings.NewReader("payload")), wantBodies: []string{"payload"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			var attempts []int
+			rrt := NewRetryRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+				bodies = append(bodies, string(body))
+				attempts = append(attempts, RetryAttemptFromContext(req.Context()))
+				return &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+			}), 3)
+			rrt.BaseDelay = time.Millisecond
+
+			req, err := http.NewRequest(http.MethodPut, "http://users.local/users/7", tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rrt.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(bodies, tt.wantBodies) {
+				t.Fatalf("bodies sent = %q, want %q", bodies, tt.wantBodies)
+			}
+			for i, attempt := range attempts {
+				if attempt != i+1 {
+					t.Fatalf("attempts = %v, want numbered from 1", attempts)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryRoundTripperCanceledDuringBackoff(t *testing.T) {
+	var calls atomic.Int32
+	rrt := NewRetryRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		header := http.Header{"Retry-After": {"1"}}
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: header, Body: http.NoBody, Request: req}, nil
+	}), 3)
+	rrt.MaxDelay = 2 * time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://users.local/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := rrt.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RoundTrip() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("RoundTrip() returned after %s, want right after the cancellation", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("calls = %d, want no attempt after the cancellation", got)
+	}
+}
+
+func TestRetryRoundTripperConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	up := server.URL
+	server.Close()
+
+	var calls atomic.Int32
+	rrt := NewRetryRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if calls.Add(1) < 3 {
+			// the closed server refuses the connection
+			return http.DefaultTransport.RoundTrip(req)
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+	}), 3)
+	rrt.BaseDelay = time.Millisecond
+
+	req, err := http.NewRequest(http.MethodGet, up, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := rrt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v, want the connection error retried", err)
+	}
+	if resp.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Fatalf("status %d after %d calls, want 200 after 3", resp.StatusCode, calls.Load())
+	}
+
+	// the last connection error is returned when every attempt fails
+	calls.Store(0)
+	rrt.Proxied = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	if _, err := rrt.RoundTrip(req); err == nil || calls.Load() != 3 {
+		t.Fatalf("RoundTrip() error = %v after %d calls, want the connection error after 3", err, calls.Load())
+	}
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/viktor8881/service-utilities/http/signature"
+)
+
+// SigningRoundTripper is a http.RoundTripper that signs requests with the current key of Keys (see package
+// signature), covering the method, path, query, body and the Headers, e.g. "host" and "content-type".
+// It should be the innermost middleware, so that no header it signs is changed after it.
+type SigningRoundTripper struct {
+	Proxied http.RoundTripper
+	Keys    signature.SigningKeyProvider
+	Headers []string
+}
+
+func NewSigningRoundTripper(proxied http.RoundTripper, keys signature.SigningKeyProvider, headers ...string) *SigningRoundTripper {
+	return &SigningRoundTripper{
+		Proxied: proxied,
+		Keys:    keys,
+		Headers: headers,
+	}
+}
+
+func (srt *SigningRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the round tripper must not modify the caller's request
+	signedReq := req.Clone(req.Context())
+
+	if err := signature.Sign(signedReq, srt.Keys, srt.Headers); err != nil {
+		return nil, err
+	}
+
+	return srt.Proxied.RoundTrip(signedReq)
+}
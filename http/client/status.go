@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"slices"
+)
+
+// StatusAcceptor reports whether a response status code is treated as success by the client.
+type StatusAcceptor func(code int) bool
+
+// Status2xx accepts any 2xx status code, it is the default StatusAcceptor.
+func Status2xx(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// AcceptStatus accepts only the listed status codes.
+func AcceptStatus(codes ...int) StatusAcceptor {
+	return func(code int) bool {
+		return slices.Contains(codes, code)
+	}
+}
+
+type acceptStatusContextKey struct{}
+
+// ContextWithAcceptStatus overrides the client StatusAcceptor for a single call.
+func ContextWithAcceptStatus(ctx context.Context, accept StatusAcceptor) context.Context {
+	return context.WithValue(ctx, acceptStatusContextKey{}, accept)
+}
+
+func acceptStatusFromContext(ctx context.Context) StatusAcceptor {
+	accept, _ := ctx.Value(acceptStatusContextKey{}).(StatusAcceptor)
+	return accept
+}
+
+func parseProblemDetails(header http.Header, body []byte) *ProblemDetails {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != "application/problem+json" {
+		return nil
+	}
+
+	problem := &ProblemDetails{}
+	if err := json.Unmarshal(body, problem); err != nil {
+		return nil
+	}
+
+	var members map[string]any
+	if err := json.Unmarshal(body, &members); err != nil {
+		return problem
+	}
+
+	for _, known := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(members, known)
+	}
+	if len(members) > 0 {
+		problem.Extensions = members
+	}
+
+	return problem
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestClientAcceptStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		client     StatusAcceptor
+		context    StatusAcceptor
+		spec       StatusAcceptor
+		status     int
+		wantErr    bool
+		wantStatus int
+	}{
+		{name: "default 200", status: http.StatusOK},
+		{name: "default 204", status: http.StatusNoContent},
+		{name: "default 304", status: http.StatusNotModified, wantErr: true},
+		{name: "default 404", status: http.StatusNotFound, wantErr: true},
+		{name: "client acceptor", client: AcceptStatus(http.StatusOK, http.StatusNotFound), status: http.StatusNotFound},
+		{name: "client acceptor rejects 2xx", client: AcceptStatus(http.StatusOK), status: http.StatusAccepted, wantErr: true},
+		{name: "context overrides the client", client: AcceptStatus(http.StatusOK), context: AcceptStatus(http.StatusConflict), status: http.StatusConflict},
+		{name: "request spec overrides the client", client: AcceptStatus(http.StatusOK), spec: AcceptStatus(http.StatusConflict), status: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.client != nil {
+				c.SetAcceptStatus(tt.client)
+			}
+
+			ctx := context.Background()
+			if tt.context != nil {
+				ctx = ContextWithAcceptStatus(ctx, tt.context)
+			}
+
+			resp, err := c.Do(ctx, RequestSpec{
+				Method:       http.MethodGet,
+				Endpoint:     "/?status=" + strconv.Itoa(tt.status),
+				AcceptStatus: tt.spec,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if resp == nil || resp.StatusCode != tt.status {
+				t.Fatalf("Do() response = %v, want status %d", resp, tt.status)
+			}
+		})
+	}
+}
+
+func TestClientResponseNot200Error(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		contentType     string
+		body            string
+		wantSentinel    error
+		wantNotFound    bool
+		wantClientError bool
+		wantServerError bool
+		wantRetryable   bool
+		wantProblem     *ProblemDetails
+	}{
+		{
+			name:            "not found problem",
+			status:          http.StatusNotFound,
+			contentType:     "application/problem+json; charset=utf-8",
+			body:            `{"type":"https://example.com/not-found","title":"Not Found","status":404,"detail":"no user 7","instance":"/users/7","user_id":7}`,
+			wantSentinel:    ErrClientError,
+			wantNotFound:    true,
+			wantClientError: true,
+			wantProblem: &ProblemDetails{
+				Type:       "https://example.com/not-found",
+				Title:      "Not Found",
+				Status:     404,
+				Detail:     "no user 7",
+				Instance:   "/users/7",
+				Extensions: map[string]any{"user_id": float64(7)},
+			},
+		},
+		{name: "problem with an invalid body", status: http.StatusBadRequest, contentType: "application/problem+json", body: `{`, wantSentinel: ErrClientError, wantClientError: true},
+		{name: "plain JSON is no problem", status: http.StatusConflict, contentType: "application/json", body: `{"title":"conflict"}`, wantSentinel: ErrClientError, wantClientError: true},
+		{name: "too many requests", status: http.StatusTooManyRequests, wantSentinel: ErrClientError, wantClientError: true, wantRetryable: true},
+		{name: "request timeout", status: http.StatusRequestTimeout, wantSentinel: ErrClientError, wantClientError: true, wantRetryable: true},
+		{name: "bad gateway", status: http.StatusBadGateway, wantSentinel: ErrServerError, wantServerError: true, wantRetryable: true},
+		{name: "not implemented", status: http.StatusNotImplemented, wantSentinel: ErrServerError, wantServerError: true},
+		{name: "redirect", status: http.StatusNotModified, wantSentinel: ErrUnexpectedStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.Header().Set("X-Request-Id", "42")
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			c, err := New(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = c.Do(context.Background(), RequestSpec{Method: http.MethodDelete, Endpoint: "/users/7"})
+
+			var not200Err *ClientResponseNot200Error
+			if !errors.As(err, &not200Err) {
+				t.Fatalf("Do() error = %v, want ClientResponseNot200Error", err)
+			}
+			for _, sentinel := range []error{ErrClientError, ErrServerError, ErrUnexpectedStatus} {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.wantSentinel) {
+					t.Fatalf("errors.Is(err, %v) = %v, want only %v", sentinel, got, tt.wantSentinel)
+				}
+			}
+
+			if not200Err.ClientResponseCode != tt.status || not200Err.Method != http.MethodDelete ||
+				not200Err.URL != server.URL+"/users/7" || not200Err.ClientResponseHeader.Get("X-Request-Id") != "42" {
+				t.Fatalf("error = %+v, want the status, request and headers of the response", not200Err)
+			}
+			if not200Err.IsNotFound() != tt.wantNotFound || not200Err.IsClientError() != tt.wantClientError ||
+				not200Err.IsServerError() != tt.wantServerError || not200Err.IsRetryable() != tt.wantRetryable {
+				t.Fatalf("IsNotFound %v, IsClientError %v, IsServerError %v, IsRetryable %v", not200Err.IsNotFound(),
+					not200Err.IsClientError(), not200Err.IsServerError(), not200Err.IsRetryable())
+			}
+
+			if !reflect.DeepEqual(not200Err.Problem, tt.wantProblem) {
+				t.Fatalf("Problem = %+v, want %+v", not200Err.Problem, tt.wantProblem)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSSERetry = 3 * time.Second
+
+// Event is a Server-Sent Event. Event is "message" unless the server sets another type.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// StreamNDJSON sends the request and yields every line of a newline-delimited JSON response.
+// The stream is not bound by the client timeout, cancel ctx or stop the iteration to close it.
+func (c *Client) StreamNDJSON(ctx context.Context, spec RequestSpec) iter.Seq2[json.RawMessage, error] {
+	return func(yield func(json.RawMessage, error) bool) {
+		spec.Headers = streamHeaders(spec.Headers, map[string]string{"Accept": "application/x-ndjson"})
+
+		resp, err := c.openStream(ctx, spec)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				if !yield(json.RawMessage(line), nil) {
+					return
+				}
+			}
+
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// StreamJSON is StreamNDJSON that decodes every record into T.
+func StreamJSON[T any](ctx context.Context, c *Client, spec RequestSpec) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for raw, err := range c.StreamNDJSON(ctx, spec) {
+			var record T
+			if err == nil {
+				err = json.Unmarshal(raw, &record)
+			}
+
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+}
+
+// StreamEvents sends the request and yields Server-Sent Events of a text/event-stream response.
+// When the connection is closed it reconnects after the retry delay sent by the server (3s by default)
+// with the Last-Event-ID header. Connection errors, a broken connection in the middle of the stream
+// included, are yielded and the stream reconnects if the iteration goes on; an error building the request,
+// an unaccepted response status or 204 No Content ends the stream.
+// The stream is not bound by the client timeout, cancel ctx or stop the iteration to close it.
+func (c *Client) StreamEvents(ctx context.Context, spec RequestSpec) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		headers := spec.Headers
+		lastEventID := ""
+		retry := defaultSSERetry
+
+		for {
+			extra := map[string]string{"Accept": "text/event-stream", "Cache-Control": "no-cache"}
+			spec.Headers = streamHeaders(headers, extra)
+			if lastEventID != "" {
+				spec.Headers["Last-Event-ID"] = lastEventID
+			}
+
+			req, err := c.newRequest(ctx, spec)
+			if err != nil {
+				// the same spec fails the same way on every reconnect
+				yield(Event{}, err)
+				return
+			}
+
+			resp, err := c.sendStream(req)
+			var not200Err *ClientResponseNot200Error
+			switch {
+			case ctx.Err() != nil:
+				return
+			case errors.As(err, &not200Err):
+				yield(Event{}, err)
+				return
+			case err != nil:
+				if !yield(Event{}, err) {
+					return
+				}
+			case resp.StatusCode == http.StatusNoContent:
+				_ = resp.Body.Close()
+				return
+			default:
+				stopped, err := readEvents(resp.Body, func(event Event, hasID bool) bool {
+					// an empty id resets the last event ID, it is not sent on reconnect then
+					if hasID {
+						lastEventID = event.ID
+					}
+					if event.Retry > 0 {
+						retry = event.Retry
+					}
+
+					return event.Data == "" || yield(event, nil)
+				})
+				_ = resp.Body.Close()
+
+				if stopped {
+					return
+				}
+				if err != nil && ctx.Err() == nil && !yield(Event{}, err) {
+					return
+				}
+			}
+
+			if err := sleepContext(ctx, retry); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) openStream(ctx context.Context, spec RequestSpec) (*http.Response, error) {
+	req, err := c.newRequest(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.sendStream(req)
+}
+
+func (c *Client) sendStream(req *http.Request) (*http.Response, error) {
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.checkResponse(req, resp)
+}
+
+// readEvents parses the event stream and calls emit for every event until emit returns false.
+// Events without data are emitted too so that their id and retry fields are not lost, hasID tells
+// an empty id field, which resets the last event ID, from a missing one.
+// It reports whether emit stopped the reading and the read error other than io.EOF.
+func readEvents(body io.Reader, emit func(event Event, hasID bool) bool) (bool, error) {
+	reader := bufio.NewReader(body)
+
+	var event Event
+	var data strings.Builder
+	hasData, hasID := false, false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			// an incomplete event at the end of the stream is discarded
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if hasData || hasID || event.Retry > 0 {
+				event.Data = data.String()
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				if !emit(event, hasID) {
+					return true, nil
+				}
+			}
+
+			event = Event{}
+			data.Reset()
+			hasData, hasID = false, false
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				event.ID = value
+				hasID = true
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func streamHeaders(headers map[string]string, defaults map[string]string) map[string]string {
+	merged := make(map[string]string, len(headers)+len(defaults)+1)
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range headers {
+		merged[key] = value
+	}
+
+	return merged
+}
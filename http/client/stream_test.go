@@ -0,0 +1,297 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestStreamEventsRequestError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	errs := 0
+	for _, err := range c.StreamEvents(ctx, RequestSpec{Method: http.MethodGet, Endpoint: "/events", Query: 42}) {
+		if err == nil {
+			t.Fatal("StreamEvents() yielded an event, want an error")
+		}
+		errs++
+	}
+
+	if errs != 1 || ctx.Err() != nil {
+		t.Fatalf("StreamEvents() yielded %d errors (context error %v), want the stream to end after one", errs, ctx.Err())
+	}
+	if calls.Load() != 0 {
+		t.Fatalf("upstream calls = %d, want 0", calls.Load())
+	}
+}
+
+func TestStreamJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/x-ndjson" {
+			t.Errorf("Accept = %q, want application/x-ndjson", r.Header.Get("Accept"))
+		}
+
+		flusher := w.(http.Flusher)
+		for _, line := range []string{`{"id":1}` + "\n", "\n", `{"id":2}` + "\r\n", `{"id":` + "\n"} {
+			_, _ = io.WriteString(w, line)
+			flusher.Flush()
+			// the stream outlives the client timeout
+			time.Sleep(30 * time.Millisecond)
+		}
+		_, _ = io.WriteString(w, `{"id":3}`)
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL, WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type record struct {
+		ID int `json:"id"`
+	}
+
+	var records []record
+	errs := 0
+	for rec, err := range StreamJSON[record](context.Background(), c, RequestSpec{Method: http.MethodGet, Endpoint: "/records"}) {
+		if err != nil {
+			errs++
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	if fmt.Sprint(records) != "[{1} {2} {3}]" || errs != 1 {
+		t.Fatalf("StreamJSON() records = %v with %d errors, want [{1} {2} {3}] and one error for the invalid line", records, errs)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		want      []Event
+		wantHasID []bool
+	}{
+		{
+			name:   "multi-line data",
+			stream: "data: first\ndata: second\n\n",
+			want:   []Event{{Event: "message", Data: "first\nsecond"}},
+		},
+		{
+			name:   "fields",
+			stream: "id: 7\nevent: update\nretry: 1500\ndata:{\"a\":1}\n\n",
+			want:   []Event{{ID: "7", Event: "update", Retry: 1500 * time.Millisecond, Data: `{"a":1}`}},
+		},
+		{
+			name:   "comments and CRLF",
+			stream: ": keep-alive\r\ndata: a\r\n\r\n:ping\n\ndata: b\n\n",
+			want:   []Event{{Event: "message", Data: "a"}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:   "event without data",
+			stream: "id: 3\n\nretry: 10\n\n",
+			want:   []Event{{ID: "3", Event: "message"}, {Event: "message", Retry: 10 * time.Millisecond}},
+		},
+		{
+			name:   "invalid retry and id",
+			stream: "retry: soon\nid: a\x00b\ndata: x\n\n",
+			want:   []Event{{Event: "message", Data: "x"}},
+		},
+		{
+			name:   "incomplete last event",
+			stream: "data: a\n\ndata: b\n",
+			want:   []Event{{Event: "message", Data: "a"}},
+		},
+		{
+			name:      "empty id",
+			stream:    "id: 3\ndata: a\n\nid\n\nid:\ndata: b\n\ndata: c\n\n",
+			want:      []Event{{ID: "3", Event: "message", Data: "a"}, {Event: "message"}, {Event: "message", Data: "b"}, {Event: "message", Data: "c"}},
+			wantHasID: []bool{true, true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Event
+			var hasIDs []bool
+			stopped, err := readEvents(strings.NewReader(tt.stream), func(event Event, hasID bool) bool {
+				got = append(got, event)
+				hasIDs = append(hasIDs, hasID)
+				return true
+			})
+			if stopped || err != nil {
+				t.Fatalf("readEvents() = %v, %v, want the end of the stream", stopped, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("readEvents() = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantHasID != nil && !reflect.DeepEqual(hasIDs, tt.wantHasID) {
+				t.Fatalf("readEvents() hasID = %v, want %v", hasIDs, tt.wantHasID)
+			}
+		})
+	}
+}
+
+func TestReadEventsError(t *testing.T) {
+	errBroken := errors.New("connection reset")
+	body := io.MultiReader(strings.NewReader("data: a\n\ndata: b\n"), iotest.ErrReader(errBroken))
+
+	var got []string
+	stopped, err := readEvents(body, func(event Event, _ bool) bool {
+		got = append(got, event.Data)
+		return true
+	})
+
+	if stopped || !errors.Is(err, errBroken) {
+		t.Fatalf("readEvents() = %v, %v, want the read error", stopped, err)
+	}
+	if fmt.Sprint(got) != "[a]" {
+		t.Fatalf("readEvents() emitted %v, want [a]", got)
+	}
+}
+
+func TestStreamEventsReconnect(t *testing.T) {
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+
+		switch len(lastEventIDs) {
+		case 1:
+			_, _ = io.WriteString(w, "retry: 10\nid: 1\ndata: a\n\n")
+		case 2:
+			// the empty id resets the last event ID
+			_, _ = io.WriteString(w, "id: 2\ndata: b\n\nid:\ndata: c\n\n")
+		case 3:
+			_, _ = io.WriteString(w, "data: d\n\n")
+		default:
+			// 204 tells the client to stop reconnecting
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var data []string
+	for event, err := range c.StreamEvents(ctx, RequestSpec{Method: http.MethodGet, Endpoint: "/events"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, event.Data)
+	}
+
+	if fmt.Sprint(data) != "[a b c d]" {
+		t.Fatalf("StreamEvents() data = %v, want [a b c d]", data)
+	}
+	if got := fmt.Sprintf("%q", lastEventIDs); got != `["" "1" "" ""]` {
+		t.Fatalf("Last-Event-ID of the connections = %s, want none, 1 and none after the reset", got)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("StreamEvents() did not reconnect after the retry delay sent by the server")
+	}
+}
+
+func TestStreamEventsBrokenConnection(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if connections.Add(1) > 1 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		_, _ = io.WriteString(w, "retry: 10\ndata: a\n\ndata: b")
+		w.(http.Flusher).Flush()
+
+		// the connection breaks in the middle of the chunked response
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var data []string
+	var errs []error
+	for event, err := range c.StreamEvents(ctx, RequestSpec{Method: http.MethodGet, Endpoint: "/events"}) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		data = append(data, event.Data)
+	}
+
+	if fmt.Sprint(data) != "[a]" || len(errs) != 1 {
+		t.Fatalf("StreamEvents() data = %v, errors = %v, want [a] and the read error", data, errs)
+	}
+	if got := connections.Load(); got != 2 {
+		t.Fatalf("connections = %d, want a reconnect after the read error", got)
+	}
+}
+
+func TestStreamEventsCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "data: a\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := 0
+	for _, err := range c.StreamEvents(ctx, RequestSpec{Method: http.MethodGet, Endpoint: "/events"}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		events++
+		cancel()
+	}
+
+	if events != 1 {
+		t.Fatalf("StreamEvents() yielded %d events, want the stream to end on cancel after one", events)
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/viktor8881/service-utilities/http/client"
+
+// TracingRoundTripper is a http.RoundTripper that starts a client span for every request and injects
+// the W3C traceparent header. The span is named by the method and route (see ContextWithRoute) and ends
+// when the response body is read to the end or closed.
+//
+// TracerProvider defaults to the otel global one. Propagator defaults to propagation.TraceContext, as with
+// server.TracingMiddleware, and not to the otel global that drops the trace context unless it is set.
+type TracingRoundTripper struct {
+	Proxied        http.RoundTripper
+	TracerProvider trace.TracerProvider
+	Propagator     propagation.TextMapPropagator
+}
+
+func NewTracingRoundTripper(proxied http.RoundTripper) *TracingRoundTripper {
+	return &TracingRoundTripper{
+		Proxied:    proxied,
+		Propagator: propagation.TraceContext{},
+	}
+}
+
+func (trt *TracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tracerProvider := trt.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	propagator := trt.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	route := RouteFromContext(req.Context())
+	name := req.Method
+	if route != "" {
+		name += " " + route
+	}
+
+	ctx, span := tracerProvider.Tracer(tracerName).Start(req.Context(), name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.Redacted()),
+			attribute.String("server.address", req.URL.Hostname()),
+		),
+	)
+	if route != "" {
+		span.SetAttributes(attribute.String("http.route", route))
+	}
+	// the resend count does not include the first attempt
+	if resends := RetryAttemptFromContext(ctx) - 1; resends > 0 {
+		span.SetAttributes(attribute.Int("http.request.resend_count", resends))
+	}
+
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := trt.Proxied.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, strconv.Itoa(resp.StatusCode))
+	}
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		span.End()
+	} else {
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { span.End() }}
+	}
+
+	return resp, nil
+}
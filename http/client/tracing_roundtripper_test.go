@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+
+	return attributes
+}
+
+func TestTracingRoundTripper(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		route      string
+		wantName   string
+		wantStatus codes.Code
+	}{
+		{name: "success", status: http.StatusOK, route: "/users/{id}", wantName: "GET /users/{id}", wantStatus: codes.Unset},
+		{name: "without route", status: http.StatusOK, wantName: "GET", wantStatus: codes.Unset},
+		{name: "client error", status: http.StatusNotFound, route: "/users/{id}", wantName: "GET /users/{id}", wantStatus: codes.Error},
+		{name: "server error", status: http.StatusBadGateway, route: "/users/{id}", wantName: "GET /users/{id}", wantStatus: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var traceparent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceparent = r.Header.Get("Traceparent")
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, "body")
+			}))
+			defer server.Close()
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			trt := NewTracingRoundTripper(http.DefaultTransport)
+			trt.TracerProvider = provider
+
+			ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+			if tt.route != "" {
+				ctx = ContextWithRoute(ctx, tt.route)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/users/7", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := trt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recorder.Ended()) != 0 {
+				t.Fatal("span ended before the response body was closed")
+			}
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			parent.End()
+
+			spans := recorder.Ended()
+			if len(spans) != 2 {
+				t.Fatalf("recorded %d spans, want the client span and its parent", len(spans))
+			}
+			span := spans[0]
+
+			if span.Name() != tt.wantName || span.SpanKind() != trace.SpanKindClient {
+				t.Fatalf("span %q of kind %v, want client span %q", span.Name(), span.SpanKind(), tt.wantName)
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Fatalf("span status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Fatal("client span is not a child of the span in the request context")
+			}
+
+			attributes := spanAttributes(span)
+			if got := attributes["http.response.status_code"].AsInt64(); got != int64(tt.status) {
+				t.Fatalf("http.response.status_code = %d, want %d", got, tt.status)
+			}
+			if got := attributes["http.request.method"].AsString(); got != http.MethodGet {
+				t.Fatalf("http.request.method = %q", got)
+			}
+			if got := attributes["http.route"].AsString(); got != tt.route {
+				t.Fatalf("http.route = %q, want %q", got, tt.route)
+			}
+
+			// the upstream continues the trace of the client span
+			carrier := propagation.HeaderCarrier(http.Header{"Traceparent": {traceparent}})
+			remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+			if remote.TraceID() != span.SpanContext().TraceID() || remote.SpanID() != span.SpanContext().SpanID() {
+				t.Fatalf("traceparent = %q, want the client span %s", traceparent, span.SpanContext().SpanID())
+			}
+		})
+	}
+}
+
+func TestTracingRoundTripperError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	trt := NewTracingRoundTripper(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}))
+	trt.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	req, err := http.NewRequest(http.MethodPost, "http://users.local/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trt.RoundTrip(req); err == nil {
+		t.Fatal("RoundTrip() error = nil, want the transport error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	if status := spans[0].Status(); status.Code != codes.Error || status.Description != "connection refused" {
+		t.Fatalf("span status = %+v, want the transport error", status)
+	}
+	if events := spans[0].Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Fatalf("span events = %+v, want the recorded error", events)
+	}
+}
+
+func TestTracingRoundTripperDefaultPropagator(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+
+	var traceparent string
+	trt := &TracingRoundTripper{
+		Proxied: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			traceparent = req.Header.Get("Traceparent")
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}),
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://users.local/users", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	carrier := propagation.HeaderCarrier(http.Header{"Traceparent": {traceparent}})
+	remote := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if remote.SpanID() != spans[0].SpanContext().SpanID() {
+		t.Fatalf("traceparent = %q, want the client span injected without a Propagator", traceparent)
+	}
+}
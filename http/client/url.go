@@ -0,0 +1,294 @@
+package client
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	placeholderRe = regexp.MustCompile(`\{[^{}/?&=]+\}`)
+	timeType      = reflect.TypeOf(time.Time{})
+)
+
+type paramKind int
+
+const (
+	// legacyParam is an untagged field: it fills the "{lowercased name}" placeholder,
+	// or becomes a query parameter when the template has no placeholders at all.
+	legacyParam paramKind = iota
+	pathParam
+	queryParam
+)
+
+type urlParam struct {
+	kind      paramKind
+	name      string
+	values    []string
+	isNil     bool
+	isZero    bool
+	omitEmpty bool
+}
+
+// BuildURL fills the template with the fields of input (a struct or a pointer to a struct).
+//
+// Fields tagged `path:"id"` replace the "{id}" placeholder, the value is escaped.
+// Fields tagged `query:"name"` are added as query parameters, slices produce repeated keys.
+// Tag options:
+//   - omitempty: skip the query parameter when the value is zero;
+//   - format=<layout>: format time.Time values with a layout, or one of "unix", "unixmilli",
+//     "date" (2006-01-02); RFC 3339 is used by default. It must be the last option, the rest of
+//     the tag is the layout, which may contain commas (e.g. time.RFC1123).
+//
+// Nil pointers are omitted from the query and are an error for path parameters.
+// Embedded structs are flattened. Untagged fields keep the previous behaviour: the lowercased
+// field name is used as the placeholder or the query parameter name. A placeholder left
+// unresolved is an error.
+func BuildURL(template string, input interface{}) (string, error) {
+	params, err := collectURLParams(input)
+	if err != nil {
+		return "", err
+	}
+
+	legacyQuery := !strings.Contains(template, "{")
+
+	pathPart, queryPart, hasQuery := strings.Cut(template, "?")
+	var query []urlParam
+	for _, p := range params {
+		placeholder := "{" + p.name + "}"
+		usesPlaceholder := strings.Contains(pathPart, placeholder) || strings.Contains(queryPart, placeholder)
+
+		switch {
+		case p.kind == queryParam, p.kind == legacyParam && legacyQuery:
+			query = append(query, p)
+			continue
+		case p.kind == legacyParam && !usesPlaceholder:
+			continue
+		case p.kind == pathParam && !usesPlaceholder:
+			return "", fmt.Errorf("path parameter %q has no placeholder in %q", p.name, template)
+		case p.isNil || len(p.values) == 0 || (p.kind == pathParam && strings.Join(p.values, "") == ""):
+			return "", fmt.Errorf("path parameter %q has no value", p.name)
+		}
+
+		pathPart = strings.ReplaceAll(pathPart, placeholder, escapeValues(p.values, url.PathEscape))
+		queryPart = strings.ReplaceAll(queryPart, placeholder, escapeValues(p.values, url.QueryEscape))
+	}
+
+	result := pathPart
+	if hasQuery {
+		result += "?" + queryPart
+	}
+
+	if unresolved := placeholderRe.FindString(result); unresolved != "" {
+		return "", fmt.Errorf("unresolved placeholder %s in %q", unresolved, template)
+	}
+
+	if len(query) == 0 {
+		return result, nil
+	}
+
+	dataUrl, err := url.Parse(result)
+	if err != nil {
+		return result, err
+	}
+
+	values := dataUrl.Query()
+	for _, p := range query {
+		if p.isNil || (p.omitEmpty && p.isZero) {
+			continue
+		}
+		for _, value := range p.values {
+			values.Add(p.name, value)
+		}
+	}
+
+	dataUrl.RawQuery = values.Encode()
+	return dataUrl.String(), nil
+}
+
+func collectURLParams(input interface{}) ([]urlParam, error) {
+	v := reflect.ValueOf(input)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("input is not a struct or pointer to a struct")
+	}
+
+	var params []urlParam
+	if err := appendURLParams(&params, v); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func appendURLParams(params *[]urlParam, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		pathTag, hasPath := field.Tag.Lookup("path")
+		queryTag, hasQuery := field.Tag.Lookup("query")
+
+		if field.Anonymous && !hasPath && !hasQuery {
+			embedded := v.Field(i)
+			for embedded.Kind() == reflect.Ptr && !embedded.IsNil() {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && embedded.Type() != timeType {
+				if err := appendURLParams(params, embedded); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		p := urlParam{kind: legacyParam, name: strings.ToLower(field.Name)}
+		tag := ""
+		switch {
+		case hasPath:
+			p.kind, tag = pathParam, pathTag
+		case hasQuery:
+			p.kind, tag = queryParam, queryTag
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if name != "" {
+			p.name = name
+		}
+
+		timeFormat := ""
+		if at := strings.Index(","+options, ",format="); at >= 0 {
+			timeFormat = options[at+len("format="):]
+			options = options[:max(at-1, 0)]
+		}
+		for _, option := range strings.Split(options, ",") {
+			if option == "omitempty" {
+				p.omitEmpty = true
+			}
+		}
+
+		fv := v.Field(i)
+		p.isZero = fv.IsZero()
+		for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+			if fv.IsNil() {
+				p.isNil = true
+				break
+			}
+			fv = fv.Elem()
+		}
+
+		if !p.isNil {
+			values, err := formatURLValues(fv, timeFormat)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			p.values = values
+			if fv.Kind() == reflect.Slice && fv.Len() == 0 {
+				p.isZero = true
+			}
+		}
+
+		*params = append(*params, p)
+	}
+
+	return nil
+}
+
+func formatURLValues(v reflect.Value, timeFormat string) ([]string, error) {
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+				if elem.IsNil() {
+					break
+				}
+				elem = elem.Elem()
+			}
+
+			value, err := formatURLValue(elem, timeFormat)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+
+		return values, nil
+	}
+
+	value, err := formatURLValue(v, timeFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{value}, nil
+}
+
+func formatURLValue(v reflect.Value, timeFormat string) (string, error) {
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		return "", nil
+	}
+
+	if v.Type() == timeType {
+		return formatTime(v.Interface().(time.Time), timeFormat), nil
+	}
+
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return string(v.Bytes()), nil
+	}
+
+	return fmt.Sprintf("%v", v.Interface()), nil
+}
+
+func formatTime(t time.Time, format string) string {
+	switch format {
+	case "", "rfc3339":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case "date":
+		return t.Format(time.DateOnly)
+	default:
+		return t.Format(format)
+	}
+}
+
+func escapeValues(values []string, escape func(string) string) string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = escape(value)
+	}
+
+	return strings.Join(escaped, ",")
+}
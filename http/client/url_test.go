@@ -0,0 +1,193 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+type urlStatus string
+
+func (s urlStatus) MarshalText() ([]byte, error) {
+	return []byte("status-" + string(s)), nil
+}
+
+type urlPage struct {
+	Limit  int `query:"limit,omitempty"`
+	Offset int `query:"offset"`
+}
+
+func TestBuildURL(t *testing.T) {
+	at := time.Date(2024, 3, 5, 7, 8, 9, 0, time.UTC)
+	id := 42
+	tests := []struct {
+		name     string
+		template string
+		input    interface{}
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "path parameter is escaped",
+			template: "/users/{id}/files/{name}",
+			input: struct {
+				ID   int    `path:"id"`
+				Name string `path:"name"`
+			}{ID: 7, Name: "a b/c"},
+			want: "/users/7/files/a%20b%2Fc",
+		},
+		{
+			name:     "path and query parameters",
+			template: "/users/{id}?fields=all",
+			input: struct {
+				ID     int    `path:"id"`
+				Search string `query:"q"`
+			}{ID: 7, Search: "a&b"},
+			want: "/users/7?fields=all&q=a%26b",
+		},
+		{
+			name:     "omitempty",
+			template: "/items",
+			input: struct {
+				Name  string   `query:"name,omitempty"`
+				Tags  []string `query:"tag,omitempty"`
+				Count int      `query:"count"`
+			}{},
+			want: "/items?count=0",
+		},
+		{
+			name:     "slice as repeated keys",
+			template: "/items",
+			input: struct {
+				Tags []string `query:"tag"`
+			}{Tags: []string{"a", "b"}},
+			want: "/items?tag=a&tag=b",
+		},
+		{
+			name:     "slice in path",
+			template: "/items/{ids}",
+			input: struct {
+				IDs []int `path:"ids"`
+			}{IDs: []int{1, 2}},
+			want: "/items/1,2",
+		},
+		{
+			name:     "time formats",
+			template: "/events",
+			input: struct {
+				Default time.Time `query:"default"`
+				Unix    time.Time `query:"unix,format=unix"`
+				Date    time.Time `query:"date,omitempty,format=date"`
+				Layout  time.Time `query:"layout,format=2006/01/02 15h"`
+			}{Default: at, Unix: at, Date: at, Layout: at},
+			want: "/events?date=2024-03-05&default=2024-03-05T07%3A08%3A09Z&layout=2024%2F03%2F05+07h&unix=1709622489",
+		},
+		{
+			name:     "layout with a comma",
+			template: "/events",
+			input: struct {
+				Since time.Time `query:"since,omitempty,format=Mon, 02 Jan 2006 15:04:05 MST"`
+			}{Since: at},
+			want: "/events?since=Tue%2C+05+Mar+2024+07%3A08%3A09+UTC",
+		},
+		{
+			name:     "text marshaler",
+			template: "/items",
+			input: struct {
+				Status urlStatus `query:"status"`
+			}{Status: "open"},
+			want: "/items?status=status-open",
+		},
+		{
+			name:     "embedded struct",
+			template: "/users/{id}/items",
+			input: struct {
+				urlPage
+				ID int `path:"id"`
+			}{urlPage: urlPage{Offset: 20}, ID: 7},
+			want: "/users/7/items?offset=20",
+		},
+		{
+			name:     "nil pointer in query",
+			template: "/items",
+			input: struct {
+				ID   *int `query:"id"`
+				Next *int `query:"next"`
+			}{ID: &id},
+			want: "/items?id=42",
+		},
+		{
+			name:     "nil pointer in path",
+			template: "/items/{id}",
+			input: struct {
+				ID *int `path:"id"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name:     "path parameter without placeholder",
+			template: "/items",
+			input: struct {
+				ID int `path:"id"`
+			}{ID: 1},
+			wantErr: true,
+		},
+		{
+			name:     "unresolved placeholder",
+			template: "/items/{id}",
+			input:    struct{}{},
+			wantErr:  true,
+		},
+		{
+			name:     "skipped field",
+			template: "/items",
+			input: struct {
+				Secret string `query:"-"`
+				Name   string `query:"name"`
+			}{Secret: "s", Name: "n"},
+			want: "/items?name=n",
+		},
+		{
+			name:     "untagged fields as placeholders",
+			template: "/user/{id}/profile/{name}",
+			input: struct {
+				ID   int
+				Name string
+				Age  int
+			}{ID: 1, Name: "john", Age: 30},
+			want: "/user/1/profile/john",
+		},
+		{
+			name:     "untagged fields as query",
+			template: "/users?active=true",
+			input: &struct {
+				ID   int
+				Name string
+			}{ID: 1, Name: "John"},
+			want: "/users?active=true&id=1&name=John",
+		},
+		{
+			name:     "nil input",
+			template: "/users",
+			input:    (*struct{ ID int })(nil),
+			want:     "/users",
+		},
+		{
+			name:     "not a struct",
+			template: "/users",
+			input:    42,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildURL(tt.template, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want && !tt.wantErr {
+				t.Fatalf("BuildURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
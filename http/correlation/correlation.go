@@ -0,0 +1,156 @@
+// Package correlation carries a request ID and W3C baggage through the context, from the incoming
+// request (server.CorrelationMiddleware) to outgoing calls (client.PropagationRoundTripper) and logs.
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+	HeaderBaggage   = "baggage"
+
+	// maxRequestIDLength limits the IDs accepted from incoming requests.
+	maxRequestIDLength = 128
+)
+
+type requestIDContextKey struct{}
+type baggageContextKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// NewID returns a random 32 character hex ID.
+func NewID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ValidRequestID reports whether an ID taken from an incoming request may be propagated further:
+// it is not empty, not longer than 128 characters and contains only printable ASCII without spaces.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithBaggage returns a context with the baggage member key set to value, other members are kept.
+// The key must be an RFC 7230 token (e.g. "tenant-id") to be propagated, see FormatBaggage.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	baggage := maps.Clone(baggageFromContext(ctx))
+	if baggage == nil {
+		baggage = make(map[string]string, 1)
+	}
+	baggage[key] = value
+
+	return context.WithValue(ctx, baggageContextKey{}, baggage)
+}
+
+// WithBaggageMap returns a context with the baggage members of m added, other members are kept.
+func WithBaggageMap(ctx context.Context, m map[string]string) context.Context {
+	if len(m) == 0 {
+		return ctx
+	}
+
+	baggage := maps.Clone(baggageFromContext(ctx))
+	if baggage == nil {
+		baggage = make(map[string]string, len(m))
+	}
+	maps.Copy(baggage, m)
+
+	return context.WithValue(ctx, baggageContextKey{}, baggage)
+}
+
+// BaggageFromContext returns a copy of the baggage members.
+func BaggageFromContext(ctx context.Context) map[string]string {
+	return maps.Clone(baggageFromContext(ctx))
+}
+
+func BaggageValue(ctx context.Context, key string) string {
+	return baggageFromContext(ctx)[key]
+}
+
+func baggageFromContext(ctx context.Context) map[string]string {
+	baggage, _ := ctx.Value(baggageContextKey{}).(map[string]string)
+	return baggage
+}
+
+// FormatBaggage encodes members as a W3C baggage header value, sorted by key. Values are percent-encoded,
+// keys must be RFC 7230 tokens and members with other keys are skipped.
+func FormatBaggage(baggage map[string]string) string {
+	members := make([]string, 0, len(baggage))
+	for _, key := range slices.Sorted(maps.Keys(baggage)) {
+		if !validBaggageKey(key) {
+			continue
+		}
+		members = append(members, key+"="+url.PathEscape(baggage[key]))
+	}
+
+	return strings.Join(members, ",")
+}
+
+// ParseBaggage decodes a W3C baggage header value, member properties are dropped and invalid members are skipped.
+func ParseBaggage(header string) map[string]string {
+	baggage := make(map[string]string)
+	for _, member := range strings.Split(header, ",") {
+		member, _, _ = strings.Cut(member, ";")
+
+		key, value, ok := strings.Cut(member, "=")
+		if !ok {
+			continue
+		}
+
+		key = strings.TrimSpace(key)
+		if !validBaggageKey(key) {
+			continue
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+
+		baggage[key] = value
+	}
+
+	return baggage
+}
+
+// validBaggageKey reports whether key is an RFC 7230 token, the only keys allowed by W3C baggage.
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
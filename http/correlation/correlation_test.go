@@ -0,0 +1,54 @@
+package correlation
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestFormatBaggage(t *testing.T) {
+	tests := []struct {
+		name    string
+		baggage map[string]string
+		want    string
+	}{
+		{name: "token keys", baggage: map[string]string{"tenant-id": "42", "user_id": "7"}, want: "tenant-id=42,user_id=7"},
+		{name: "value delimiters", baggage: map[string]string{"q": "a=b,c;d e"}, want: "q=a=b%2Cc%3Bd%20e"},
+		{name: "key with equals", baggage: map[string]string{"a=b": "1", "ok": "2"}, want: "ok=2"},
+		{name: "key with comma", baggage: map[string]string{"a,b": "1"}, want: ""},
+		{name: "key with semicolon", baggage: map[string]string{"a;b": "1"}, want: ""},
+		{name: "key with space", baggage: map[string]string{"a b": "1"}, want: ""},
+		{name: "non-ASCII key", baggage: map[string]string{"ключ": "1"}, want: ""},
+		{name: "empty key", baggage: map[string]string{"": "1"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatBaggage(tt.baggage); got != tt.want {
+				t.Fatalf("FormatBaggage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBaggage(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   map[string]string
+	}{
+		{name: "members", header: "tenant-id=42, user_id = 7", want: map[string]string{"tenant-id": "42", "user_id": "7"}},
+		{name: "properties are dropped", header: "k=v;prop=1", want: map[string]string{"k": "v"}},
+		{name: "percent-encoded value", header: "q=a%3Db%2Cc", want: map[string]string{"q": "a=b,c"}},
+		{name: "invalid key is skipped", header: "a b=1,k=v", want: map[string]string{"k": "v"}},
+		{name: "invalid value is skipped", header: "k=%zz,ok=1", want: map[string]string{"ok": "1"}},
+		{name: "round trip", header: FormatBaggage(map[string]string{"q": "a=b,c;d"}), want: map[string]string{"q": "a=b,c;d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseBaggage(tt.header); !maps.Equal(got, tt.want) {
+				t.Fatalf("ParseBaggage(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package faultinject
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// AdminHandler manages the rules at runtime: GET returns them, PUT replaces them with a Rules JSON body
+// and DELETE removes all of them. It answers 404 while injection is disabled. Expose it only on an
+// internal listener.
+func (i *Injector) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !i.enabled {
+			http.Error(w, "fault injection is disabled", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var rules Rules
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := i.SetRules(rules.Rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			i.logger.Info("faultinject: rules replaced", zap.Int("rules", len(rules.Rules)))
+		case http.MethodDelete:
+			_ = i.SetRules(nil)
+			i.logger.Info("faultinject: rules removed")
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Rules{Rules: i.Rules()})
+	})
+}
@@ -0,0 +1,69 @@
+package faultinject
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	injector := newTestInjector(t, Rule{Name: "initial", Fault: Fault{Reset: true}})
+	admin := injector.AdminHandler()
+
+	serve := func(method, body string) (int, []string) {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		admin.ServeHTTP(recorder, httptest.NewRequest(method, "/faults", strings.NewReader(body)))
+		if recorder.Code != http.StatusOK {
+			return recorder.Code, nil
+		}
+
+		var rules Rules
+		if err := json.NewDecoder(recorder.Body).Decode(&rules); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, rule := range rules.Rules {
+			names = append(names, rule.Name)
+		}
+		return recorder.Code, names
+	}
+
+	steps := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantRules  []string
+	}{
+		{name: "list", method: http.MethodGet, wantStatus: http.StatusOK, wantRules: []string{"initial"}},
+		{
+			name:       "enable rules",
+			method:     http.MethodPut,
+			body:       `{"rules":[{"name":"slow","path":"/users/*","fault":{"delay":"250ms"}},{"name":"down","fault":{"status":503}}]}`,
+			wantStatus: http.StatusOK,
+			wantRules:  []string{"slow", "down"},
+		},
+		{name: "list after enabling", method: http.MethodGet, wantStatus: http.StatusOK, wantRules: []string{"slow", "down"}},
+		{name: "invalid rule", method: http.MethodPut, body: `{"rules":[{"name":"none"}]}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPut, body: `{"rules":[{"name":"typo","falut":{"reset":true}}]}`, wantStatus: http.StatusBadRequest},
+		{name: "list after rejected changes", method: http.MethodGet, wantStatus: http.StatusOK, wantRules: []string{"slow", "down"}},
+		{name: "disable rules", method: http.MethodDelete, wantStatus: http.StatusOK, wantRules: []string{}},
+		{name: "list after disabling", method: http.MethodGet, wantStatus: http.StatusOK, wantRules: []string{}},
+		{name: "unsupported method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, step := range steps {
+		status, rules := serve(step.method, step.body)
+		if status != step.wantStatus || strings.Join(rules, ",") != strings.Join(step.wantRules, ",") {
+			t.Fatalf("%s: got %d %v, want %d %v", step.name, status, rules, step.wantStatus, step.wantRules)
+		}
+	}
+
+	if rules := injector.Rules(); len(rules) != 0 {
+		t.Fatalf("injector rules = %+v, want none after DELETE", rules)
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !faultinject
+
+package faultinject
+
+const buildEnabled = false
@@ -0,0 +1,55 @@
+//go:build !faultinject
+
+package faultinject
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestInjectorDisabledByDefault(t *testing.T) {
+	rules := []Rule{{Name: "reset", Fault: Fault{Reset: true}}}
+	injector, err := NewInjector(Config{Rules: rules}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer injector.Close()
+
+	if injector.Enabled() {
+		t.Fatal("Enabled() = true without the build tag and Config.Enabled")
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "upstream")
+	}))
+	defer upstream.Close()
+
+	req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewRoundTripper(http.DefaultTransport, injector).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v, want the request passed through", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "upstream" {
+		t.Fatalf("body = %q, want the upstream response", body)
+	}
+
+	next := http.NewServeMux()
+	if handler := Middleware(injector)(next); handler != http.Handler(next) {
+		t.Fatal("Middleware() wraps the handler, want it returned as is")
+	}
+
+	recorder := httptest.NewRecorder()
+	injector.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"rules":[]}`)))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("admin status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build faultinject
+
+package faultinject
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestInjectorEnabledByBuildTag(t *testing.T) {
+	injector, err := NewInjector(Config{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer injector.Close()
+
+	if !injector.Enabled() {
+		t.Fatal("Enabled() = false in a binary built with the faultinject tag")
+	}
+}
@@ -0,0 +1,342 @@
+// Package faultinject injects failures into outgoing and incoming HTTP requests to rehearse failure handling:
+// added latency, connection resets, status codes, truncated and slowly dripped bodies. Faults are described
+// by rules that can be changed at runtime through AdminHandler or a watched file.
+//
+// Injection is off unless the binary is built with the faultinject build tag or Config.Enabled is set,
+// a disabled Injector passes every request through untouched.
+package faultinject
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+const defaultReloadInterval = 2 * time.Second
+
+// Rule applies Fault to the requests it matches. Empty fields match everything.
+type Rule struct {
+	Name   string `json:"name" yaml:"name"`
+	Method string `json:"method,omitempty" yaml:"method,omitempty"`
+	// Host and Path are path.Match patterns, e.g. "/users/*". Host is only known to the client side.
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Headers must have exactly these values.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Percentage of the matching requests that get the fault, every one if 0.
+	Percentage float64 `json:"percentage,omitempty" yaml:"percentage,omitempty"`
+	Fault      Fault   `json:"fault" yaml:"fault"`
+}
+
+// Fault is what happens to a request. Delay is combined with the other faults, Reset and Status replace
+// the response, TruncateAfter and Drip change how the body (injected or real) is delivered.
+type Fault struct {
+	Delay Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// Reset closes the connection, the client gets a connection reset error.
+	Reset bool `json:"reset,omitempty" yaml:"reset,omitempty"`
+	// Status responds with the code and Body instead of calling the upstream or the handler.
+	Status int    `json:"status,omitempty" yaml:"status,omitempty"`
+	Body   string `json:"body,omitempty" yaml:"body,omitempty"`
+	// TruncateAfter cuts the body after that many bytes, the client gets an unexpected EOF.
+	TruncateAfter int64 `json:"truncate_after,omitempty" yaml:"truncate_after,omitempty"`
+	// DripInterval delivers the body in chunks of DripChunkSize bytes (1 by default) with the interval between them.
+	DripInterval  Duration `json:"drip_interval,omitempty" yaml:"drip_interval,omitempty"`
+	DripChunkSize int      `json:"drip_chunk_size,omitempty" yaml:"drip_chunk_size,omitempty"`
+}
+
+// Duration is a time.Duration written as a string like "250ms" in JSON and YAML.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+
+	return nil
+}
+
+// Rules is the format of the rules file and of the admin endpoint, YAML when the file extension
+// is .yaml or .yml and JSON otherwise.
+type Rules struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+type Config struct {
+	// Enabled turns injection on in a binary built without the faultinject build tag.
+	Enabled bool
+	Rules   []Rule
+	// File is a rules file loaded on start and reloaded when it changes, checked every ReloadInterval
+	// (2 seconds by default).
+	File           string
+	ReloadInterval time.Duration
+}
+
+// Injector holds the current rules and picks the fault for a request.
+type Injector struct {
+	enabled bool
+	logger  *zap.Logger
+
+	rules atomic.Pointer[[]Rule]
+
+	injectedCounter *prometheus.CounterVec
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewInjector validates the rules and, with Config.File, loads the file and watches it until Close is called.
+func NewInjector(config Config, logger *zap.Logger) (*Injector, error) {
+	i := &Injector{
+		enabled: buildEnabled || config.Enabled,
+		logger:  logger,
+	}
+	i.injectedCounter = newInjectedCounter(nil)
+
+	if err := i.SetRules(config.Rules); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+
+	if config.File != "" {
+		modTime, err := i.loadFile(config.File)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		interval := config.ReloadInterval
+		if interval <= 0 {
+			interval = defaultReloadInterval
+		}
+
+		i.wg.Add(1)
+		go i.watch(ctx, config.File, interval, modTime)
+	}
+
+	if i.enabled {
+		logger.Warn("faultinject: fault injection is enabled", zap.Int("rules", len(i.Rules())))
+	}
+
+	return i, nil
+}
+
+func (i *Injector) Enabled() bool {
+	return i.enabled
+}
+
+// Rules returns a copy of the current rules.
+func (i *Injector) Rules() []Rule {
+	rules := *i.rules.Load()
+	return append(make([]Rule, 0, len(rules)), rules...)
+}
+
+// SetRules replaces the rules if all of them are valid.
+func (i *Injector) SetRules(rules []Rule) error {
+	for n, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("faultinject: rule %d %q: %w", n, rule.Name, err)
+		}
+	}
+
+	rules = append([]Rule(nil), rules...)
+	i.rules.Store(&rules)
+
+	return nil
+}
+
+// Close stops watching the rules file.
+func (i *Injector) Close() {
+	i.cancel()
+	i.wg.Wait()
+}
+
+// RegisterMetrics registers the metrics in registerer with the name label set to name, before the injector is used.
+func (i *Injector) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	i.injectedCounter = metrics.MustRegisterOrExisting(registerer, newInjectedCounter(prometheus.Labels{"name": name}))
+}
+
+// match returns the fault of the first rule that matches the request and wins the percentage roll.
+func (i *Injector) match(r *http.Request, side string) (Rule, bool) {
+	if !i.enabled {
+		return Rule{}, false
+	}
+
+	for _, rule := range *i.rules.Load() {
+		if !rule.matches(r) {
+			continue
+		}
+		if rule.Percentage > 0 && rand.Float64()*100 >= rule.Percentage {
+			continue
+		}
+
+		i.injectedCounter.WithLabelValues(rule.Name, side).Inc()
+		return rule, true
+	}
+
+	return Rule{}, false
+}
+
+func (i *Injector) loadFile(file string) (time.Time, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("faultinject: %w", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("faultinject: %w", err)
+	}
+
+	var rules Rules
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(data, &rules)
+	} else {
+		err = json.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("faultinject: parse %s: %w", file, err)
+	}
+
+	return info.ModTime(), i.SetRules(rules.Rules)
+}
+
+func (i *Injector) watch(ctx context.Context, file string, interval time.Duration, modTime time.Time) {
+	defer i.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(file)
+		if err != nil || info.ModTime().Equal(modTime) {
+			continue
+		}
+
+		loaded, err := i.loadFile(file)
+		if err != nil {
+			i.logger.Error("faultinject: reload rules failed", zap.Error(err))
+			// the file is not read again until it changes
+			modTime = info.ModTime()
+			continue
+		}
+		modTime = loaded
+
+		i.logger.Info("faultinject: rules reloaded", zap.String("file", file), zap.Int("rules", len(i.Rules())))
+	}
+}
+
+func (rule Rule) validate() error {
+	fault := rule.Fault
+	switch {
+	case rule.Percentage < 0 || rule.Percentage > 100:
+		return errors.New("percentage must be between 0 and 100")
+	case fault.Status != 0 && (fault.Status < 100 || fault.Status > 599):
+		return fmt.Errorf("invalid status %d", fault.Status)
+	case fault.Reset && fault.Status != 0:
+		return errors.New("reset and status are exclusive")
+	case fault.Delay < 0 || fault.DripInterval < 0 || fault.TruncateAfter < 0 || fault.DripChunkSize < 0:
+		return errors.New("negative values are not allowed")
+	case fault.Delay == 0 && !fault.Reset && fault.Status == 0 && fault.TruncateAfter == 0 && fault.DripInterval == 0:
+		return errors.New("no fault")
+	}
+
+	for _, pattern := range []string{rule.Host, rule.Path} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func (rule Rule) matches(r *http.Request) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+
+	if rule.Host != "" {
+		if ok, _ := path.Match(rule.Host, r.URL.Host); !ok {
+			return false
+		}
+	}
+
+	if rule.Path != "" {
+		if ok, _ := path.Match(rule.Path, r.URL.Path); !ok {
+			return false
+		}
+	}
+
+	for name, value := range rule.Headers {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (fault Fault) dripChunkSize() int {
+	if fault.DripChunkSize > 0 {
+		return fault.DripChunkSize
+	}
+
+	return 1
+}
+
+func newInjectedCounter(constLabels prometheus.Labels) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "http_fault_injections_total",
+			Help:        "Total number of injected faults.",
+			ConstLabels: constLabels,
+		},
+		[]string{"rule", "side"},
+	)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
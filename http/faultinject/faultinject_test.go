@@ -0,0 +1,198 @@
+package faultinject
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func newTestInjector(t *testing.T, rules ...Rule) *Injector {
+	t.Helper()
+
+	injector, err := NewInjector(Config{Enabled: true, Rules: rules}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(injector.Close)
+
+	return injector
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		method string
+		url    string
+		header http.Header
+		want   bool
+	}{
+		{name: "empty rule", url: "http://users.local/users/1", want: true},
+		{name: "method", rule: Rule{Method: "get"}, method: http.MethodGet, url: "http://users.local/", want: true},
+		{name: "another method", rule: Rule{Method: http.MethodPost}, method: http.MethodGet, url: "http://users.local/"},
+		{name: "path pattern", rule: Rule{Path: "/users/*"}, url: "http://users.local/users/1", want: true},
+		{name: "path pattern does not cross segments", rule: Rule{Path: "/users/*"}, url: "http://users.local/users/1/orders"},
+		{name: "host pattern", rule: Rule{Host: "*.local"}, url: "http://users.local/", want: true},
+		{name: "another host", rule: Rule{Host: "orders.*"}, url: "http://users.local/"},
+		{name: "header", rule: Rule{Headers: map[string]string{"X-Chaos": "on"}}, url: "http://users.local/", header: http.Header{"X-Chaos": {"on"}}, want: true},
+		{name: "another header value", rule: Rule{Headers: map[string]string{"X-Chaos": "on"}}, url: "http://users.local/", header: http.Header{"X-Chaos": {"off"}}},
+		{name: "missing header", rule: Rule{Headers: map[string]string{"X-Chaos": "on"}}, url: "http://users.local/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+
+			if got := tt.rule.matches(req); got != tt.want {
+				t.Fatalf("matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectorMatch(t *testing.T) {
+	injector := newTestInjector(t,
+		Rule{Name: "users", Path: "/users", Fault: Fault{Status: http.StatusServiceUnavailable}},
+		Rule{Name: "never", Path: "/orders", Percentage: 0.000001, Fault: Fault{Status: http.StatusBadGateway}},
+		Rule{Name: "all", Fault: Fault{Status: http.StatusInternalServerError}},
+	)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/users", want: "users"},
+		// a rule that loses the percentage roll gives way to the next one
+		{path: "/orders", want: "all"},
+		{path: "/products", want: "all"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, "http://svc.local"+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rule, ok := injector.match(req, "client")
+		if !ok || rule.Name != tt.want {
+			t.Fatalf("%s matched rule %q (%t), want %q", tt.path, rule.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestInjectorMatchPercentage(t *testing.T) {
+	injector := newTestInjector(t, Rule{Name: "half", Percentage: 50, Fault: Fault{Status: http.StatusServiceUnavailable}})
+
+	req, err := http.NewRequest(http.MethodGet, "http://svc.local/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 2000
+	matched := 0
+	for range requests {
+		if _, ok := injector.match(req, "client"); ok {
+			matched++
+		}
+	}
+
+	if matched < requests*4/10 || matched > requests*6/10 {
+		t.Fatalf("%d of %d requests matched, want about half", matched, requests)
+	}
+}
+
+func TestSetRulesValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "no fault", rule: Rule{Path: "/users"}},
+		{name: "percentage", rule: Rule{Percentage: 101, Fault: Fault{Reset: true}}},
+		{name: "status", rule: Rule{Fault: Fault{Status: 700}}},
+		{name: "reset and status", rule: Rule{Fault: Fault{Reset: true, Status: http.StatusBadGateway}}},
+		{name: "negative delay", rule: Rule{Fault: Fault{Delay: Duration(-time.Second)}}},
+		{name: "pattern", rule: Rule{Path: "[", Fault: Fault{Reset: true}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valid := Rule{Name: "valid", Fault: Fault{Reset: true}}
+			injector := newTestInjector(t, valid)
+
+			if err := injector.SetRules([]Rule{valid, tt.rule}); err == nil {
+				t.Fatal("SetRules() accepted an invalid rule")
+			}
+			if rules := injector.Rules(); len(rules) != 1 || rules[0].Name != "valid" {
+				t.Fatalf("rules = %+v, want the previous ones kept", rules)
+			}
+		})
+	}
+}
+
+func TestInjectorReloadFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	writeRules := func(content string, modTime time.Time) {
+		t.Helper()
+
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// the watcher compares modification times, which may not change within a coarse clock tick
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForRules := func(injector *Injector, want ...string) {
+		t.Helper()
+
+		var names []string
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			names = names[:0]
+			for _, rule := range injector.Rules() {
+				names = append(names, rule.Name)
+			}
+			if len(names) == len(want) && (len(want) == 0 || names[0] == want[0]) {
+				return
+			}
+		}
+		t.Fatalf("rules = %v, want %v", names, want)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	writeRules("rules:\n  - name: slow\n    fault:\n      delay: 100ms\n", start)
+
+	injector, err := NewInjector(Config{Enabled: true, File: file, ReloadInterval: 5 * time.Millisecond}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer injector.Close()
+
+	if rules := injector.Rules(); len(rules) != 1 || rules[0].Fault.Delay != Duration(100*time.Millisecond) {
+		t.Fatalf("loaded rules = %+v, want the slow rule", rules)
+	}
+
+	writeRules("rules:\n  - name: reset\n    fault:\n      reset: true\n", start.Add(time.Minute))
+	waitForRules(injector, "reset")
+
+	// an invalid file keeps the current rules
+	writeRules("rules:\n  - name: broken\n", start.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	waitForRules(injector, "reset")
+
+	writeRules("rules: []\n", start.Add(3*time.Minute))
+	waitForRules(injector)
+}
@@ -0,0 +1,139 @@
+package faultinject
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/viktor8881/service-utilities/http/server"
+)
+
+// Middleware injects the faults of injector into incoming requests. Mount AdminHandler outside of it,
+// otherwise a broad rule can lock the admin endpoint out.
+func Middleware(injector *Injector) server.Middleware {
+	return func(next http.Handler) http.Handler {
+		if !injector.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := injector.match(r, "server")
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			fault := rule.Fault
+
+			if err := sleepContext(r.Context(), time.Duration(fault.Delay)); err != nil {
+				return
+			}
+
+			if fault.Reset {
+				resetConnection(w)
+				return
+			}
+
+			var fw http.ResponseWriter = w
+			if fault.TruncateAfter > 0 || fault.DripInterval > 0 {
+				fw = &faultResponseWriter{
+					ResponseWriter: w,
+					controller:     http.NewResponseController(w),
+					request:        r,
+					fault:          fault,
+					remaining:      fault.TruncateAfter,
+				}
+			}
+
+			if fault.Status != 0 {
+				fw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				fw.Header().Set("Content-Length", strconv.Itoa(len(fault.Body)))
+				fw.WriteHeader(fault.Status)
+				_, _ = fw.Write([]byte(fault.Body))
+				return
+			}
+
+			next.ServeHTTP(fw, r)
+		})
+	}
+}
+
+// resetConnection closes the connection with a TCP reset, HTTP/2 streams are aborted.
+func resetConnection(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// faultResponseWriter drips the body in chunks and drops the connection after fault.TruncateAfter bytes.
+type faultResponseWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	request    *http.Request
+	fault      Fault
+	remaining  int64
+	truncated  bool
+}
+
+func (fw *faultResponseWriter) Write(p []byte) (int, error) {
+	if fw.truncated {
+		return 0, http.ErrAbortHandler
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if fw.fault.DripInterval > 0 {
+			if err := sleepContext(fw.request.Context(), time.Duration(fw.fault.DripInterval)); err != nil {
+				return written, err
+			}
+			chunk = chunk[:min(len(chunk), fw.fault.dripChunkSize())]
+		}
+		if fw.fault.TruncateAfter > 0 {
+			chunk = chunk[:min(int64(len(chunk)), fw.remaining)]
+		}
+
+		n, err := fw.ResponseWriter.Write(chunk)
+		written += n
+		fw.remaining -= int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+
+		if fw.fault.DripInterval > 0 {
+			_ = fw.controller.Flush()
+		}
+
+		if fw.fault.TruncateAfter > 0 && fw.remaining <= 0 {
+			fw.truncate()
+			return written, http.ErrAbortHandler
+		}
+	}
+
+	return written, nil
+}
+
+func (fw *faultResponseWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+// truncate sends what is written so far and closes the connection before the rest of the body.
+func (fw *faultResponseWriter) truncate() {
+	fw.truncated = true
+
+	_ = fw.controller.Flush()
+	conn, buf, err := fw.controller.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	_ = buf.Flush()
+	_ = conn.Close()
+}
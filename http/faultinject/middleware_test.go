@@ -0,0 +1,103 @@
+package faultinject
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareFaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		fault       Fault
+		wantStatus  int
+		wantBody    string
+		wantReadErr bool
+		minDuration time.Duration
+	}{
+		{
+			name:        "truncate",
+			fault:       Fault{TruncateAfter: 4},
+			wantStatus:  http.StatusOK,
+			wantBody:    "0123",
+			wantReadErr: true,
+		},
+		{
+			name:        "drip",
+			fault:       Fault{DripInterval: Duration(10 * time.Millisecond), DripChunkSize: 2},
+			wantStatus:  http.StatusOK,
+			wantBody:    "0123456789",
+			minDuration: 50 * time.Millisecond,
+		},
+		{
+			name:       "status",
+			fault:      Fault{Status: http.StatusServiceUnavailable, Body: "unavailable"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "unavailable",
+		},
+		{
+			name:        "truncated status body",
+			fault:       Fault{Status: http.StatusBadGateway, Body: "bad gateway", TruncateAfter: 3},
+			wantStatus:  http.StatusBadGateway,
+			wantBody:    "bad",
+			wantReadErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := newTestInjector(t, Rule{Name: tt.name, Path: "/faulty", Fault: tt.fault})
+			server := httptest.NewServer(Middleware(injector)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Length", "10")
+				_, _ = io.WriteString(w, "0123456789")
+			})))
+			defer server.Close()
+
+			start := time.Now()
+			resp, err := http.Get(server.URL + "/faulty")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, readErr := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+			if (readErr != nil) != tt.wantReadErr {
+				t.Fatalf("read error = %v, want an error %t", readErr, tt.wantReadErr)
+			}
+			if tt.wantReadErr && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+				t.Fatalf("read error = %v, want %v", readErr, io.ErrUnexpectedEOF)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Fatalf("response took %s, want at least %s", elapsed, tt.minDuration)
+			}
+
+			// requests the rule does not match are served as is
+			resp, err = http.Get(server.URL + "/healthy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "0123456789" {
+				t.Fatalf("unmatched request got %q, %v, want the handler response", body, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareReset(t *testing.T) {
+	injector := newTestInjector(t, Rule{Name: "reset", Fault: Fault{Reset: true}})
+	server := httptest.NewServer(Middleware(injector)(http.NotFoundHandler()))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err == nil {
+		_ = resp.Body.Close()
+		t.Fatalf("got %d, want the connection reset", resp.StatusCode)
+	}
+}
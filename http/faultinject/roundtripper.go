@@ -0,0 +1,136 @@
+package faultinject
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RoundTripper is a http.RoundTripper that injects the faults of Injector into outgoing requests,
+// e.g. client.WithMiddleware(func(next http.RoundTripper) http.RoundTripper { return faultinject.NewRoundTripper(next, injector) }).
+type RoundTripper struct {
+	Proxied  http.RoundTripper
+	Injector *Injector
+}
+
+func NewRoundTripper(proxied http.RoundTripper, injector *Injector) *RoundTripper {
+	return &RoundTripper{
+		Proxied:  proxied,
+		Injector: injector,
+	}
+}
+
+// closeRequestBody closes the body of a request that is not sent, a round tripper must close it even on error.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule, ok := rt.Injector.match(req, "client")
+	if !ok {
+		return rt.Proxied.RoundTrip(req)
+	}
+	fault := rule.Fault
+
+	if err := sleepContext(req.Context(), time.Duration(fault.Delay)); err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	if fault.Reset {
+		closeRequestBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+
+	var resp *http.Response
+	if fault.Status != 0 {
+		closeRequestBody(req)
+		resp = injectedResponse(req, fault)
+	} else {
+		var err error
+		if resp, err = rt.Proxied.RoundTrip(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if fault.TruncateAfter > 0 {
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: fault.TruncateAfter}
+	}
+	if fault.DripInterval > 0 {
+		resp.Body = &drippingBody{
+			ReadCloser: resp.Body,
+			ctx:        req.Context(),
+			interval:   time.Duration(fault.DripInterval),
+			chunkSize:  fault.dripChunkSize(),
+		}
+	}
+
+	return resp, nil
+}
+
+func injectedResponse(req *http.Request, fault Fault) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(fault.Body)))
+
+	return &http.Response{
+		Status:        strconv.Itoa(fault.Status) + " " + http.StatusText(fault.Status),
+		StatusCode:    fault.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(fault.Body)),
+		ContentLength: int64(len(fault.Body)),
+		Request:       req,
+	}
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF after remaining bytes, as if the connection was lost.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (tb *truncatedBody) Read(p []byte) (int, error) {
+	if tb.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	if int64(len(p)) > tb.remaining {
+		p = p[:tb.remaining]
+	}
+
+	n, err := tb.ReadCloser.Read(p)
+	tb.remaining -= int64(n)
+
+	return n, err
+}
+
+// drippingBody returns at most chunkSize bytes per Read and waits interval before each of them.
+type drippingBody struct {
+	io.ReadCloser
+	ctx       context.Context
+	interval  time.Duration
+	chunkSize int
+}
+
+func (db *drippingBody) Read(p []byte) (int, error) {
+	if err := sleepContext(db.ctx, db.interval); err != nil {
+		return 0, err
+	}
+
+	if len(p) > db.chunkSize {
+		p = p[:db.chunkSize]
+	}
+
+	return db.ReadCloser.Read(p)
+}
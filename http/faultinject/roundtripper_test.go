@@ -0,0 +1,182 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRoundTripperFaults(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		_, _ = io.WriteString(w, "0123456789")
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name        string
+		fault       Fault
+		wantStatus  int
+		wantBody    string
+		wantReadErr error
+		wantCalls   int32
+		minDuration time.Duration
+	}{
+		{
+			name:        "truncate",
+			fault:       Fault{TruncateAfter: 4},
+			wantStatus:  http.StatusOK,
+			wantBody:    "0123",
+			wantReadErr: io.ErrUnexpectedEOF,
+			wantCalls:   1,
+		},
+		{
+			name:        "drip",
+			fault:       Fault{DripInterval: Duration(10 * time.Millisecond), DripChunkSize: 2},
+			wantStatus:  http.StatusOK,
+			wantBody:    "0123456789",
+			wantCalls:   1,
+			minDuration: 50 * time.Millisecond,
+		},
+		{
+			name:       "status",
+			fault:      Fault{Status: http.StatusServiceUnavailable, Body: "unavailable"},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   "unavailable",
+		},
+		{
+			name:        "truncated status body",
+			fault:       Fault{Status: http.StatusBadGateway, Body: "bad gateway", TruncateAfter: 3},
+			wantStatus:  http.StatusBadGateway,
+			wantBody:    "bad",
+			wantReadErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:        "delay",
+			fault:       Fault{Delay: Duration(30 * time.Millisecond)},
+			wantStatus:  http.StatusOK,
+			wantBody:    "0123456789",
+			wantCalls:   1,
+			minDuration: 30 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			injector := newTestInjector(t, Rule{Name: tt.name, Fault: tt.fault})
+
+			req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			resp, err := NewRoundTripper(http.DefaultTransport, injector).RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var body []byte
+			chunk := make([]byte, 64)
+			var readErr error
+			for readErr == nil {
+				var n int
+				n, readErr = resp.Body.Read(chunk)
+				if tt.fault.DripInterval > 0 && n > tt.fault.DripChunkSize {
+					t.Fatalf("Read() returned %d bytes, want at most %d", n, tt.fault.DripChunkSize)
+				}
+				body = append(body, chunk[:n]...)
+			}
+			if errors.Is(readErr, io.EOF) {
+				readErr = nil
+			}
+
+			if resp.StatusCode != tt.wantStatus || string(body) != tt.wantBody {
+				t.Fatalf("got %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, tt.wantBody)
+			}
+			if !errors.Is(readErr, tt.wantReadErr) {
+				t.Fatalf("read error = %v, want %v", readErr, tt.wantReadErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Fatalf("upstream got %d requests, want %d", got, tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Fatalf("response took %s, want at least %s", elapsed, tt.minDuration)
+			}
+		})
+	}
+}
+
+func TestRoundTripperReset(t *testing.T) {
+	injector := newTestInjector(t, Rule{Name: "reset", Fault: Fault{Reset: true}})
+
+	req, err := http.NewRequest(http.MethodGet, "http://users.local/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewRoundTripper(http.DefaultTransport, injector).RoundTrip(req)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("error = %v, want a connection reset", err)
+	}
+}
+
+// closeTrackingBody reports whether the request body was closed.
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRoundTripperClosesBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   Fault
+		timeout time.Duration
+	}{
+		{name: "canceled during the delay", fault: Fault{Delay: Duration(time.Hour)}, timeout: 10 * time.Millisecond},
+		{name: "reset", fault: Fault{Reset: true}},
+		{name: "status", fault: Fault{Status: http.StatusServiceUnavailable}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := newTestInjector(t, Rule{Name: tt.name, Fault: tt.fault})
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://users.local/", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := NewRoundTripper(http.DefaultTransport, injector).RoundTrip(req)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if !body.closed {
+				t.Fatalf("request body not closed, RoundTrip() error = %v", err)
+			}
+		})
+	}
+}
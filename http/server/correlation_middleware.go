@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
+)
+
+// CorrelationMiddleware stores the request ID from the requestIDHeader header (X-Request-ID if empty)
+// and the W3C baggage of the incoming request in the request context, so that client.PropagationRoundTripper
+// passes them on to outgoing calls. A missing or invalid ID is replaced with a new one, the ID is returned
+// in the response header.
+//
+// Middlewares are applied in order, so it should be listed after LoggerMiddleware for the ID to be logged.
+func CorrelationMiddleware(requestIDHeader string) Middleware {
+	if requestIDHeader == "" {
+		requestIDHeader = correlation.HeaderRequestID
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			requestID := r.Header.Get(requestIDHeader)
+			if !correlation.ValidRequestID(requestID) {
+				requestID = correlation.NewID()
+			}
+			ctx = correlation.WithRequestID(ctx, requestID)
+
+			if baggage := r.Header.Get(correlation.HeaderBaggage); baggage != "" {
+				ctx = correlation.WithBaggageMap(ctx, correlation.ParseBaggage(baggage))
+			}
+
+			w.Header().Set(requestIDHeader, requestID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
+)
+
+func TestCorrelationMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		requestID string
+		wantReuse bool
+	}{
+		{name: "reused", requestID: "req-42", wantReuse: true},
+		{name: "custom header", header: "X-Correlation-ID", requestID: "req-42", wantReuse: true},
+		{name: "generated when missing"},
+		{name: "generated when invalid", requestID: "req 42"},
+		{name: "generated when too long", requestID: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = correlation.HeaderRequestID
+			}
+
+			core, logs := observer.New(zap.InfoLevel)
+			var stored string
+			var baggage map[string]string
+			handler := applyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				stored = correlation.RequestIDFromContext(r.Context())
+				baggage = correlation.BaggageFromContext(r.Context())
+			}), LoggerMiddleware(zap.New(core)), CorrelationMiddleware(tt.header))
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.requestID != "" {
+				req.Header.Set(header, tt.requestID)
+			}
+			req.Header.Set(correlation.HeaderBaggage, "tenant=acme")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if tt.wantReuse && stored != tt.requestID {
+				t.Fatalf("request ID = %q, want the incoming %q", stored, tt.requestID)
+			}
+			if !tt.wantReuse && (stored == tt.requestID || !correlation.ValidRequestID(stored)) {
+				t.Fatalf("request ID = %q, want a new valid one", stored)
+			}
+			if got := rec.Header().Get(header); got != stored {
+				t.Fatalf("response %s = %q, want %q", header, got, stored)
+			}
+			if baggage["tenant"] != "acme" {
+				t.Fatalf("baggage = %v, want the incoming tenant", baggage)
+			}
+
+			entries := logs.All()
+			if len(entries) != 2 {
+				t.Fatalf("logged %d entries, want 2", len(entries))
+			}
+			for _, entry := range entries {
+				if got := entry.ContextMap()["requestID"]; got != stored {
+					t.Fatalf("logged requestID = %v, want %q", got, stored)
+				}
+			}
+		})
+	}
+}
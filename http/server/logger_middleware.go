@@ -6,6 +6,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
 )
 
 type loggingResponseWriter struct {
@@ -43,21 +45,24 @@ func LoggerMiddleware(logger *zap.Logger) func(next http.Handler) http.Handler {
 				r.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 			}
 
-			logger.Info("httpserver: incoming request",
+			fields := []zap.Field{
 				zap.String("url", r.Method+": "+r.URL.String()),
 				zap.String("requestBody", string(requestBody)),
-			)
+			}
+			if requestID := correlation.RequestIDFromContext(r.Context()); requestID != "" {
+				fields = append(fields, zap.String("requestID", requestID))
+			}
+
+			logger.Info("httpserver: incoming request", fields...)
 
 			lrw := newLoggingResponseWriter(w)
 			next.ServeHTTP(lrw, r)
 
 			duration := time.Since(start)
-			logger.Info("httpserver: request processed",
-				zap.String("url", r.Method+": "+r.URL.String()),
-				zap.String("requestBody", string(requestBody)),
+			logger.Info("httpserver: request processed", append(fields,
 				zap.Int("StatusResponse", lrw.statusCode),
 				zap.Duration("Duration", duration),
-			)
+			)...)
 		})
 	}
 }
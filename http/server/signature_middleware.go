@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/viktor8881/service-utilities/http/signature"
+)
+
+// SignatureMiddleware rejects requests without a valid signature made by client.SigningRoundTripper.
+// Failures are passed to errHandlerFn (ErrorHandler if nil) as a CustomError with code 401, the key ID
+// of a verified request is available through signature.KeyIDFromContext.
+func SignatureMiddleware(verifier *signature.Verifier, errHandlerFn ErrorHandlerFunc, logger *zap.Logger) Middleware {
+	if errHandlerFn == nil {
+		errHandlerFn = ErrorHandler
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keyID, err := verifier.Verify(r)
+			if err != nil {
+				errHandlerFn(w, r, &CustomError{
+					HttpCode:    http.StatusUnauthorized,
+					HttpMessage: "invalid request signature",
+					Err:         err,
+				}, logger)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(signature.WithKeyID(r.Context(), keyID)))
+		})
+	}
+}
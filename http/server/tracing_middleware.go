@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/viktor8881/service-utilities/http/server"
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (srw *statusResponseWriter) WriteHeader(code int) {
+	srw.statusCode = code
+	srw.ResponseWriter.WriteHeader(code)
+}
+
+func (srw *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return srw.ResponseWriter
+}
+
+// TracingMiddleware continues the trace extracted by propagator from the incoming request headers and starts
+// a server span named by the ServeMux pattern of the endpoint. A nil tracerProvider means the otel global one,
+// a nil propagator means the W3C traceparent header as with client.TracingRoundTripper.
+func TracingMiddleware(tracerProvider trace.TracerProvider, propagator propagation.TextMapPropagator) Middleware {
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tp := tracerProvider
+			if tp == nil {
+				tp = otel.GetTracerProvider()
+			}
+
+			name := r.Pattern
+			if name == "" {
+				name = r.Method
+			}
+
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tp.Tracer(tracerName).Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			if r.Pattern != "" {
+				span.SetAttributes(attribute.String("http.route", r.Pattern))
+			}
+
+			srw := &statusResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(srw, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.response.status_code", srw.statusCode))
+			if srw.statusCode >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(srw.statusCode))
+			}
+		})
+	}
+}
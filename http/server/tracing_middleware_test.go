@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	const (
+		traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID    = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name        string
+		status      int
+		traceparent string
+		wantStatus  codes.Code
+	}{
+		{name: "continues the incoming trace", status: http.StatusOK, traceparent: traceparent, wantStatus: codes.Unset},
+		{name: "starts a new trace", status: http.StatusCreated, wantStatus: codes.Unset},
+		{name: "client error", status: http.StatusNotFound, traceparent: traceparent, wantStatus: codes.Unset},
+		{name: "server error", status: http.StatusServiceUnavailable, traceparent: traceparent, wantStatus: codes.Error},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			var handlerSpan trace.SpanContext
+			mux := http.NewServeMux()
+			mux.Handle("GET /users/{id}", TracingMiddleware(provider, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerSpan = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(tt.status)
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("Traceparent", tt.traceparent)
+			}
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("recorded %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+
+			if span.Name() != "GET /users/{id}" || span.SpanKind() != trace.SpanKindServer {
+				t.Fatalf("span %q of kind %v, want server span %q", span.Name(), span.SpanKind(), "GET /users/{id}")
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Fatalf("span status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+			if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+				t.Fatal("handler context does not carry the server span")
+			}
+
+			if tt.traceparent != "" {
+				if got := span.SpanContext().TraceID().String(); got != traceID {
+					t.Fatalf("trace ID = %s, want %s", got, traceID)
+				}
+				if got := span.Parent().SpanID().String(); got != parentID || !span.Parent().IsRemote() {
+					t.Fatalf("parent span = %s, want remote %s", got, parentID)
+				}
+			} else if span.Parent().IsValid() {
+				t.Fatalf("parent span = %s, want a root span", span.Parent().SpanID())
+			}
+
+			attributes := make(map[string]string)
+			for _, kv := range span.Attributes() {
+				attributes[string(kv.Key)] = kv.Value.Emit()
+			}
+			want := map[string]string{
+				"http.request.method":       http.MethodGet,
+				"url.path":                  "/users/7",
+				"http.route":                "GET /users/{id}",
+				"http.response.status_code": strconv.Itoa(tt.status),
+			}
+			for key, value := range want {
+				if attributes[key] != value {
+					t.Fatalf("%s = %q, want %q", key, attributes[key], value)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+
+	"github.com/viktor8881/service-utilities/http/correlation"
 )
 
 type Transport struct {
@@ -128,6 +130,9 @@ func ErrorHandler(w http.ResponseWriter,
 		zap.Int("httpCode2user", code),
 		zap.String("httpBody2user", message),
 	}
+	if requestID := correlation.RequestIDFromContext(r.Context()); requestID != "" {
+		zapFields = append(zapFields, zap.String("requestID", requestID))
+	}
 	if err != nil {
 		zapFields = append(zapFields, zap.Error(err))
 	}
@@ -0,0 +1,100 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// KeyProvider returns the shared secret of a key ID.
+type KeyProvider interface {
+	// Key returns ErrUnknownKey if there is no such key.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// SigningKeyProvider also returns the key new signatures are made with.
+type SigningKeyProvider interface {
+	KeyProvider
+	SigningKey(ctx context.Context) (keyID string, key []byte, err error)
+}
+
+// Keyring is an in-memory SigningKeyProvider. Keys are rotated in three steps: Add the new key on the
+// verifying side, SetCurrent on the signing side once every verifier knows it, Remove the old key.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	current string
+}
+
+func NewKeyring(currentKeyID string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{keys: maps.Clone(keys)}
+	if k.keys == nil {
+		k.keys = make(map[string][]byte)
+	}
+
+	if currentKeyID != "" {
+		if err := k.SetCurrent(currentKeyID); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+func (k *Keyring) Key(_ context.Context, keyID string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	return key, nil
+}
+
+func (k *Keyring) SigningKey(_ context.Context) (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[k.current]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: no signing key", ErrUnknownKey)
+	}
+
+	return k.current, key, nil
+}
+
+func (k *Keyring) Add(keyID string, key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[keyID] = key
+}
+
+// Remove deletes the key, the current signing key can not be removed.
+func (k *Keyring) Remove(keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if keyID == k.current {
+		return fmt.Errorf("signature: key %s is used for signing", keyID)
+	}
+	delete(k.keys, keyID)
+
+	return nil
+}
+
+// SetCurrent makes a known key the signing key.
+func (k *Keyring) SetCurrent(keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[keyID]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	k.current = keyID
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package signature
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const nonceSweepInterval = time.Minute
+
+// NonceCache remembers nonces until they expire, a shared implementation (e.g. Redis SET NX with expiry)
+// is needed when the service runs more than one instance.
+type NonceCache interface {
+	// Add stores the nonce and reports whether it was not stored yet.
+	Add(ctx context.Context, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryNonceCache is a NonceCache for a single instance, expired nonces are removed once a minute.
+type MemoryNonceCache struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{
+		nonces:    make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (c *MemoryNonceCache) Add(_ context.Context, nonce string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > nonceSweepInterval {
+		for stored, expires := range c.nonces {
+			if now.After(expires) {
+				delete(c.nonces, stored)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if expires, ok := c.nonces[nonce]; ok && !now.After(expires) {
+		return false, nil
+	}
+	c.nonces[nonce] = expiresAt
+
+	return true, nil
+}
@@ -0,0 +1,374 @@
+// Package signature signs service-to-service requests with a shared-secret HMAC-SHA256 and verifies them,
+// used by client.SigningRoundTripper and server.SignatureMiddleware.
+//
+// The signature covers the method, the escaped path, the canonical query, the signed headers, the SHA-256
+// digest of the body, a timestamp and a nonce, and is sent in a single header:
+//
+//	X-Signature: keyId="2026-10",ts=1792108800,nonce="9f2c…",headers="content-type;host",sig="base64…"
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Signature"
+
+	defaultMaxSkew = 5 * time.Minute
+	// DefaultMaxBodySize limits the request body read by Verifier to compute its digest.
+	DefaultMaxBodySize = 10 << 20
+)
+
+var (
+	ErrMissingSignature = errors.New("signature: missing signature")
+	ErrMalformed        = errors.New("signature: malformed signature header")
+	ErrUnknownKey       = errors.New("signature: unknown key")
+	ErrInvalidSignature = errors.New("signature: invalid signature")
+	ErrClockSkew        = errors.New("signature: timestamp is outside of the allowed clock skew")
+	ErrReplayed         = errors.New("signature: nonce was already used")
+	ErrBodyTooLarge     = errors.New("signature: request body is too large")
+)
+
+type keyIDContextKey struct{}
+
+// WithKeyID is used by server.SignatureMiddleware to store the key ID of a verified request.
+func WithKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, keyIDContextKey{}, keyID)
+}
+
+// KeyIDFromContext returns the key ID the request was signed with, it identifies the calling service.
+func KeyIDFromContext(ctx context.Context) string {
+	keyID, _ := ctx.Value(keyIDContextKey{}).(string)
+	return keyID
+}
+
+// Sign signs the request with the signing key of keys and sets the X-Signature header. The body is read
+// through req.GetBody when it is set, otherwise it is read and replaced. Header names are case-insensitive,
+// "host" means the request host.
+func Sign(req *http.Request, keys SigningKeyProvider, headers []string) error {
+	keyID, key, err := keys.SigningKey(req.Context())
+	if err != nil {
+		return err
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+
+	params := signatureParams{
+		keyID:     keyID,
+		timestamp: time.Now().Unix(),
+		nonce:     newNonce(),
+		headers:   normalizeHeaderNames(headers),
+	}
+	params.signature = compute(key, canonicalString(req, params, body))
+
+	req.Header.Set(HeaderSignature, params.String())
+
+	return nil
+}
+
+// Verifier checks the X-Signature header of incoming requests.
+type Verifier struct {
+	Keys KeyProvider
+	// Nonces remembers the nonces of verified requests to reject replays, replays are not detected if nil.
+	Nonces NonceCache
+	// MaxSkew is the allowed difference between the request timestamp and the local clock, 5 minutes by default.
+	MaxSkew time.Duration
+	// RequiredHeaders must be among the signed headers.
+	RequiredHeaders []string
+	MaxBodySize     int64
+}
+
+func NewVerifier(keys KeyProvider, nonces NonceCache) *Verifier {
+	return &Verifier{
+		Keys:        keys,
+		Nonces:      nonces,
+		MaxSkew:     defaultMaxSkew,
+		MaxBodySize: DefaultMaxBodySize,
+	}
+}
+
+// Verify checks the signature of the request and returns the key ID it is signed with. The body is read
+// and replaced, so that the handler can still read it.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	value := r.Header.Get(HeaderSignature)
+	if value == "" {
+		return "", ErrMissingSignature
+	}
+
+	params, err := parseSignature(value)
+	if err != nil {
+		return "", err
+	}
+
+	for _, name := range normalizeHeaderNames(v.RequiredHeaders) {
+		if !slices.Contains(params.headers, name) {
+			return params.keyID, fmt.Errorf("%w: header %s is not signed", ErrInvalidSignature, name)
+		}
+	}
+
+	now := time.Now()
+	timestamp := time.Unix(params.timestamp, 0)
+	if skew := now.Sub(timestamp).Abs(); skew > v.maxSkew() {
+		return params.keyID, fmt.Errorf("%w: %s", ErrClockSkew, skew.Truncate(time.Second))
+	}
+
+	key, err := v.Keys.Key(r.Context(), params.keyID)
+	if err != nil {
+		return params.keyID, err
+	}
+
+	body, err := v.readBody(r)
+	if err != nil {
+		return params.keyID, err
+	}
+
+	expected, _ := base64.StdEncoding.DecodeString(compute(key, canonicalString(r, params, body)))
+	actual, err := base64.StdEncoding.DecodeString(params.signature)
+	if err != nil || !hmac.Equal(expected, actual) {
+		return params.keyID, ErrInvalidSignature
+	}
+
+	// only verified nonces are remembered, otherwise anyone could fill the cache
+	if v.Nonces != nil {
+		fresh, err := v.Nonces.Add(r.Context(), params.keyID+":"+params.nonce, timestamp.Add(v.maxSkew()))
+		if err != nil {
+			return params.keyID, err
+		}
+		if !fresh {
+			return params.keyID, ErrReplayed
+		}
+	}
+
+	return params.keyID, nil
+}
+
+func (v *Verifier) maxSkew() time.Duration {
+	if v.MaxSkew > 0 {
+		return v.MaxSkew
+	}
+
+	return defaultMaxSkew
+}
+
+func (v *Verifier) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	limit := v.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+type signatureParams struct {
+	keyID     string
+	timestamp int64
+	nonce     string
+	headers   []string
+	signature string
+}
+
+func (p signatureParams) String() string {
+	return fmt.Sprintf(`keyId=%q,ts=%d,nonce=%q,headers=%q,sig=%q`,
+		p.keyID, p.timestamp, p.nonce, strings.Join(p.headers, ";"), p.signature)
+}
+
+func parseSignature(value string) (signatureParams, error) {
+	var params signatureParams
+	seen := make(map[string]bool)
+
+	for _, field := range strings.Split(value, ",") {
+		name, raw, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return params, ErrMalformed
+		}
+		raw = strings.Trim(raw, `"`)
+		seen[name] = true
+
+		switch name {
+		case "keyId":
+			params.keyID = raw
+		case "ts":
+			timestamp, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return params, ErrMalformed
+			}
+			params.timestamp = timestamp
+		case "nonce":
+			params.nonce = raw
+		case "headers":
+			if raw != "" {
+				params.headers = strings.Split(raw, ";")
+			}
+		case "sig":
+			params.signature = raw
+		}
+	}
+
+	for _, name := range []string{"keyId", "ts", "nonce", "headers", "sig"} {
+		if !seen[name] {
+			return params, fmt.Errorf("%w: %s is missing", ErrMalformed, name)
+		}
+	}
+	if params.keyID == "" || params.nonce == "" || params.signature == "" {
+		return params, ErrMalformed
+	}
+
+	return params, nil
+}
+
+// canonicalString is the signed content, one element per line:
+// method, escaped path, canonical query, "name:value" of every signed header, timestamp, nonce, hex body digest.
+func canonicalString(r *http.Request, params signatureParams, body []byte) string {
+	var b strings.Builder
+
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	b.WriteString(method)
+	b.WriteString("\n")
+	// the client sends "/" for an empty path
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+	b.WriteString("\n")
+	b.WriteString(canonicalQuery(r.URL.Query()))
+	b.WriteString("\n")
+
+	for _, name := range params.headers {
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(headerValue(r, name))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(strconv.FormatInt(params.timestamp, 10))
+	b.WriteString("\n")
+	b.WriteString(params.nonce)
+	b.WriteString("\n")
+
+	digest := sha256.Sum256(body)
+	b.WriteString(hex.EncodeToString(digest[:]))
+
+	return b.String()
+}
+
+// canonicalQuery sorts the parameters by name and the values of each name.
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func headerValue(r *http.Request, name string) string {
+	if name == "host" {
+		if r.Host != "" {
+			return r.Host
+		}
+		return r.URL.Host
+	}
+
+	values := slices.Clone(r.Header.Values(name))
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func normalizeHeaderNames(headers []string) []string {
+	names := make([]string, 0, len(headers))
+	for _, name := range headers {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+func compute(key []byte, canonical string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(canonical))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func newNonce() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = body.Close()
+		}()
+		return io.ReadAll(body)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
@@ -0,0 +1,237 @@
+package signature
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	oldKey = []byte("old-secret")
+	newKey = []byte("new-secret")
+)
+
+func newTestRequest(t *testing.T) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "http://orders.local/api/orders?b=2&a=1&a=0", strings.NewReader(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return req
+}
+
+func newTestKeyring(t *testing.T, current string, keys map[string][]byte) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+// signAt signs the request like Sign with a given timestamp.
+func signAt(t *testing.T, req *http.Request, keyID string, key []byte, timestamp time.Time) {
+	t.Helper()
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := signatureParams{
+		keyID:     keyID,
+		timestamp: timestamp.Unix(),
+		nonce:     newNonce(),
+		headers:   normalizeHeaderNames([]string{"Content-Type", "Host"}),
+	}
+	params.signature = compute(key, canonicalString(req, params, body))
+	req.Header.Set(HeaderSignature, params.String())
+}
+
+func TestVerify(t *testing.T) {
+	signWith := func(current string) func(t *testing.T, req *http.Request) {
+		return func(t *testing.T, req *http.Request) {
+			keyring := newTestKeyring(t, current, map[string][]byte{"old": oldKey, "new": newKey})
+			if err := Sign(req, keyring, []string{"Content-Type", "Host"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	signAtOffset := func(offset time.Duration) func(t *testing.T, req *http.Request) {
+		return func(t *testing.T, req *http.Request) {
+			signAt(t, req, "old", oldKey, time.Now().Add(offset))
+		}
+	}
+
+	tests := []struct {
+		name string
+		sign func(t *testing.T, req *http.Request)
+		// tamper changes the request after it is signed
+		tamper func(req *http.Request)
+		// verifierKeys are the keys known to the verifier, old and new by default
+		verifierKeys map[string][]byte
+		wantKeyID    string
+		wantErr      error
+	}{
+		{name: "valid", sign: signWith("old"), wantKeyID: "old"},
+		{name: "reordered query", sign: signWith("old"), tamper: func(req *http.Request) { req.URL.RawQuery = "a=1&a=0&b=2" }, wantKeyID: "old"},
+		{name: "unsigned header changed", sign: signWith("old"), tamper: func(req *http.Request) { req.Header.Set("User-Agent", "other") }, wantKeyID: "old"},
+		{name: "missing signature", sign: func(*testing.T, *http.Request) {}, wantErr: ErrMissingSignature},
+		{name: "malformed signature", sign: signWith("old"), tamper: func(req *http.Request) { req.Header.Set(HeaderSignature, `keyId="old",ts=1`) }, wantErr: ErrMalformed},
+
+		{name: "timestamp within skew", sign: signAtOffset(-4 * time.Minute), wantKeyID: "old"},
+		{name: "timestamp in the past", sign: signAtOffset(-6 * time.Minute), wantErr: ErrClockSkew},
+		{name: "timestamp in the future", sign: signAtOffset(6 * time.Minute), wantErr: ErrClockSkew},
+
+		{name: "query parameter added", sign: signWith("old"), tamper: func(req *http.Request) { req.URL.RawQuery += "&admin=true" }, wantErr: ErrInvalidSignature},
+		{name: "query value changed", sign: signWith("old"), tamper: func(req *http.Request) { req.URL.RawQuery = "b=3&a=1&a=0" }, wantErr: ErrInvalidSignature},
+		{name: "body changed", sign: signWith("old"), tamper: func(req *http.Request) { req.Body = io.NopCloser(strings.NewReader(`{"id":2}`)) }, wantErr: ErrInvalidSignature},
+		{name: "body removed", sign: signWith("old"), tamper: func(req *http.Request) { req.Body = http.NoBody }, wantErr: ErrInvalidSignature},
+		{name: "path changed", sign: signWith("old"), tamper: func(req *http.Request) { req.URL.Path = "/api/refunds" }, wantErr: ErrInvalidSignature},
+		{name: "method changed", sign: signWith("old"), tamper: func(req *http.Request) { req.Method = http.MethodPut }, wantErr: ErrInvalidSignature},
+		{name: "host changed", sign: signWith("old"), tamper: func(req *http.Request) { req.Host = "payments.local" }, wantErr: ErrInvalidSignature},
+		{name: "signed header changed", sign: signWith("old"), tamper: func(req *http.Request) { req.Header.Set("Content-Type", "text/plain") }, wantErr: ErrInvalidSignature},
+		{name: "key id swapped", sign: signWith("old"), tamper: func(req *http.Request) {
+			req.Header.Set(HeaderSignature, strings.Replace(req.Header.Get(HeaderSignature), `keyId="old"`, `keyId="new"`, 1))
+		}, wantErr: ErrInvalidSignature},
+
+		{name: "rotated key", sign: signWith("new"), wantKeyID: "new"},
+		{name: "old key during rotation", sign: signWith("old"), wantKeyID: "old"},
+		{name: "new key unknown to the verifier", sign: signWith("new"), verifierKeys: map[string][]byte{"old": oldKey}, wantErr: ErrUnknownKey},
+		{name: "old key removed", sign: signWith("old"), verifierKeys: map[string][]byte{"new": newKey}, wantErr: ErrUnknownKey},
+		{name: "same key id with another secret", sign: signWith("new"), verifierKeys: map[string][]byte{"new": oldKey}, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := tt.verifierKeys
+			if keys == nil {
+				keys = map[string][]byte{"old": oldKey, "new": newKey}
+			}
+			verifier := NewVerifier(newTestKeyring(t, "", keys), NewMemoryNonceCache())
+
+			req := newTestRequest(t)
+			tt.sign(t, req)
+			if tt.tamper != nil {
+				tt.tamper(req)
+			}
+
+			keyID, err := verifier.Verify(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && keyID != tt.wantKeyID {
+				t.Fatalf("Verify() key ID = %q, want %q", keyID, tt.wantKeyID)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		nonces  NonceCache
+		wantErr error
+	}{
+		{name: "with nonce cache", nonces: NewMemoryNonceCache(), wantErr: ErrReplayed},
+		{name: "without nonce cache", nonces: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := newTestKeyring(t, "old", map[string][]byte{"old": oldKey})
+			verifier := NewVerifier(keyring, tt.nonces)
+
+			req := newTestRequest(t)
+			if err := Sign(req, keyring, []string{"Content-Type"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := verifier.Verify(req); err != nil {
+				t.Fatalf("first Verify() error = %v", err)
+			}
+
+			// the body was replaced by Verify, the replayed request is identical
+			if _, err := verifier.Verify(req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("replayed Verify() error = %v, want %v", err, tt.wantErr)
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil || string(body) != `{"id":1}` {
+				t.Fatalf("body after Verify() = %q (%v), want the original body", body, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectedNonceIsNotRemembered(t *testing.T) {
+	keyring := newTestKeyring(t, "old", map[string][]byte{"old": oldKey})
+	verifier := NewVerifier(keyring, NewMemoryNonceCache())
+
+	req := newTestRequest(t)
+	if err := Sign(req, keyring, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	forged := req.Clone(req.Context())
+	forged.Body = io.NopCloser(strings.NewReader(`{"id":2}`))
+	if _, err := verifier.Verify(forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged Verify() error = %v, want %v", err, ErrInvalidSignature)
+	}
+
+	// a forged request with the nonce of a genuine one must not block it
+	if _, err := verifier.Verify(req); err != nil {
+		t.Fatalf("genuine Verify() error = %v", err)
+	}
+}
+
+func TestVerifyRequiredHeaders(t *testing.T) {
+	keyring := newTestKeyring(t, "old", map[string][]byte{"old": oldKey})
+	verifier := NewVerifier(keyring, nil)
+	verifier.RequiredHeaders = []string{"Host"}
+
+	tests := []struct {
+		name    string
+		headers []string
+		wantErr error
+	}{
+		{name: "required header signed", headers: []string{"host"}},
+		{name: "required header not signed", headers: []string{"Content-Type"}, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(t)
+			if err := Sign(req, keyring, tt.headers); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := verifier.Verify(req); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyBodyTooLarge(t *testing.T) {
+	keyring := newTestKeyring(t, "old", map[string][]byte{"old": oldKey})
+	verifier := NewVerifier(keyring, nil)
+	verifier.MaxBodySize = 4
+
+	req := newTestRequest(t)
+	if err := Sign(req, keyring, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifier.Verify(req); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Verify() error = %v, want %v", err, ErrBodyTooLarge)
+	}
+}
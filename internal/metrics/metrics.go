@@ -0,0 +1,36 @@
+// Package metrics registers the Prometheus collectors of the round trippers, middlewares and reloaders.
+//
+// Their RegisterMetrics(registerer, name) methods all follow the same convention: a nil registerer means
+// prometheus.DefaultRegisterer, name is set as a constant label that tells apart the instances of a service,
+// and instances registered with the same name share their collectors. MetricRoundTripper names it
+// RegisterNamedMetrics, its RegisterMetrics without arguments is kept for the callers of earlier versions.
+package metrics
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MustRegisterOrExisting registers the collector in registerer (prometheus.DefaultRegisterer if nil).
+// If an equal collector is already registered, e.g. by another instance with the same name, the existing one
+// is returned to be shared instead of causing a panic.
+func MustRegisterOrExisting[T prometheus.Collector](registerer prometheus.Registerer, collector T) T {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector
+	}
+
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		if existing, ok := alreadyRegistered.ExistingCollector.(T); ok {
+			return existing
+		}
+	}
+
+	panic(err)
+}
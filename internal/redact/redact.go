@@ -0,0 +1,108 @@
+// Package redact masks secrets in headers, query strings and JSON bodies before they are logged or stored.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Mask replaces redacted values.
+const Mask = "REDACTED"
+
+// Header returns a copy of header with the values of names replaced by Mask.
+func Header(header http.Header, names []string) http.Header {
+	redacted := header.Clone()
+	for _, name := range names {
+		if _, ok := redacted[http.CanonicalHeaderKey(name)]; ok {
+			redacted.Set(name, Mask)
+		}
+	}
+
+	return redacted
+}
+
+// URL returns u, or a copy of it with the values of the query parameters names replaced by Mask.
+// Names are compared case-insensitively.
+func URL(u *url.URL, names []string) *url.URL {
+	query := u.Query()
+
+	redacted := false
+	for key, values := range query {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				for i := range values {
+					values[i] = Mask
+				}
+				redacted = true
+			}
+		}
+	}
+
+	if !redacted {
+		return u
+	}
+
+	clone := *u
+	clone.RawQuery = query.Encode()
+
+	return &clone
+}
+
+// JSONFields replaces the values at paths in a JSON document with Mask. A path is a list of
+// object keys separated by dots, "*" matches any key or array element: "user.password", "items.*.token".
+// It reports false if body is not valid JSON, in which case body is returned unchanged.
+func JSONFields(body []byte, paths []string) ([]byte, bool) {
+	if len(paths) == 0 {
+		return body, json.Valid(body)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return body, false
+	}
+
+	for _, path := range paths {
+		document = redactPath(document, strings.Split(path, "."))
+	}
+
+	redacted, err := json.Marshal(document)
+	if err != nil {
+		return body, false
+	}
+
+	return redacted, true
+}
+
+func redactPath(node any, path []string) any {
+	if len(path) == 0 {
+		return Mask
+	}
+
+	key, rest := path[0], path[1:]
+
+	switch value := node.(type) {
+	case map[string]any:
+		for k, v := range value {
+			if key == "*" || k == key {
+				value[k] = redactPath(v, rest)
+			}
+		}
+	case []any:
+		for i, v := range value {
+			// arrays are traversed transparently unless the path addresses their elements
+			if key == "*" {
+				value[i] = redactPath(v, rest)
+			} else {
+				value[i] = redactPath(v, path)
+			}
+		}
+	}
+
+	return node
+}
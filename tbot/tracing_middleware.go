@@ -0,0 +1,82 @@
+package tbot
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	tracerName = "github.com/viktor8881/service-utilities/tbot"
+	spanName   = "tbot.update"
+
+	// contextKey is the telebot.Context key of the context.Context that carries the span.
+	contextKey = "tbot.context"
+)
+
+// ContextFrom returns the context.Context stored by TracingMiddleware, so that handlers can pass
+// the span on to db and client calls. It returns context.Background() without the middleware.
+func ContextFrom(c telebot.Context) context.Context {
+	if ctx, ok := c.Get(contextKey).(context.Context); ok {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// TracingMiddleware starts a span named "tbot.update" for every update. The bot command (e.g. "/start")
+// is set as the tbot.command attribute, the text of messages is not recorded.
+// A nil tracerProvider means the otel global one.
+func TracingMiddleware(tracerProvider trace.TracerProvider) Middleware {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(c telebot.Context) error {
+			tp := tracerProvider
+			if tp == nil {
+				tp = otel.GetTracerProvider()
+			}
+
+			ctx, span := tp.Tracer(tracerName).Start(ContextFrom(c), spanName,
+				trace.WithSpanKind(trace.SpanKindServer),
+			)
+			defer span.End()
+
+			if command := commandName(c.Text()); command != "" {
+				span.SetAttributes(attribute.String("tbot.command", command))
+			}
+
+			if sender := c.Sender(); sender != nil {
+				span.SetAttributes(attribute.Int64("tbot.user_id", sender.ID))
+			}
+			if chat := c.Chat(); chat != nil {
+				span.SetAttributes(attribute.Int64("tbot.chat_id", chat.ID))
+			}
+
+			c.Set(contextKey, ctx)
+
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return err
+		}
+	}
+}
+
+// commandName returns the command of a "/command@bot args" text, an empty string for other texts.
+func commandName(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+
+	command, _, _ := strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+
+	return command
+}
@@ -0,0 +1,440 @@
+// Package tlsconfig loads TLS certificates from files and reloads them when the files change,
+// so that short-lived certificates can be rotated on disk without restarting the service.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/viktor8881/service-utilities/internal/metrics"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Files are the PEM files of the certificate. CertFile and KeyFile are the certificate presented to the peer,
+// CAFile is the bundle the peer certificate is verified with. Either the pair or CAFile may be empty.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	// ReloadInterval is how often the files are checked for changes, 30 seconds by default.
+	ReloadInterval time.Duration
+}
+
+// Reloader keeps the current certificate and CA pool loaded from Files and swaps them atomically
+// when the files change. A failed reload (e.g. the certificate is rotated but the key is not yet)
+// is logged and retried on the next check, the previous certificate stays in use.
+type Reloader struct {
+	files  Files
+	logger *zap.Logger
+
+	certificate atomic.Pointer[tls.Certificate]
+	pool        atomic.Pointer[x509.CertPool]
+
+	mu       sync.Mutex
+	modTimes map[string]time.Time
+	caExpiry time.Time
+
+	expiryGauge *prometheus.GaugeVec
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewReloader loads the files and starts watching them until Close is called. Reload failures are logged
+// to logger, a nil logger discards them.
+func NewReloader(files Files, logger *zap.Logger) (*Reloader, error) {
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("tlsconfig: CertFile and KeyFile must be set together")
+	}
+	if files.CertFile == "" && files.CAFile == "" {
+		return nil, errors.New("tlsconfig: no files to load")
+	}
+	if files.ReloadInterval <= 0 {
+		files.ReloadInterval = defaultReloadInterval
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	r := &Reloader{
+		files:    files,
+		logger:   logger,
+		modTimes: make(map[string]time.Time),
+	}
+	r.expiryGauge = newExpiryGauge(nil)
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.wg.Add(1)
+	go r.watch(ctx)
+
+	return r, nil
+}
+
+// Reload loads the files, the current certificate and pool are replaced only if all of them are valid.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		return err
+	}
+
+	var certificate *tls.Certificate
+	if r.files.CertFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("tlsconfig: load certificate: %w", err)
+		}
+		if loaded.Leaf == nil {
+			if loaded.Leaf, err = x509.ParseCertificate(loaded.Certificate[0]); err != nil {
+				return fmt.Errorf("tlsconfig: parse certificate: %w", err)
+			}
+		}
+		certificate = &loaded
+	}
+
+	var pool *x509.CertPool
+	var caExpiry time.Time
+	if r.files.CAFile != "" {
+		pool, caExpiry, err = loadCertPool(r.files.CAFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if certificate != nil {
+		r.certificate.Store(certificate)
+	}
+	if pool != nil {
+		r.pool.Store(pool)
+		r.caExpiry = caExpiry
+	}
+	r.modTimes = modTimes
+	r.setExpiry()
+
+	return nil
+}
+
+// Close stops watching the files.
+func (r *Reloader) Close() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// RegisterMetrics registers the expiry gauge in registerer with the name label set to name.
+func (r *Reloader) RegisterMetrics(registerer prometheus.Registerer, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expiryGauge = metrics.MustRegisterOrExisting(registerer, newExpiryGauge(prometheus.Labels{"name": name}))
+	r.setExpiry()
+}
+
+// setExpiry must be called with r.mu held.
+func (r *Reloader) setExpiry() {
+	if certificate := r.certificate.Load(); certificate != nil {
+		r.expiryGauge.WithLabelValues(r.files.CertFile).Set(float64(certificate.Leaf.NotAfter.Unix()))
+	}
+	if r.pool.Load() != nil {
+		r.expiryGauge.WithLabelValues(r.files.CAFile).Set(float64(r.caExpiry.Unix()))
+	}
+}
+
+func newExpiryGauge(constLabels prometheus.Labels) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "tls_certificate_expiry_timestamp_seconds",
+			Help:        "Unix time when the certificate expires, for a CA bundle the earliest expiry.",
+			ConstLabels: constLabels,
+		},
+		[]string{"file"},
+	)
+}
+
+// NotAfter returns the expiry time of the current certificate, zero without CertFile.
+func (r *Reloader) NotAfter() time.Time {
+	certificate := r.certificate.Load()
+	if certificate == nil {
+		return time.Time{}
+	}
+
+	return certificate.Leaf.NotAfter
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.currentCertificate()
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.currentCertificate()
+}
+
+// CertPool returns the current CA pool, nil without CAFile.
+func (r *Reloader) CertPool() *x509.CertPool {
+	return r.pool.Load()
+}
+
+// ClientConfig returns a config for a client, e.g. for client.WithTLSReloader. The client presents the current
+// certificate and, with CAFile, verifies servers with the current CA pool instead of the system roots.
+//
+// The server name is taken from the handshake, which has none for servers dialed by IP address (they are not
+// sent in SNI), so with CAFile such servers are rejected. Use DialTLSContext to verify them against the dialed address.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return r.WrapClientConfig(nil)
+}
+
+// WrapClientConfig is ClientConfig with the other settings taken from a clone of base.
+func (r *Reloader) WrapClientConfig(base *tls.Config) *tls.Config {
+	config := cloneClientConfig(base)
+
+	if r.files.CertFile != "" {
+		config.GetClientCertificate = r.GetClientCertificate
+	}
+
+	if r.files.CAFile != "" {
+		// RootCAs can not be swapped in a config that is in use, the chain is verified by VerifyConnection instead
+		verifyConnection := config.VerifyConnection
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if err := r.verifyServer(state); err != nil {
+				return err
+			}
+			if verifyConnection != nil {
+				return verifyConnection(state)
+			}
+			return nil
+		}
+	}
+
+	return config
+}
+
+// DialTLSContext returns a function for http.Transport.DialTLSContext that connects with dial (a plain
+// net.Dialer if nil) and verifies the server against the dialed host, IP addresses included, with the current
+// CA pool or, without CAFile, with the roots of base. Every connection uses a clone of base (nil for defaults)
+// with the server name, the CA pool and the client certificate of the reloader. Connections made through
+// a proxy use the transport's TLSClientConfig instead, see WrapClientConfig.
+func (r *Reloader) DialTLSContext(base *tls.Config, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("tlsconfig: %w", err)
+		}
+
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := tls.Client(conn, r.clientConfigFor(base, host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+}
+
+// clientConfigFor returns a clone of base that verifies the server as host with the standard chain and name checks.
+func (r *Reloader) clientConfigFor(base *tls.Config, host string) *tls.Config {
+	config := cloneClientConfig(base)
+	config.ServerName = host
+
+	if pool := r.pool.Load(); pool != nil {
+		config.RootCAs = pool
+	}
+
+	if r.files.CertFile != "" {
+		config.GetClientCertificate = r.GetClientCertificate
+	}
+
+	return config
+}
+
+func cloneClientConfig(base *tls.Config) *tls.Config {
+	if base == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return base.Clone()
+}
+
+// ServerConfig returns a config for a server, e.g. for http.App.TLSConfig. Client certificates are requested
+// and verified with the current CA pool according to clientAuth: tls.RequireAndVerifyClientCert for mutual
+// TLS, tls.VerifyClientCertIfGiven to accept clients without a certificate, tls.NoClientCert for plain TLS.
+// Verifying client certificates requires a CAFile, crypto/tls would trust any publicly issued one otherwise.
+func (r *Reloader) ServerConfig(clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	verifies := clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert
+	if verifies && r.files.CAFile == "" {
+		return nil, fmt.Errorf("tlsconfig: %s requires a CAFile to verify client certificates", clientAuth)
+	}
+
+	newConfig := func() *tls.Config {
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: r.GetCertificate,
+			ClientAuth:     clientAuth,
+			ClientCAs:      r.pool.Load(),
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+	}
+
+	config := newConfig()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return newConfig(), nil
+	}
+
+	return config, nil
+}
+
+func (r *Reloader) currentCertificate() (*tls.Certificate, error) {
+	certificate := r.certificate.Load()
+	if certificate == nil {
+		return nil, errors.New("tlsconfig: no certificate configured")
+	}
+
+	return certificate, nil
+}
+
+func (r *Reloader) verifyServer(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("tlsconfig: server presented no certificate")
+	}
+	// without a name x509 verification skips the host check and would accept any certificate of the CA
+	if state.ServerName == "" {
+		return errors.New("tlsconfig: server name is unknown (dialed by IP address?), use Reloader.DialTLSContext")
+	}
+
+	options := x509.VerifyOptions{
+		Roots:         r.pool.Load(),
+		DNSName:       state.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, certificate := range state.PeerCertificates[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(options)
+	return err
+}
+
+func (r *Reloader) watch(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.files.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !r.changed() {
+			continue
+		}
+
+		if err := r.Reload(); err != nil {
+			r.logger.Error("tlsconfig: reload failed", zap.Error(err))
+			continue
+		}
+
+		r.logger.Info("tlsconfig: certificates reloaded", zap.Time("notAfter", r.NotAfter()))
+	}
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes, err := r.currentModTimes()
+	if err != nil {
+		// a file may be missing for a moment while it is replaced
+		return false
+	}
+
+	for path, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// currentModTimes must be called with r.mu held.
+func (r *Reloader) currentModTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, 3)
+	for _, path := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("tlsconfig: %w", err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("tlsconfig: load CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	var expiry time.Time
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("tlsconfig: parse CA %s: %w", path, err)
+		}
+
+		pool.AddCert(certificate)
+		if expiry.IsZero() || certificate.NotAfter.Before(expiry) {
+			expiry = certificate.NotAfter
+		}
+	}
+
+	if expiry.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("tlsconfig: no certificates found in %s", path)
+	}
+
+	return pool, expiry, nil
+}
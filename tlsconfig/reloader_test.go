@@ -0,0 +1,390 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a server certificate for the DNS names and IP addresses.
+func (ca *testCA) issue(t *testing.T, dnsNames []string, ips ...net.IP) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCertificate writes the certificate and its key as PEM files into dir.
+func writeCertificate(t *testing.T, dir string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+// touch sets the modification time of the files, a quick rewrite may keep the previous one.
+func touch(t *testing.T, modTime time.Time, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newCAReloader(t *testing.T, ca *testCA) *Reloader {
+	t.Helper()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReloader(Files{CAFile: caFile}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+
+	return r
+}
+
+func TestVerifyServer(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	r := newCAReloader(t, ca)
+
+	tests := []struct {
+		name       string
+		serverName string
+		cert       tls.Certificate
+		wantErr    bool
+	}{
+		{name: "matching DNS name", serverName: "svc.local", cert: ca.issue(t, []string{"svc.local"})},
+		{name: "other DNS name", serverName: "evil.local", cert: ca.issue(t, []string{"svc.local"}), wantErr: true},
+		{name: "unknown server name", serverName: "", cert: ca.issue(t, []string{"svc.local"}), wantErr: true},
+		{name: "unknown server name with IP SAN", serverName: "", cert: ca.issue(t, nil, net.ParseIP("10.0.0.5")), wantErr: true},
+		{name: "untrusted CA", serverName: "svc.local", cert: otherCA.issue(t, []string{"svc.local"}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.verifyServer(tls.ConnectionState{
+				ServerName:       tt.serverName,
+				PeerCertificates: []*x509.Certificate{tt.cert.Leaf},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialTLSContextIPHosts(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	r := newCAReloader(t, ca)
+
+	loopback := net.ParseIP("127.0.0.1")
+
+	tests := []struct {
+		name    string
+		cert    tls.Certificate
+		dialTLS bool
+		wantErr bool
+	}{
+		{name: "IP SAN of the dialed address", cert: ca.issue(t, nil, loopback), dialTLS: true},
+		{name: "IP SAN of another address", cert: ca.issue(t, nil, net.ParseIP("10.0.0.5")), dialTLS: true, wantErr: true},
+		{name: "DNS SAN only", cert: ca.issue(t, []string{"svc.local"}), dialTLS: true, wantErr: true},
+		{name: "untrusted CA", cert: otherCA.issue(t, nil, loopback), dialTLS: true, wantErr: true},
+		// without the dialed address ClientConfig must fail closed even for a valid certificate
+		{name: "ClientConfig only", cert: ca.issue(t, nil, loopback), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{tt.cert}}
+			server.StartTLS()
+			defer server.Close()
+
+			transport := &http.Transport{TLSClientConfig: r.ClientConfig()}
+			if tt.dialTLS {
+				transport.DialTLSContext = r.DialTLSContext(nil, nil)
+			}
+			defer transport.CloseIdleConnections()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RoundTrip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	ca := newTestCA(t)
+	registry := prometheus.NewRegistry()
+
+	for _, name := range []string{"client", "server", "server"} {
+		newCAReloader(t, ca).RegisterMetrics(registry, name)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the reloaders named "server" share the gauge, every reloader has its own CA file
+	if len(families) != 1 || len(families[0].GetMetric()) != 3 {
+		t.Fatalf("gathered %v, want one expiry series per reloader", families)
+	}
+	for _, metric := range families[0].GetMetric() {
+		if got := int64(metric.GetGauge().GetValue()); got != ca.cert.NotAfter.Unix() {
+			t.Fatalf("expiry = %d, want %d", got, ca.cert.NotAfter.Unix())
+		}
+	}
+}
+
+func TestReloadOnFileChange(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, ca.issue(t, []string{"svc.local"}))
+
+	// a nil logger must not panic on a failed reload
+	r, err := NewReloader(Files{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 10 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	first := r.NotAfter()
+
+	// a certificate without its key fails to load and the previous one stays in use
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, time.Now().Add(time.Minute), certFile)
+	time.Sleep(50 * time.Millisecond)
+	if got := r.NotAfter(); !got.Equal(first) {
+		t.Fatalf("NotAfter() = %v after a failed reload, want %v", got, first)
+	}
+
+	rotated := ca.issue(t, []string{"svc.local"})
+	writeCertificate(t, dir, rotated)
+	touch(t, time.Now().Add(2*time.Minute), certFile, keyFile)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		certificate, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certificate.Leaf.SerialNumber.Cmp(rotated.Leaf.SerialNumber) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the rotated certificate was not loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, ca.issue(t, nil, net.ParseIP("127.0.0.1")))
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReloader(Files{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		clientCert []tls.Certificate
+		wantErr    bool
+	}{
+		{name: "mutual TLS", clientAuth: tls.RequireAndVerifyClientCert, clientCert: []tls.Certificate{ca.issue(t, nil)}},
+		{name: "mutual TLS without client certificate", clientAuth: tls.RequireAndVerifyClientCert, wantErr: true},
+		{name: "client certificate of another CA", clientAuth: tls.RequireAndVerifyClientCert, clientCert: []tls.Certificate{otherCA.issue(t, nil)}, wantErr: true},
+		{name: "optional client certificate", clientAuth: tls.VerifyClientCertIfGiven},
+		{name: "plain TLS", clientAuth: tls.NoClientCert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			server.TLS, err = r.ServerConfig(tt.clientAuth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			transport := &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      r.CertPool(),
+				Certificates: tt.clientCert,
+				MinVersion:   tls.VersionTLS12,
+			}}
+			defer transport.CloseIdleConnections()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RoundTrip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerConfigWithoutCAFile(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := writeCertificate(t, t.TempDir(), ca.issue(t, nil, net.ParseIP("127.0.0.1")))
+
+	r, err := NewReloader(Files{CertFile: certFile, KeyFile: keyFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tests := []struct {
+		clientAuth tls.ClientAuthType
+		wantErr    bool
+	}{
+		{clientAuth: tls.NoClientCert},
+		{clientAuth: tls.RequestClientCert},
+		{clientAuth: tls.RequireAnyClientCert},
+		{clientAuth: tls.VerifyClientCertIfGiven, wantErr: true},
+		{clientAuth: tls.RequireAndVerifyClientCert, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clientAuth.String(), func(t *testing.T) {
+			config, err := r.ServerConfig(tt.clientAuth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ServerConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.ClientAuth != tt.clientAuth {
+				t.Fatalf("ClientAuth = %v, want %v", config.ClientAuth, tt.clientAuth)
+			}
+		})
+	}
+}